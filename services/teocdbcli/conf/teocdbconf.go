@@ -90,6 +90,17 @@ func (c *Teoconf) ReadBoth() (err error) {
 	return
 }
 
+// Reload read parameters from teo-cdb and save it to local config file.
+func (c *Teoconf) Reload() (err error) {
+	if err = c.ReadCdb(); err != nil {
+		return
+	}
+	if err := c.fconf.Write(); err != nil {
+		teolog.Debugf(MODULE, "write config error: %s\n", err)
+	}
+	return
+}
+
 // ReadCdb read l0 parameters from config in teo-cdb.
 func (c *Teoconf) ReadCdb() (err error) {
 
@@ -12,7 +12,6 @@ import (
 	"io"
 	"strconv"
 	"strings"
-	"unsafe"
 )
 
 // KeyValue is key value packet data (text or binary) used in requests
@@ -69,33 +68,46 @@ func (kv *KeyValue) UnmarshalBinary(data []byte) (err error) {
 	}
 	buf := bytes.NewReader(data)
 	le := binary.LittleEndian
-	ReadData := func(r io.Reader, order binary.ByteOrder, dataLen uint32) (data []byte) {
+	ReadData := func(r *bytes.Reader, order binary.ByteOrder, dataLen int) (data []byte, err error) {
+		if dataLen > r.Len() {
+			err = io.ErrUnexpectedEOF
+			return
+		}
 		data = make([]byte, dataLen)
-		binary.Read(r, order, &data)
+		err = binary.Read(r, order, &data)
 		return
 	}
-	ReadString := func(r io.Reader, order binary.ByteOrder) (str string) {
+	ReadString := func(r *bytes.Reader, order binary.ByteOrder) (str string, err error) {
 		var strLen uint16
-		binary.Read(r, order, &strLen)
-		str = string(ReadData(r, order, uint32(strLen)))
+		if err = binary.Read(r, order, &strLen); err != nil {
+			return
+		}
+		d, err := ReadData(r, order, int(strLen))
+		str = string(d)
 		return
 	}
-	ReadShortString := func(r io.Reader, order binary.ByteOrder) (str string) {
+	ReadShortString := func(r *bytes.Reader, order binary.ByteOrder) (str string, err error) {
 		var strLen uint8
-		binary.Read(r, order, &strLen)
-		str = string(ReadData(r, order, uint32(strLen)))
+		if err = binary.Read(r, order, &strLen); err != nil {
+			return
+		}
+		d, err := ReadData(r, order, int(strLen))
+		str = string(d)
+		return
+	}
+	if err = binary.Read(buf, le, &kv.Cmd); err != nil {
+		return
+	}
+	if err = binary.Read(buf, le, &kv.ID); err != nil {
+		return
+	}
+	if kv.Key, err = ReadString(buf, le); err != nil {
+		return
+	}
+	if kv.Err, err = ReadShortString(buf, le); err != nil {
 		return
 	}
-	binary.Read(buf, le, &kv.Cmd)
-	binary.Read(buf, le, &kv.ID)
-	kv.Key = ReadString(buf, le)
-	kv.Err = ReadShortString(buf, le)
-	kv.Value = ReadData(buf, le, uint32(len(data)-
-		int(unsafe.Sizeof(kv.Cmd))-
-		int(unsafe.Sizeof(kv.ID))-
-		(int(unsafe.Sizeof(uint16(0)))+len(kv.Key))-
-		(int(unsafe.Sizeof(uint8(0)))+len(kv.Err)),
-	))
+	kv.Value, err = ReadData(buf, le, buf.Len())
 	return
 }
 
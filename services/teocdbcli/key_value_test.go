@@ -153,3 +153,31 @@ func TestKeyValueText(t *testing.T) {
 		}
 	})
 }
+
+// FuzzKeyValueUnmarshalBinary check binary KeyValue parsing does not panic
+// and valid packets decoded to the same value
+func FuzzKeyValueUnmarshalBinary(f *testing.F) {
+	for _, kv := range []*KeyValue{
+		{Cmd: CmdSet, ID: 2, Key: "test.key.123", Value: []byte("Hello world!")},
+		{Cmd: CmdGet, ID: 1, Key: "room.game.1"},
+		{Cmd: CmdList, Key: "test.", Err: "not found"},
+		{},
+	} {
+		data, _ := kv.MarshalBinary()
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		kv := &KeyValue{}
+		if err := kv.UnmarshalBinary(data); err != nil {
+			return
+		}
+		out, err := kv.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 0 && string(out) != string(data) {
+			t.Fatalf("wrong marshal of unmarshalled data:\n got % x\nwant % x",
+				out, data)
+		}
+	})
+}
@@ -0,0 +1,425 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Load mode of teocli application. It starts N simulated L0 clients with
+// ramp-up, each client logins with its own name and sends messages mix of
+// echo, peers and user command requests to the target peer. At the end it
+// reports connection success rate, messages latency histograms and drops:
+// requests without answer, disconnects by server and number of clients the
+// L0 server reports.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/teocli/teocli"
+)
+
+// L0 server clients number commands
+const (
+	cmdL0ClientsNum       = 84 // Request clients number
+	cmdL0ClientsNumAnswer = 85 // Clients number
+)
+
+// Load messages kinds
+const (
+	loadEcho  = "echo"
+	loadPeers = "peers"
+	loadCmd   = "cmd"
+)
+
+// loadBuckets is latency histogram buckets upper bounds in milliseconds
+var loadBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000,
+	5000}
+
+// loadParams is load mode parameters
+type loadParams struct {
+	clients  int           // Number of clients (0 - load mode disabled)
+	ramp     time.Duration // Time to start all clients
+	duration time.Duration // Load duration after all clients started
+	interval time.Duration // Each client messages interval
+	mix      string        // Messages mix: kind:weight,...
+	peer     string        // Target peer
+	cmd      int           // User command
+	answer   int           // User command answer (0 - does not wait answer)
+	size     int           // User command data size
+	server   string        // L0 server peer name to request clients number
+	json     string        // Save report in JSON format to file (- to stdout)
+	tls      *tls.Config   // TLS config of tcp and wss connection
+}
+
+// loadMix is parsed messages mix
+type loadMix struct {
+	kinds   []string
+	weights []int
+	total   int
+}
+
+// loadLatency is latency histogram and percentiles in milliseconds
+type loadLatency struct {
+	Samples   int            `json:"samples"`
+	Min       float64        `json:"min_ms"`
+	P50       float64        `json:"p50_ms"`
+	P90       float64        `json:"p90_ms"`
+	P99       float64        `json:"p99_ms"`
+	Max       float64        `json:"max_ms"`
+	Histogram map[string]int `json:"histogram"`
+}
+
+// loadKind is statistic of one kind of messages
+type loadKind struct {
+	Sent     uint64       `json:"sent"`
+	Answered uint64       `json:"answered"`
+	Lost     uint64       `json:"lost"`
+	Errors   uint64       `json:"errors"`
+	Latency  *loadLatency `json:"latency,omitempty"`
+	samples  []float64
+}
+
+// loadReport is load report
+type loadReport struct {
+	Version       string               `json:"version"`
+	Remote        string               `json:"remote"`
+	Network       string               `json:"network"`
+	Clients       int                  `json:"clients"`
+	Duration      float64              `json:"duration_sec"`
+	Attempts      uint64               `json:"connect_attempts"`
+	Connected     int                  `json:"connected"`
+	SuccessRate   float64              `json:"connect_success_rate"`
+	Disconnects   uint64               `json:"disconnects"`
+	ServerClients *int                 `json:"server_clients,omitempty"`
+	Messages      map[string]*loadKind `json:"messages"`
+}
+
+// loadStat is load statistic collected by clients
+type loadStat struct {
+	sync.Mutex
+	attempts    uint64
+	connected   int
+	disconnects uint64
+	kinds       map[string]*loadKind
+}
+
+// check load parameters
+func (l *loadParams) check() (mix *loadMix, err error) {
+	switch {
+	case l.ramp < 0 || l.duration <= 0:
+		return nil, errors.New("ramp-up should be positive and duration " +
+			"should be more than zero")
+	case l.interval <= 0:
+		return nil, errors.New("messages interval should be more than zero")
+	case l.cmd < 0 || l.cmd > 255 || l.answer < 0 || l.answer > 255:
+		return nil, errors.New("wrong user command or answer command number")
+	case l.size < 0 || l.size > 0xFFFF:
+		return nil, errors.New("wrong user command data size")
+	}
+	return parseLoadMix(l.mix)
+}
+
+// parseLoadMix parse messages mix string: kind:weight[,kind:weight...]
+func parseLoadMix(s string) (mix *loadMix, err error) {
+	mix = &loadMix{}
+	for _, item := range strings.Split(s, ",") {
+		kw := strings.Split(strings.TrimSpace(item), ":")
+		if len(kw) != 2 {
+			return nil, fmt.Errorf("wrong messages mix item '%s'", item)
+		}
+		switch kw[0] {
+		case loadEcho, loadPeers, loadCmd:
+		default:
+			return nil, fmt.Errorf("wrong messages kind '%s'", kw[0])
+		}
+		w, err := strconv.Atoi(kw[1])
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("wrong messages weight '%s'", kw[1])
+		}
+		mix.kinds = append(mix.kinds, kw[0])
+		mix.weights = append(mix.weights, w)
+		mix.total += w
+	}
+	if mix.total == 0 {
+		return nil, errors.New("messages mix weights sum should be more " +
+			"than zero")
+	}
+	return
+}
+
+// next return random messages kind
+func (mix *loadMix) next(rnd *rand.Rand) string {
+	n := rnd.Intn(mix.total)
+	for i, w := range mix.weights {
+		if n < w {
+			return mix.kinds[i]
+		}
+		n -= w
+	}
+	return mix.kinds[len(mix.kinds)-1]
+}
+
+// run start load clients, wait duration and show report
+func (l *loadParams) run(name, addr string, tcp bool, timeout time.Duration) {
+	mix, err := l.check()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load:", err)
+		os.Exit(2)
+	}
+	network := "trudp"
+	switch {
+	case isWebsocket(addr):
+		network = "ws"
+	case tcp:
+		network = "tcp"
+	}
+	fmt.Printf("load %s %s: %d clients, ramp-up %v, duration %v\n", network,
+		addr, l.clients, l.ramp, l.duration)
+
+	stat := &loadStat{kinds: make(map[string]*loadKind)}
+	for _, kind := range mix.kinds {
+		stat.kinds[kind] = &loadKind{}
+	}
+	start := time.Now()
+	stop := start.Add(l.ramp + l.duration)
+	var wg sync.WaitGroup
+	for i := 0; i < l.clients; i++ {
+		delay := l.ramp * time.Duration(i) / time.Duration(l.clients)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			time.Sleep(delay)
+			l.client(fmt.Sprintf("%s-%d", name, i+1), addr, tcp, timeout,
+				stop, mix, stat, rand.New(rand.NewSource(int64(i))))
+		}(i)
+	}
+
+	// Request number of clients from L0 server in the middle of load
+	// duration when all clients should be connected
+	var serverClients *int
+	if l.server != "" {
+		time.Sleep(time.Until(start.Add(l.ramp + l.duration/2)))
+		if n, err := l.serverClients(name+"-monitor", addr, tcp,
+			timeout); err != nil {
+			fmt.Fprintln(os.Stderr, "load: server clients number:", err)
+		} else {
+			serverClients = &n
+		}
+	}
+	wg.Wait()
+
+	r := &loadReport{Version: teocli.Version, Remote: addr, Network: network,
+		Clients: l.clients, Duration: time.Since(start).Seconds(),
+		ServerClients: serverClients, Messages: stat.kinds}
+	r.Attempts, r.Connected, r.Disconnects = stat.attempts, stat.connected,
+		stat.disconnects
+	if l.clients > 0 {
+		r.SuccessRate = float64(stat.connected) / float64(l.clients)
+	}
+	for _, k := range stat.kinds {
+		k.Latency = loadPercentiles(k.samples)
+	}
+	l.show(r)
+}
+
+// client run one load client till stop time
+func (l *loadParams) client(name, addr string, tcp bool,
+	timeout time.Duration, stop time.Time, mix *loadMix, stat *loadStat,
+	rnd *rand.Rand) {
+
+	connected := make(chan struct{})
+	var once sync.Once
+	var online bool
+	config := teocli.SessionConfig{Reconnect: time.Second,
+		OnState: func(state teocli.State, err error) {
+			stat.Lock()
+			defer stat.Unlock()
+			switch state {
+			case teocli.StateConnecting:
+				stat.attempts++
+			case teocli.StateConnected:
+				online = true
+				once.Do(func() {
+					stat.connected++
+					close(connected)
+				})
+			case teocli.StateDisconnected:
+				if online {
+					online = false
+					stat.disconnects++
+				}
+			}
+		}}
+	s, err := newSession(name, addr, tcp, config, l.tls)
+	if err != nil {
+		return
+	}
+	s.Start()
+	defer s.Close()
+
+	select {
+	case <-connected:
+	case <-time.After(time.Until(stop)):
+		return
+	}
+	data := make([]byte, l.size)
+	for next := time.Now(); ; next = next.Add(l.interval) {
+		// Skip intervals missed while waiting for answers
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+		if !next.Before(stop) {
+			break
+		}
+		time.Sleep(time.Until(next))
+		kind := mix.next(rnd)
+		k := stat.kinds[kind]
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		t := time.Now()
+		var err error
+		switch kind {
+		case loadEcho:
+			echo := make([]byte, len(name)+1+8)
+			copy(echo, name)
+			binary.LittleEndian.PutUint64(echo[len(name)+1:],
+				uint64(t.UnixNano()/int64(time.Millisecond)))
+			_, err = s.Request(ctx, l.peer, teocli.CmdLEcho, echo,
+				teocli.AnswerCmd(teocli.CmdLEchoAnswer))
+		case loadPeers:
+			_, err = s.Request(ctx, l.peer, teocli.CmdLPeers, nil,
+				teocli.AnswerCmd(teocli.CmdLPeersAnswer))
+		case loadCmd:
+			if l.answer == 0 {
+				_, err = s.SendTo(l.peer, byte(l.cmd), data)
+				break
+			}
+			_, err = s.Request(ctx, l.peer, byte(l.cmd), data,
+				teocli.AnswerCmd(l.answer))
+		}
+		cancel()
+		ms := float64(time.Since(t)) / float64(time.Millisecond)
+		stat.Lock()
+		k.Sent++
+		switch {
+		case err == context.DeadlineExceeded:
+			k.Lost++
+		case err != nil:
+			k.Errors++
+		case kind != loadCmd || l.answer != 0:
+			k.Answered++
+			k.samples = append(k.samples, ms)
+		}
+		stat.Unlock()
+	}
+}
+
+// serverClients request number of clients connected to L0 server
+func (l *loadParams) serverClients(name, addr string, tcp bool,
+	timeout time.Duration) (n int, err error) {
+	s, err := newSession(name, addr, tcp, l.tls)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	pac, err := s.Request(ctx, l.server, cmdL0ClientsNum, nil,
+		teocli.AnswerCmd(cmdL0ClientsNumAnswer))
+	if err != nil {
+		return
+	}
+	if len(pac.Data()) < 4 {
+		err = errors.New("wrong clients number answer")
+		return
+	}
+	// Exclude this monitor client
+	n = int(binary.LittleEndian.Uint32(pac.Data())) - 1
+	return
+}
+
+// show print load report and save it in JSON format
+func (l *loadParams) show(r *loadReport) {
+	if l.json != "" {
+		data, _ := json.MarshalIndent(r, "", "  ")
+		data = append(data, '\n')
+		if l.json == "-" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(l.json, data, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, "load:", err)
+		}
+	}
+	fmt.Printf("load %s %s, %d clients, %.3f sec\n", r.Network, r.Remote,
+		r.Clients, r.Duration)
+	fmt.Printf("  connected: %d (%.1f%%)  connect attempts: %d  "+
+		"disconnects: %d\n", r.Connected, 100*r.SuccessRate, r.Attempts,
+		r.Disconnects)
+	if r.ServerClients != nil {
+		fmt.Printf("  server clients: %d  missing: %d\n", *r.ServerClients,
+			r.Clients-*r.ServerClients)
+	}
+	kinds := make([]string, 0, len(r.Messages))
+	for kind := range r.Messages {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		k := r.Messages[kind]
+		fmt.Printf("  %-5s sent: %d  answered: %d  lost: %d  errors: %d\n",
+			kind, k.Sent, k.Answered, k.Lost, k.Errors)
+		if k.Latency == nil {
+			continue
+		}
+		lt := k.Latency
+		fmt.Printf("        latency ms: min %.3f  p50 %.3f  p90 %.3f  "+
+			"p99 %.3f  max %.3f\n", lt.Min, lt.P50, lt.P90, lt.P99, lt.Max)
+		for _, b := range loadBucketNames() {
+			if n := lt.Histogram[b]; n > 0 {
+				fmt.Printf("        %8s ms %6d %s\n", b, n,
+					strings.Repeat("#", (n*40+lt.Samples-1)/lt.Samples))
+			}
+		}
+	}
+}
+
+// loadBucketNames return histogram buckets names
+func loadBucketNames() (names []string) {
+	for _, b := range loadBuckets {
+		names = append(names, "<="+strconv.FormatFloat(b, 'f', -1, 64))
+	}
+	return append(names, ">"+strconv.FormatFloat(loadBuckets[len(loadBuckets)-1],
+		'f', -1, 64))
+}
+
+// loadPercentiles return latency percentiles and histogram or nil if there
+// is not samples
+func loadPercentiles(latency []float64) *loadLatency {
+	if len(latency) == 0 {
+		return nil
+	}
+	sort.Float64s(latency)
+	p := func(p float64) float64 {
+		return latency[int(p*float64(len(latency)-1))]
+	}
+	names := loadBucketNames()
+	histogram := make(map[string]int)
+	for _, ms := range latency {
+		i := sort.SearchFloat64s(loadBuckets, ms)
+		histogram[names[i]]++
+	}
+	return &loadLatency{Samples: len(latency), Min: latency[0], P50: p(0.5),
+		P90: p(0.9), P99: p(0.99), Max: latency[len(latency)-1],
+		Histogram: histogram}
+}
@@ -2,137 +2,159 @@
 // Use of this source code is governed by a BSD-style license that can be
 // found in the LICENSE file.
 
-// This is main Teonet clietnt (teocli) sample application.
+// This is main Teonet clietnt (teocli) application: interactive shell to
+// connect to Teonet L0 server, send commands, watch incoming traffic and
+// measure echo latency.
 //
 // To use this application install Teonet client and Teonet server:
 //
-//  go get github.com/kirill-scherba/teonet-go/teocli/
-//  go get github.com/kirill-scherba/teonet-go/teonet/
+//	go get github.com/kirill-scherba/teonet-go/teocli/
+//	go get github.com/kirill-scherba/teonet-go/teonet/
 //
-// Run server application:
+// Run server application with L0 server:
 //
-//  \todo
+//	teonet -l0-allow teo-l0-srv
 //
-// Run this client application:
+// Run this client application and type help to show shell commands:
 //
-//  \todo
+//	teocli -n teocli-01 -a localhost -r 9010
 //
+// Connect to L0 server tcp port started with -l0-tls-cert and -l0-tls-key
+// flags:
+//
+//	teocli -n teocli-01 -tcp -tls -tls-ca ca.pem
+//
+// Run load test with 1000 clients started during 20 seconds:
+//
+//	teocli -n teocli-load -load 1000 -load-ramp 20s -load-peer ps-server
+//
+// Run commands from script file (one command per line, lines started with #
+// are comments), the teocli exits with error on first failed command:
+//
+//	teocli -n teocli-01 -script commands.txt
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
-	"strings"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/kirill-scherba/teonet-go/teocli/teocli"
 )
 
 func main() {
-	fmt.Println("Teocli test application ver " + teocli.Version)
 
 	// Flags variables
-	var name string      // this client name
-	var peer string      // remote server name (to send commands to)
-	var raddr string     // remote host address
-	var rport, rchan int // remote host port and channel (for TRUDP)
-	var timeout int      // send echo timeout (in microsecond)
-	var tcp bool         // connect by TCP flag
+	var name string     // this client name
+	var raddr string    // remote host address
+	var rport int       // remote host port
+	var ws string       // remote host websocket url
+	var script string   // script file name
+	var timeout int     // request timeout (in millisecond)
+	var tcp bool        // connect by TCP flag
+	var useTLS bool     // connect by TLS flag
+	var tlsCA string    // TLS CA certificate file
+	var insecure bool   // skip TLS certificate verification
+	var load loadParams // load mode parameters
 
 	// Flags
 	flag.StringVar(&name, "n", "teocli-go-main-test-01", "this application name")
-	flag.StringVar(&peer, "peer", "ps-server", "remote server name (to send commands to)")
 	flag.StringVar(&raddr, "a", "localhost", "remote host address (to connect to remote host)")
-	flag.IntVar(&rchan, "c", 0, "remote host channel (to connect to remote host TRUDP channel)")
 	flag.IntVar(&rport, "r", 9010, "remote host port (to connect to remote host)")
-	flag.IntVar(&timeout, "t", 1000000, "send echo timeout (in microsecond)")
+	flag.StringVar(&ws, "ws", "", "remote host websocket url (to connect by websocket)")
+	flag.StringVar(&script, "script", "", "execute commands from script file and exit")
+	flag.IntVar(&timeout, "t", 5000, "request and echo timeout (in millisecond)")
 	flag.BoolVar(&tcp, "tcp", false, "connect by TCP")
+	flag.BoolVar(&useTLS, "tls", false, "connect by TLS (with -tcp flag)")
+	flag.StringVar(&tlsCA, "tls-ca", "", "TLS CA certificate file to verify L0 server certificate (tls and wss connection)")
+	flag.BoolVar(&insecure, "tls-insecure", false, "skip L0 server TLS certificate verification (tls and wss connection)")
+	flag.IntVar(&load.clients, "load", 0, "load mode: number of simulated clients (login names are -n value with client number)")
+	flag.DurationVar(&load.ramp, "load-ramp", 10*time.Second, "load mode: time to start all clients")
+	flag.DurationVar(&load.duration, "load-duration", 30*time.Second, "load mode: duration after all clients started")
+	flag.DurationVar(&load.interval, "load-interval", time.Second, "load mode: each client messages interval")
+	flag.StringVar(&load.mix, "load-mix", "echo:80,peers:10,cmd:10", "load mode: messages mix, kind:weight list of echo, peers and cmd")
+	flag.StringVar(&load.peer, "load-peer", "ps-server", "load mode: target peer name")
+	flag.IntVar(&load.cmd, "load-cmd", 129, "load mode: user command number")
+	flag.IntVar(&load.answer, "load-answer", 0, "load mode: user command answer number (0 - does not wait answer)")
+	flag.IntVar(&load.size, "load-size", 64, "load mode: user command data size")
+	flag.StringVar(&load.server, "load-server", "", "load mode: L0 server peer name to request number of connected clients")
+	flag.StringVar(&load.json, "load-json", "", "load mode: save report in JSON format to file (- to stdout)")
 	flag.Parse()
 
-	for {
-		// Network to string
-		network := func() (network string) {
-			network = "trudp"
-			if tcp {
-				network = "tcp"
-			}
-			return
-		}
+	addr := raddr + ":" + strconv.Itoa(rport)
+	if ws != "" {
+		addr = ws
+	}
 
-		// Connect to L0 server
-		fmt.Printf("Try %s connecting to %s:%d ...\n", network(), raddr, rport)
-		teo, err := teocli.Connect(raddr, rport, tcp)
+	// TLS config
+	if useTLS || tlsCA != "" || insecure {
+		config, err := tlsConfig(tlsCA, insecure)
 		if err != nil {
 			fmt.Println(err)
-			time.Sleep(5 * time.Second)
-			continue
+			os.Exit(1)
 		}
-
-		// Send L0 login (requered after connect)
-		fmt.Printf("send login\n")
-		if _, err := teo.SendLogin(name); err != nil {
-			fmt.Println(err)
-			time.Sleep(5 * time.Second)
-			continue
+		if useTLS && !tcp {
+			fmt.Println("the -tls flag requires -tcp flag")
+			os.Exit(1)
 		}
+		load.tls = config
+	}
 
-		// Send peers command
-		fmt.Printf("send peers request\n")
-		teo.SendTo(peer, teocli.CmdLPeers, nil)
-
-		// Sender (send echo in loop)
-		running := true
-		go func() {
-			for i := 0; running; i++ {
-				switch {
-
-				// Send peers command
-				case i%9 == 1:
-					fmt.Printf("send peers request (%d,%d)\n", i, i%9)
-					teo.SendTo(peer, teocli.CmdLPeers, nil)
-
-				// Send large data packet with cmd 129
-				case i%19 == 1:
-					data := append([]byte(strings.Repeat("Q", 2000)), 0)
-					fmt.Printf("send large data packet with cmd 129, data_len: %d (%d,%d)\n",
-						len(data), i, i%19)
-					teo.SendTo(peer, 129, data)
+	// Load mode
+	if load.clients > 0 {
+		load.run(name, addr, tcp, time.Duration(timeout)*time.Millisecond)
+		return
+	}
+	sh := newShell(name, addr, tcp, load.tls,
+		time.Duration(timeout)*time.Millisecond, os.Stdout)
+	if err := sh.connect(nil); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-				// Send echo
-				default:
-					fmt.Printf("send echo %d\n", i)
-					teo.SendEcho(peer, fmt.Sprintf("Hello from Go(No %d)!", i))
+	// Execute script
+	if script != "" {
+		f, err := os.Open(script)
+		if err == nil {
+			err = sh.run(f, true)
+			f.Close()
+		}
+		sh.s.Close()
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-				}
-				time.Sleep(time.Duration(timeout) * time.Microsecond)
-			}
-		}()
+	// Interactive shell
+	fmt.Println("Teocli application ver " + teocli.Version +
+		", type help to show commands")
+	if err := sh.run(os.Stdin, false); err != nil {
+		fmt.Println(err)
+	}
+	if sh.s != nil {
+		sh.s.Close()
+	}
+}
 
-		// Reader (read data and display it)
-		for {
-			packet, err := teo.Read()
-			if err != nil {
-				fmt.Println(err)
-				break
-			}
-			fmt.Printf("got cmd %d from %s, data len: %d, data: %v\n",
-				packet.Command(), packet.From(), len(packet.Data()), packet.Data())
-			switch packet.Command() {
-			// Echo answer
-			case teocli.CmdLEchoAnswer:
-				if t, err := packet.Triptime(); err != nil {
-					fmt.Println("trip time error:", err)
-				} else {
-					fmt.Println("trip time (ms):", t)
-				}
-			// Peers answer
-			case teocli.CmdLPeersAnswer:
-				ln := strings.Repeat("-", 59)
-				fmt.Println("PeerAnswer received\n"+ln, "\n"+packet.Peers()+ln)
-			}
-		}
-		teo.Disconnect()
-		running = false
-		time.Sleep(5 * time.Second)
+// tlsConfig create TLS config with CA certificate from file
+func tlsConfig(caFile string, insecure bool) (config *tls.Config, err error) {
+	config = &tls.Config{InsecureSkipVerify: insecure}
+	if caFile == "" {
+		return
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		err = fmt.Errorf("can't read CA certificate from %s", caFile)
 	}
+	return
 }
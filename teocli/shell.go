@@ -0,0 +1,553 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Teocli shell commands: connect and login to L0 server, send commands with
+// text, JSON or hex payloads, requests, echo with latency statistic, peers,
+// subscribe and watch incoming traffic.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kirill-scherba/teonet-go/teocli/teocli"
+)
+
+// Teonet subscribe commands
+const (
+	cmdSubscribe       = 81 // Subscribe to peer event
+	cmdUnsubscribe     = 82 // Unsubscribe from peer event
+	cmdSubscribeAnswer = 83 // Subscribed event data
+)
+
+// errQuit returned by quit command
+var errQuit = errors.New("quit")
+
+// shellCommand is teocli shell command
+type shellCommand struct {
+	usage string                               // Command usage
+	help  string                               // Command description
+	nargs int                                  // Max number of arguments, the last one gets the rest of line
+	f     func(sh *shell, args []string) error // Command function
+}
+
+// shell is teocli shell
+type shell struct {
+	name     string          // Login name
+	addr     string          // L0 server address (host:port or websocket url)
+	tcp      bool            // Connect by TCP
+	tls      *tls.Config     // TLS config of tcp and wss connection (nil - TLS does not used)
+	timeout  time.Duration   // Request timeout
+	out      io.Writer       // Output
+	mx       sync.Mutex      // Output and watch mutex
+	watch    bool            // Print all received packets
+	s        *teocli.Session // L0 server session
+	commands map[string]shellCommand
+}
+
+// newShell create teocli shell
+func newShell(name, addr string, tcp bool, tlsConfig *tls.Config,
+	timeout time.Duration, out io.Writer) (sh *shell) {
+	sh = &shell{name: name, addr: addr, tcp: tcp, tls: tlsConfig,
+		timeout: timeout, out: out}
+	sh.commands = map[string]shellCommand{
+		"help": {"help", "show this help", 0, (*shell).help},
+		"connect": {"connect [host:port|ws://host:port/ws] [tcp|trudp]",
+			"connect to L0 server", 2, (*shell).connect},
+		"login": {"login <name>", "reconnect with new login name", 1,
+			(*shell).login},
+		"disconnect": {"disconnect", "disconnect from L0 server", 0,
+			(*shell).disconnect},
+		"status": {"status", "show connection state and session cookie", 0,
+			(*shell).status},
+		"send": {"send <peer> <cmd> [payload]", "send command to peer", 3,
+			(*shell).send},
+		"request": {"request <peer> <cmd> [payload]",
+			"send command and wait for answer command cmd+1", 3,
+			(*shell).request},
+		"echo": {"echo <peer> [count] [message]",
+			"send echo requests and show latency statistic", 3, (*shell).echo},
+		"peers": {"peers <peer>", "show peers of teonet peer", 1,
+			(*shell).peers},
+		"subscribe": {"subscribe <peer> <event>",
+			"subscribe to peer event, events data are printed", 2,
+			(*shell).subscribe},
+		"unsubscribe": {"unsubscribe <peer> <event>",
+			"unsubscribe from peer event", 2, (*shell).unsubscribe},
+		"watch": {"watch [on|off]", "print all received packets", 1,
+			(*shell).watchCmd},
+		"sleep": {"sleep <duration>", "wait duration (e.g. 500ms, 2s)", 1,
+			(*shell).sleep},
+		"quit": {"quit", "exit teocli", 0,
+			func(*shell, []string) error { return errQuit }},
+	}
+	return
+}
+
+// printf print to shell output
+func (sh *shell) printf(format string, a ...interface{}) {
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+	fmt.Fprintf(sh.out, format, a...)
+}
+
+// run read and execute commands from reader. In script mode it stops and
+// return error on first command error.
+func (sh *shell) run(r io.Reader, script bool) (err error) {
+	scanner := bufio.NewScanner(r)
+	for {
+		if !script {
+			sh.printf("teocli> ")
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if script {
+			sh.printf("> %s\n", line)
+		}
+		switch err = sh.exec(line); {
+		case err == errQuit:
+			return nil
+		case err != nil && script:
+			return
+		case err != nil:
+			sh.printf("error: %s\n", err)
+		}
+	}
+}
+
+// exec execute one command line
+func (sh *shell) exec(line string) error {
+	args := strings.Fields(line)
+	com, ok := sh.commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command '%s', type help to show commands",
+			args[0])
+	}
+	n := len(args)
+	if n > com.nargs+1 {
+		n = com.nargs + 1
+	}
+	return com.f(sh, splitArgs(line, n))
+}
+
+// splitArgs split command line to n fields and return command arguments, the
+// last argument is the rest of line (payload may contain spaces)
+func splitArgs(line string, n int) (args []string) {
+	for i := 0; i < n; i++ {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if i == n-1 {
+			args = append(args, line)
+			break
+		}
+		l := strings.IndexFunc(line, unicode.IsSpace)
+		args = append(args, line[:l])
+		line = line[l:]
+	}
+	return args[1:]
+}
+
+// help show commands usage
+func (sh *shell) help(args []string) error {
+	names := make([]string, 0, len(sh.commands))
+	for name := range sh.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		com := sh.commands[name]
+		sh.printf("  %-52s %s\n", com.usage, com.help)
+	}
+	sh.printf("\npayload: text, \"quoted text\", JSON object or array, " +
+		"json:<json> or hex:<hex bytes>;\ntext and JSON are sent with " +
+		"trailing zero\n")
+	return nil
+}
+
+// connect create new session and connect to L0 server
+func (sh *shell) connect(args []string) (err error) {
+	switch len(args) {
+	case 2:
+		switch args[1] {
+		case "tcp":
+			sh.tcp = true
+		case "trudp":
+			sh.tcp = false
+		default:
+			return errors.New("wrong network, should be tcp or trudp")
+		}
+		fallthrough
+	case 1:
+		sh.addr = args[0]
+	}
+	if sh.s != nil {
+		sh.s.Close()
+	}
+	config := teocli.SessionConfig{OnState: func(state teocli.State, err error) {
+		if err != nil {
+			sh.printf("%s: %s\n", state, err)
+			return
+		}
+		sh.printf("%s\n", state)
+	}}
+	if sh.s, err = newSession(sh.name, sh.addr, sh.tcp, config,
+		sh.tls); err != nil {
+		return
+	}
+	for cmd := 0; cmd <= math.MaxUint8; cmd++ {
+		sh.s.Handle(byte(cmd), sh.received)
+	}
+	sh.s.Start()
+	return
+}
+
+// newSession create L0 server session, the addr is host:port or websocket
+// url
+func newSession(name, addr string, tcp bool,
+	opts ...interface{}) (*teocli.Session, error) {
+	if isWebsocket(addr) {
+		return teocli.NewSessionWS(name, addr, opts...), nil
+	}
+	host, port, err := splitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	return teocli.NewSession(name, host, port, tcp, opts...), nil
+}
+
+// isWebsocket return true if addr is websocket url
+func isWebsocket(addr string) bool {
+	return strings.HasPrefix(addr, "ws://") || strings.HasPrefix(addr, "wss://")
+}
+
+// splitHostPort split L0 server address to host and port
+func splitHostPort(addr string) (host string, port int, err error) {
+	l := strings.LastIndex(addr, ":")
+	if l < 0 {
+		err = errors.New("wrong address, should be host:port")
+		return
+	}
+	host = addr[:l]
+	port, err = strconv.Atoi(addr[l+1:])
+	return
+}
+
+// session return connected session
+func (sh *shell) session() (*teocli.Session, error) {
+	if sh.s == nil {
+		return nil, errors.New("not connected, use connect command")
+	}
+	return sh.s, nil
+}
+
+// login reconnect with new login name
+func (sh *shell) login(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: login <name>")
+	}
+	sh.name = args[0]
+	return sh.connect(nil)
+}
+
+// disconnect from L0 server
+func (sh *shell) disconnect(args []string) (err error) {
+	s, err := sh.session()
+	if err != nil {
+		return
+	}
+	sh.s = nil
+	return s.Close()
+}
+
+// status show connection state
+func (sh *shell) status(args []string) (err error) {
+	s, err := sh.session()
+	if err != nil {
+		return
+	}
+	sh.printf("%s %s, login: %s, cookie: %s\n", s.State(), sh.addr, sh.name,
+		s.Cookie())
+	return
+}
+
+// parseCmd parse peer, command number and payload arguments
+func parseCmd(args []string) (peer string, cmd byte, data []byte, err error) {
+	if len(args) < 2 {
+		err = errors.New("peer and command should be set")
+		return
+	}
+	peer = args[0]
+	c, err := strconv.ParseUint(args[1], 10, 8)
+	if err != nil {
+		err = fmt.Errorf("wrong command number '%s'", args[1])
+		return
+	}
+	cmd = byte(c)
+	if len(args) > 2 {
+		data, err = parsePayload(args[2])
+	}
+	return
+}
+
+// parsePayload parse text, JSON or hex payload. Text and JSON payloads get
+// trailing zero.
+func parsePayload(payload string) (data []byte, err error) {
+	switch {
+	case payload == "":
+		return
+	case strings.HasPrefix(payload, "hex:"):
+		return hex.DecodeString(strings.Join(strings.Fields(payload[4:]), ""))
+	case strings.HasPrefix(payload, "json:"):
+		payload = strings.TrimSpace(payload[5:])
+		if !json.Valid([]byte(payload)) {
+			err = errors.New("wrong JSON payload")
+			return
+		}
+	case payload[0] == '{' || payload[0] == '[':
+		if !json.Valid([]byte(payload)) {
+			err = errors.New("wrong JSON payload")
+			return
+		}
+	case payload[0] == '"':
+		if payload, err = strconv.Unquote(payload); err != nil {
+			return
+		}
+	}
+	return append([]byte(payload), 0), nil
+}
+
+// formatData return packet data as text if it is printable or as hex
+func formatData(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	text := strings.TrimSuffix(string(data), "\x00")
+	if utf8.ValidString(text) && strings.IndexFunc(text, func(r rune) bool {
+		return !unicode.IsPrint(r) && !unicode.IsSpace(r)
+	}) < 0 {
+		return text
+	}
+	return "hex:" + hex.EncodeToString(data)
+}
+
+// received print received packets
+func (sh *shell) received(pac *teocli.Packet) {
+	sh.mx.Lock()
+	watch := sh.watch
+	sh.mx.Unlock()
+	switch {
+	case pac.Command() == cmdSubscribeAnswer:
+		data := pac.Data()
+		if len(data) < 3 {
+			break
+		}
+		sh.printf("event %d from %s, cmd: %d, data: %s\n",
+			binary.LittleEndian.Uint16(data), pac.From(), data[2],
+			formatData(data[3:]))
+	case watch:
+		sh.printf("got cmd %d from %s, data len %d: %s\n", pac.Command(),
+			pac.From(), len(pac.Data()), formatData(pac.Data()))
+	}
+}
+
+// send command to peer
+func (sh *shell) send(args []string) (err error) {
+	s, err := sh.session()
+	if err != nil {
+		return
+	}
+	peer, cmd, data, err := parseCmd(args)
+	if err != nil {
+		return
+	}
+	_, err = s.SendTo(peer, cmd, data)
+	return
+}
+
+// request send command to peer and wait for answer
+func (sh *shell) request(args []string) (err error) {
+	s, err := sh.session()
+	if err != nil {
+		return
+	}
+	peer, cmd, data, err := parseCmd(args)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sh.timeout)
+	defer cancel()
+	t := time.Now()
+	pac, err := s.Request(ctx, peer, cmd, data)
+	if err != nil {
+		return
+	}
+	sh.printf("answer cmd %d from %s in %.3f ms, data len %d: %s\n",
+		pac.Command(), pac.From(), float64(time.Since(t))/float64(time.Millisecond),
+		len(pac.Data()), formatData(pac.Data()))
+	return
+}
+
+// echo send echo requests and show latency statistic
+func (sh *shell) echo(args []string) (err error) {
+	s, err := sh.session()
+	if err != nil {
+		return
+	}
+	if len(args) < 1 {
+		return errors.New("usage: echo <peer> [count] [message]")
+	}
+	peer, count, msg := args[0], 1, "Hello from teocli!"
+	if len(args) > 1 {
+		if count, err = strconv.Atoi(args[1]); err != nil || count < 1 {
+			return errors.New("wrong echo count")
+		}
+	}
+	if len(args) > 2 {
+		msg = args[2]
+	}
+	var rtt []float64
+	for i := 0; i < count; i++ {
+		data := make([]byte, len(msg)+1+8)
+		copy(data, msg)
+		t := time.Now()
+		binary.LittleEndian.PutUint64(data[len(msg)+1:],
+			uint64(t.UnixNano()/int64(time.Millisecond)))
+		ctx, cancel := context.WithTimeout(context.Background(), sh.timeout)
+		_, err := s.Request(ctx, peer, teocli.CmdLEcho, data,
+			teocli.AnswerCmd(teocli.CmdLEchoAnswer))
+		cancel()
+		if err != nil {
+			sh.printf("echo %d: %s\n", i+1, err)
+			continue
+		}
+		ms := float64(time.Since(t)) / float64(time.Millisecond)
+		rtt = append(rtt, ms)
+		sh.printf("echo %d from %s: time=%.3f ms\n", i+1, peer, ms)
+	}
+	sh.printf("%s", echoStatistic(count, rtt))
+	return
+}
+
+// echoStatistic return echo latency statistic
+func echoStatistic(sent int, rtt []float64) string {
+	s := fmt.Sprintf("%d sent, %d received, %.1f%% loss\n", sent, len(rtt),
+		100*float64(sent-len(rtt))/float64(sent))
+	if len(rtt) == 0 {
+		return s
+	}
+	min, max, sum := rtt[0], rtt[0], 0.0
+	for _, v := range rtt {
+		min, max, sum = math.Min(min, v), math.Max(max, v), sum+v
+	}
+	avg := sum / float64(len(rtt))
+	var dev float64
+	for _, v := range rtt {
+		dev += (v - avg) * (v - avg)
+	}
+	dev = math.Sqrt(dev / float64(len(rtt)))
+	return s + fmt.Sprintf("rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n",
+		min, avg, max, dev)
+}
+
+// peers request and show peers of teonet peer
+func (sh *shell) peers(args []string) (err error) {
+	s, err := sh.session()
+	if err != nil {
+		return
+	}
+	if len(args) != 1 {
+		return errors.New("usage: peers <peer>")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sh.timeout)
+	defer cancel()
+	pac, err := s.Request(ctx, args[0], teocli.CmdLPeers, nil,
+		teocli.AnswerCmd(teocli.CmdLPeersAnswer))
+	if err != nil {
+		return
+	}
+	ln := strings.Repeat("-", 59)
+	sh.printf("%d peers of %s\n%s\n%s%s\n", pac.PeersLength(), pac.From(), ln,
+		pac.Peers(), ln)
+	return
+}
+
+// subscribeCmd send subscribe or unsubscribe command with event number
+func (sh *shell) subscribeCmd(cmd byte, args []string) (err error) {
+	s, err := sh.session()
+	if err != nil {
+		return
+	}
+	if len(args) != 2 {
+		return errors.New("peer and event should be set")
+	}
+	ev, err := strconv.ParseUint(args[1], 10, 16)
+	if err != nil {
+		return fmt.Errorf("wrong event number '%s'", args[1])
+	}
+	data := make([]byte, 2)
+	binary.LittleEndian.PutUint16(data, uint16(ev))
+	_, err = s.SendTo(args[0], cmd, data)
+	return
+}
+
+// subscribe to peer event
+func (sh *shell) subscribe(args []string) error {
+	return sh.subscribeCmd(cmdSubscribe, args)
+}
+
+// unsubscribe from peer event
+func (sh *shell) unsubscribe(args []string) error {
+	return sh.subscribeCmd(cmdUnsubscribe, args)
+}
+
+// watchCmd switch print all received packets
+func (sh *shell) watchCmd(args []string) error {
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+	switch {
+	case len(args) == 0:
+		sh.watch = !sh.watch
+	case args[0] == "on":
+		sh.watch = true
+	case args[0] == "off":
+		sh.watch = false
+	default:
+		return errors.New("usage: watch [on|off]")
+	}
+	fmt.Fprintf(sh.out, "watch %v\n", sh.watch)
+	return nil
+}
+
+// sleep wait duration
+func (sh *shell) sleep(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: sleep <duration>")
+	}
+	d, err := time.ParseDuration(args[0])
+	if err != nil {
+		return err
+	}
+	time.Sleep(d)
+	return nil
+}
@@ -6,13 +6,58 @@
 
 package teocli
 
-// #cgo CFLAGS: -g -Wall
-// #include "packet.h"
-import "C"
-
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
-	"unsafe"
+	"fmt"
+	"math"
+	"time"
+)
+
+// L0 client packet structure (little endian):
+//
+//	uint8_t  cmd              // Command
+//	uint8_t  peer_name_length // To peer name length (include leading zero)
+//	uint16_t data_length      // Packet data length
+//	uint8_t  reserved_1       // Reserved 1
+//	uint8_t  reserved_2       // Reserved 2
+//	uint8_t  checksum         // Whole checksum
+//	uint8_t  header_checksum  // Header checksum
+//	char     peer_name[]      // To/From peer name (include leading zero) + packet data
+const (
+	headerLen      = 8                  // L0 packet header length
+	headerChecksum = headerLen - 1      // Header checksum position
+	checksumPos    = headerChecksum - 1 // Whole checksum position
+	peerNameLenPos = 1                  // Peer name length position
+	dataLenPos     = 2                  // Data length position
+	maxPeerNameLen = math.MaxUint8 - 1  // Max peer name length
+	maxDataLen     = math.MaxUint16     // Max packet data length
+	echoTimeLen    = 8                  // Echo data time length
+)
+
+// Peer data structure (C ksnet_arp_data structure with peer name before it):
+//
+//	char    name[48]         // Peer name
+//	int16_t mode             // Peers mode
+//	char    addr[48]         // Peer IP address
+//	int16_t port             // Peer port
+//	double  last_activity    // Last time received data from peer (8 bytes aligned)
+//	double  last_triptime_send
+//	double  last_triptime_got
+//	double  last_triptime    // Last triptime
+//	double  triptime         // Middle triptime
+//	double  monitor_time
+//	double  connected_time
+const (
+	arpTableIPSize  = 48                          // Peer name and address length
+	arpModePos      = arpTableIPSize              // Peer mode position
+	arpAddrPos      = arpModePos + 2              // Peer address position
+	arpPortPos      = arpAddrPos + arpTableIPSize // Peer port position
+	arpTriptimePos  = arpTableIPSize + 80         // Peer last triptime position
+	peerDataLen     = arpTableIPSize + 112        // Peer data length
+	peersLengthSize = 4                           // Number of peers length in peers answer
 )
 
 // Packet is teocli packet data structure and container for methods
@@ -27,12 +72,12 @@ func (teocli *TeoLNull) NewPacket(packet []byte) *Packet {
 
 // Command return packets peer name
 func (pac *Packet) Command() byte {
-	return byte(C.packetGetCommand(unsafe.Pointer(&pac.packet[0])))
+	return pac.packet[0]
 }
 
 // Name return packets peer name
 func (pac *Packet) Name() string {
-	return C.GoString(C.packetGetPeerName(unsafe.Pointer(&pac.packet[0])))
+	return goString(pac.packet[headerLen : headerLen+pac.peerNameLen()])
 }
 
 // From return packets peer name (sinonim for Name nethod)
@@ -42,40 +87,162 @@ func (pac *Packet) From() string {
 
 // Data return packets data
 func (pac *Packet) Data() []byte {
-	packetPtr := unsafe.Pointer(&pac.packet[0])
-	dataC := C.packetGetData(packetPtr)
-	dataLength := C.packetGetDataLength(packetPtr)
-	return (*[1 << 28]byte)(unsafe.Pointer(dataC))[:dataLength:dataLength]
+	ptr := headerLen + pac.peerNameLen()
+	return pac.packet[ptr : ptr+pac.dataLen() : ptr+pac.dataLen()]
+}
+
+// peerNameLen return packets peer name length
+func (pac *Packet) peerNameLen() int {
+	return int(pac.packet[peerNameLenPos])
+}
+
+// dataLen return packets data length
+func (pac *Packet) dataLen() int {
+	return int(binary.LittleEndian.Uint16(pac.packet[dataLenPos:]))
 }
 
 // Triptime return triptime for echo answer packet
 func (pac *Packet) Triptime() (t int64, err error) {
-	packetPtr := unsafe.Pointer(&pac.packet[0])
-	command := C.packetGetCommand(packetPtr)
-	if command != C.CMD_L_ECHO_ANSWER {
+	if pac.Command() != CmdLEchoAnswer {
 		err = errors.New("wrong packet command number")
 		return
 	}
-	dataC := C.packetGetData(packetPtr)
-	t = int64(C.teoLNullProccessEchoAnswer(dataC))
+	data := pac.Data()
+	ptr := bytes.IndexByte(data, 0) + 1
+	if ptr == 0 || len(data) < ptr+echoTimeLen {
+		err = errors.New("wrong echo answer data length")
+		return
+	}
+	t = currentTime() - int64(binary.LittleEndian.Uint64(data[ptr:]))
 	return
 }
 
 // PeersLength return number of peers in peerAnswer packet
 func (pac *Packet) PeersLength() int {
-	dataPtr := unsafe.Pointer(&pac.Data()[0])
-	arpDataAr := (*C.ksnet_arp_data_ar)(dataPtr)
-	return int(arpDataAr.length)
+	if peers, ok := pac.peersJSON(); ok {
+		return peers.Length
+	}
+	data := pac.Data()
+	if len(data) < peersLengthSize {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(data))
 }
 
 // Peers return string representation of peerAnswer packet
 func (pac *Packet) Peers() string {
-	if len(pac.Data()) == 0 {
-		return ""
+	peers, ok := pac.peersJSON()
+	if !ok {
+		data := pac.Data()
+		l := pac.PeersLength()
+		for i := 0; i < l; i++ {
+			ptr := peersLengthSize + i*PeerDataLength()
+			if len(data) < ptr+PeerDataLength() {
+				break
+			}
+			var p peerJSON
+			p.Mode, p.Name, p.Addr, p.Port, p.Triptime = ParsePeerData(data[ptr:])
+			peers.PeersAr = append(peers.PeersAr, p)
+		}
+	}
+	var buf bytes.Buffer
+	for i, p := range peers.PeersAr {
+		fmt.Fprintf(&buf, "%3d %-12s(%2d)   %-15s   %d %8.3f ms\n", i+1,
+			p.Name, p.Mode, p.Addr, p.Port, p.Triptime)
+	}
+	return buf.String()
+}
+
+// peerJSON is peer data in JSON format (websocket peers answer)
+type peerJSON struct {
+	Name     string  `json:"name"`
+	Mode     int     `json:"mode"`
+	Addr     string  `json:"addr"`
+	Port     int     `json:"port"`
+	Triptime float32 `json:"triptime"`
+}
+
+// peersJSON is peers answer in JSON format
+type peersJSON struct {
+	Length  int        `json:"length"`
+	PeersAr []peerJSON `json:"arp_data_ar"`
+}
+
+// peersJSON parse peers answer in JSON format, it returns false if packet
+// data is not JSON
+func (pac *Packet) peersJSON() (peers peersJSON, ok bool) {
+	data := bytes.TrimRight(pac.Data(), "\x00")
+	if len(data) == 0 || data[0] != '{' {
+		return
 	}
-	dataPtr := unsafe.Pointer(&pac.Data()[0])
-	arpDataAr := (*C.ksnet_arp_data_ar)(dataPtr)
-	buf := C.arp_data_print(arpDataAr)
-	defer C.free(unsafe.Pointer(buf))
-	return C.GoString(buf)
+	ok = json.Unmarshal(data, &peers) == nil
+	return
+}
+
+// checksum calculate byte checksum of data buffer
+func checksum(data []byte) (checksum uint8) {
+	for _, b := range data {
+		checksum += b
+	}
+	return
+}
+
+// packetCreate create L0 client packet
+func packetCreate(command uint8, peer string, data []byte) (packet []byte,
+	err error) {
+	if len(peer) > maxPeerNameLen {
+		err = fmt.Errorf("can't create packet: peer name length %d too large",
+			len(peer))
+		return
+	}
+	if len(data) > maxDataLen {
+		err = fmt.Errorf("can't create packet: data length %d too large",
+			len(data))
+		return
+	}
+	packet = make([]byte, headerLen, headerLen+len(peer)+1+len(data))
+	packet[0] = command
+	packet[peerNameLenPos] = uint8(len(peer) + 1)
+	binary.LittleEndian.PutUint16(packet[dataLenPos:], uint16(len(data)))
+	packet = append(packet, peer...)
+	packet = append(packet, 0)
+	packet = append(packet, data...)
+	packet[checksumPos] = checksum(packet[headerLen:])
+	packet[headerChecksum] = checksum(packet[:headerChecksum])
+	return
+}
+
+// packetCheck check packet length and checksums, return values:
+//
+//	 0 - valid packet
+//	 1 - wrong packet checksum
+//	-1 - wrong packet size (or first part of splitted packet)
+//	-2 - packet less than header (it may be first or next part of splitted packet)
+//	-3 - wrong header checksum (it may be next part of splitted packet)
+func packetCheck(packet []byte) int {
+	if len(packet) <= headerLen {
+		return -2
+	}
+	if packet[headerChecksum] != checksum(packet[:headerChecksum]) {
+		return -3
+	}
+	l := packetLength(packet)
+	if len(packet) < l {
+		return -1
+	}
+	if packet[checksumPos] != checksum(packet[headerLen:l]) {
+		return 1
+	}
+	return 0
+}
+
+// packetLength return packet length calculated from packet header
+func packetLength(packet []byte) int {
+	pac := &Packet{packet}
+	return headerLen + pac.peerNameLen() + pac.dataLen()
+}
+
+// currentTime return current time in milliseconds
+func currentTime() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
 }
@@ -0,0 +1,176 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Request module of teocli package: session background reader, commands
+// handlers registry and requests waiting for answers.
+
+package teocli
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+)
+
+// AnswerCmd is the Request option which sets answer command. By default
+// the answer command is the request command + 1.
+type AnswerCmd byte
+
+// ReqID is the Request option which sets request ID: the answer should
+// contain the same request ID in first 4 bytes of data (little endian
+// uint32). Use Session.NewReqID to get new request ID.
+type ReqID uint32
+
+// reqIDLen is request ID length in request and answer data
+const reqIDLen = 4
+
+// HandlerFunc process packet received by session background reader
+type HandlerFunc func(pac *Packet)
+
+// request is request waiting for answer
+type request struct {
+	peer  string            // Answer from peer
+	cmd   byte              // Answer command
+	check func([]byte) bool // Check answer data (may be nil)
+	ch    chan *Packet      // Answer channel
+}
+
+// requests is session handlers and requests waiting for answers
+type requests struct {
+	sync.RWMutex
+	handlers map[byte]HandlerFunc // Commands handlers
+	list     []*request           // Requests waiting for answers
+	once     sync.Once            // Start background reader once
+	reqID    uint32               // Last request ID (atomic)
+}
+
+// Handle register handler function for command, the nil function removes
+// command handler. Packets received by background reader are processed by
+// the command handler or dropped if it does not registered. Handlers are
+// executed in background reader goroutine so they should not wait for
+// Request answer.
+func (s *Session) Handle(cmd byte, f HandlerFunc) {
+	s.rq.Lock()
+	defer s.rq.Unlock()
+	if s.rq.handlers == nil {
+		s.rq.handlers = make(map[byte]HandlerFunc)
+	}
+	if f == nil {
+		delete(s.rq.handlers, cmd)
+		return
+	}
+	s.rq.handlers[cmd] = f
+}
+
+// Start start background reader which reads packets and sends them to
+// requests and commands handlers. Register handlers before Start. The Read
+// should not be used after Start. The Request starts background reader if
+// it was not started.
+func (s *Session) Start() {
+	s.rq.once.Do(func() { go s.reader() })
+}
+
+// Done return channel which closed when session closed
+func (s *Session) Done() <-chan struct{} {
+	return s.closed
+}
+
+// NewReqID return new request ID to use in Request data and ReqID option
+func (s *Session) NewReqID() uint32 {
+	return atomic.AddUint32(&s.rq.reqID, 1)
+}
+
+// Request send request to peer and wait answer. The answer is packet from
+// the peer with command cmd + 1. The options are:
+//
+//	AnswerCmd         - answer command
+//	ReqID             - request ID in first 4 bytes of answer data
+//	func([]byte) bool - function to check answer data
+//
+// The request waits for answer while ctx done or session closed, the
+// request sent while offline is sent after session connected.
+func (s *Session) Request(ctx context.Context, peer string, cmd byte,
+	data []byte, opts ...interface{}) (pac *Packet, err error) {
+
+	r := &request{peer: peer, cmd: cmd + 1, ch: make(chan *Packet, 1)}
+	for _, opt := range opts {
+		switch v := opt.(type) {
+		case AnswerCmd:
+			r.cmd = byte(v)
+		case ReqID:
+			r.check = func(data []byte) bool {
+				return len(data) >= reqIDLen &&
+					binary.LittleEndian.Uint32(data) == uint32(v)
+			}
+		case func([]byte) bool:
+			r.check = v
+		}
+	}
+	s.Start()
+	s.rq.Lock()
+	s.rq.list = append(s.rq.list, r)
+	s.rq.Unlock()
+	defer s.removeRequest(r)
+
+	if _, err = s.SendTo(peer, cmd, data); err != nil {
+		return
+	}
+	select {
+	case pac = <-r.ch:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-s.closed:
+		err = ErrSessionClosed
+	}
+	return
+}
+
+// removeRequest remove request from requests waiting for answers
+func (s *Session) removeRequest(r *request) {
+	s.rq.Lock()
+	defer s.rq.Unlock()
+	for i := range s.rq.list {
+		if s.rq.list[i] == r {
+			s.rq.list = append(s.rq.list[:i], s.rq.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// answer send packet to first request waiting for it, it returns false if
+// there is not request waiting for this packet
+func (s *Session) answer(pac *Packet) bool {
+	s.rq.Lock()
+	defer s.rq.Unlock()
+	for i, r := range s.rq.list {
+		if r.cmd != pac.Command() || r.peer != pac.From() ||
+			r.check != nil && !r.check(pac.Data()) {
+			continue
+		}
+		s.rq.list = append(s.rq.list[:i], s.rq.list[i+1:]...)
+		r.ch <- pac
+		return true
+	}
+	return false
+}
+
+// reader read packets and process them while session is not closed
+func (s *Session) reader() {
+	for {
+		pac, err := s.Read()
+		if err != nil {
+			return
+		}
+		if s.answer(pac) {
+			continue
+		}
+		s.rq.RLock()
+		f := s.rq.handlers[pac.Command()]
+		s.rq.RUnlock()
+		if f != nil {
+			f(pac)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Session module of teocli package: resilient L0 server connection. The
+// session reconnects when disconnected, login with session cookie received
+// from users registrar to resume the same client identity, buffers packets
+// sent while offline and reports connection state changes.
+
+package teocli
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+)
+
+// State is session connection state
+type State int
+
+// Session connection states
+const (
+	StateDisconnected State = iota // Disconnected from L0 server
+	StateConnecting                // Connecting and login to L0 server
+	StateConnected                 // Connected and logged in
+	StateClosed                    // Session closed
+)
+
+// String return state name
+func (state State) String() string {
+	switch state {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// cmdCookie is the users registrar login answer command sent by L0 server,
+// the command data is session cookie
+const cmdCookie = 129
+
+// Session defaults
+const (
+	defaultReconnect = 5 * time.Second
+	defaultQueueSize = 256
+)
+
+var (
+	// ErrSessionClosed returned by session methods after Close
+	ErrSessionClosed = errors.New("session closed")
+
+	// ErrQueueFull returned when packet sent while offline and offline send
+	// queue is full
+	ErrQueueFull = errors.New("offline send queue is full")
+)
+
+// SessionConfig is the NewSession option which sets session reconnect,
+// offline queue and cookie parameters. Zero fields get default values.
+type SessionConfig struct {
+	Reconnect  time.Duration                // Reconnect timeout (default 5s)
+	QueueSize  int                          // Max number of packets buffered while offline (default 256)
+	CookieFile string                       // File to save session cookie (default cookie is not saved)
+	OnState    func(state State, err error) // Connection state change callback
+}
+
+// Session is resilient L0 server connection
+type Session struct {
+	name    string                    // Login name
+	connect func() (*TeoLNull, error) // Connect to L0 server
+	cfg     SessionConfig             // Session configuration
+	mx      sync.Mutex                // Session data mutex
+	teo     *TeoLNull                 // Current connection (nil if disconnected)
+	state   State                     // Connection state
+	cookie  string                    // Session cookie
+	queue   [][]byte                  // Packets sent while offline
+	closed  chan struct{}             // Closed when session closed
+	rq      requests                  // Handlers and requests waiting for answers
+}
+
+// NewSession create L0 server session. The session connects in the first
+// Read call. The options are SessionConfig and Connect options.
+func NewSession(name, addr string, port int, tcp bool,
+	opts ...interface{}) *Session {
+	return newSession(name, opts, func(opts ...interface{}) (*TeoLNull, error) {
+		return Connect(addr, port, tcp, opts...)
+	})
+}
+
+// NewSessionWS create L0 server websocket session. The session connects in
+// the first Read call. The options are SessionConfig and ConnectWS options.
+func NewSessionWS(name, url string, opts ...interface{}) *Session {
+	return newSession(name, opts, func(opts ...interface{}) (*TeoLNull, error) {
+		return ConnectWS(url, opts...)
+	})
+}
+
+// newSession create session and parse its options
+func newSession(name string, opts []interface{},
+	connect func(opts ...interface{}) (*TeoLNull, error)) (s *Session) {
+	s = &Session{name: name, closed: make(chan struct{})}
+	var connectOpts []interface{}
+	for _, opt := range opts {
+		switch v := opt.(type) {
+		case SessionConfig:
+			s.cfg = v
+		default:
+			connectOpts = append(connectOpts, opt)
+		}
+	}
+	if s.cfg.Reconnect <= 0 {
+		s.cfg.Reconnect = defaultReconnect
+	}
+	if s.cfg.QueueSize <= 0 {
+		s.cfg.QueueSize = defaultQueueSize
+	}
+	if s.cfg.CookieFile != "" {
+		s.cookie = readCookie(s.cfg.CookieFile)
+	}
+	s.connect = func() (*TeoLNull, error) { return connect(connectOpts...) }
+	return
+}
+
+// State return session connection state
+func (s *Session) State() State {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.state
+}
+
+// Cookie return session cookie or empty string if cookie was not received
+func (s *Session) Cookie() string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.cookie
+}
+
+// Conn return current L0 server connection or nil if disconnected
+func (s *Session) Conn() *TeoLNull {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.teo
+}
+
+// login return login name: session cookie or session name
+func (s *Session) login() string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.cookie != "" {
+		return s.cookie
+	}
+	return s.name
+}
+
+// setState set session state and execute state change callback
+func (s *Session) setState(state State, err error) {
+	s.mx.Lock()
+	if s.state == StateClosed {
+		s.mx.Unlock()
+		return
+	}
+	s.state = state
+	s.mx.Unlock()
+	s.onState(state, err)
+}
+
+// onState execute state change callback
+func (s *Session) onState(state State, err error) {
+	if s.cfg.OnState != nil {
+		s.cfg.OnState(state, err)
+	}
+}
+
+// Read wait for packet received from L0 server. The Read connects to L0
+// server and reconnects after Reconnect timeout when disconnected, so it
+// returns error only when session closed. It should be called in loop to
+// keep session connected.
+func (s *Session) Read() (pac *Packet, err error) {
+	for {
+		var teo *TeoLNull
+		if teo, err = s.connection(); err != nil {
+			return
+		}
+		if pac, err = teo.Read(); err == nil {
+			s.checkCookie(pac)
+			return
+		}
+		s.disconnected(teo, err)
+	}
+}
+
+// connection return current connection or connect to L0 server
+func (s *Session) connection() (teo *TeoLNull, err error) {
+	for {
+		s.mx.Lock()
+		closed := s.state == StateClosed
+		teo = s.teo
+		s.mx.Unlock()
+		switch {
+		case closed:
+			return nil, ErrSessionClosed
+		case teo != nil:
+			return
+		}
+		if err = s.dial(); err == nil {
+			continue
+		}
+		s.setState(StateDisconnected, err)
+		select {
+		case <-time.After(s.cfg.Reconnect):
+		case <-s.closed:
+		}
+	}
+}
+
+// dial connect and login to L0 server and send packets buffered while
+// offline
+func (s *Session) dial() (err error) {
+	s.setState(StateConnecting, nil)
+	teo, err := s.connect()
+	if err != nil {
+		if teo != nil {
+			teo.Disconnect()
+		}
+		return
+	}
+	if _, err = teo.SendLogin(s.login()); err != nil {
+		teo.Disconnect()
+		return
+	}
+	s.mx.Lock()
+	if s.state == StateClosed {
+		s.mx.Unlock()
+		teo.Disconnect()
+		return ErrSessionClosed
+	}
+	for ; len(s.queue) > 0; s.queue = s.queue[1:] {
+		if _, err = teo.send(s.queue[0]); err != nil {
+			s.mx.Unlock()
+			teo.Disconnect()
+			return
+		}
+	}
+	s.teo, s.state = teo, StateConnected
+	s.mx.Unlock()
+	s.onState(StateConnected, nil)
+	return
+}
+
+// disconnected close broken connection
+func (s *Session) disconnected(teo *TeoLNull, err error) {
+	s.mx.Lock()
+	if s.teo != teo {
+		s.mx.Unlock()
+		return
+	}
+	s.teo = nil
+	s.mx.Unlock()
+	teo.Disconnect()
+	s.setState(StateDisconnected, err)
+}
+
+// checkCookie save session cookie received from users registrar
+func (s *Session) checkCookie(pac *Packet) {
+	if pac.Command() != cmdCookie || pac.From() != "" {
+		return
+	}
+	cookie := string(bytes.TrimRight(pac.Data(), "\x00"))
+	if cookie == "" {
+		return
+	}
+	s.mx.Lock()
+	s.cookie = cookie
+	s.mx.Unlock()
+	if s.cfg.CookieFile != "" {
+		writeCookie(s.cfg.CookieFile, cookie)
+	}
+}
+
+// send packet to L0 server or buffer it while offline
+func (s *Session) send(packet []byte) (length int, err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.state == StateClosed {
+		err = ErrSessionClosed
+		return
+	}
+	if s.teo != nil {
+		if length, err = s.teo.send(packet); err == nil {
+			return
+		}
+	}
+	if len(s.queue) >= s.cfg.QueueSize {
+		return 0, ErrQueueFull
+	}
+	s.queue = append(s.queue, packet)
+	return len(packet), nil
+}
+
+// SendTo sends data packet to teonet peer. The packet is buffered and sent
+// after connection when session is offline.
+func (s *Session) SendTo(peer string, command byte, data []byte) (int, error) {
+	packet, err := packetCreate(command, peer, data)
+	if err != nil {
+		return 0, err
+	}
+	return s.send(packet)
+}
+
+// SendEcho send echo packet to teonet peer
+func (s *Session) SendEcho(peer string, msg string) (int, error) {
+	packet, err := (&TeoLNull{}).packetCreateEcho(peer, msg)
+	if err != nil {
+		return 0, err
+	}
+	return s.send(packet)
+}
+
+// Close session: disconnect from L0 server and drop packets buffered while
+// offline
+func (s *Session) Close() error {
+	s.mx.Lock()
+	if s.state == StateClosed {
+		s.mx.Unlock()
+		return ErrSessionClosed
+	}
+	teo := s.teo
+	s.teo, s.state, s.queue = nil, StateClosed, nil
+	close(s.closed)
+	s.mx.Unlock()
+	if teo != nil {
+		teo.Disconnect()
+	}
+	s.onState(StateClosed, nil)
+	return nil
+}
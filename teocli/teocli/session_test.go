@@ -0,0 +1,229 @@
+package teocli
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// l0Mock is L0 server mock: it accepts tcp connections and sends received
+// packets to channel
+type l0Mock struct {
+	ln    net.Listener
+	conns chan net.Conn
+}
+
+// newL0Mock start L0 server mock
+func newL0Mock(t *testing.T) *l0Mock {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l0 := &l0Mock{ln: ln, conns: make(chan net.Conn, 4)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			l0.conns <- conn
+		}
+	}()
+	return l0
+}
+
+// port return L0 server mock port
+func (l0 *l0Mock) port() int {
+	return l0.ln.Addr().(*net.TCPAddr).Port
+}
+
+// accept wait for next client connection
+func (l0 *l0Mock) accept(t *testing.T) (conn net.Conn, cli *TeoLNull) {
+	select {
+	case conn = <-l0.conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client does not connect")
+	}
+	cli, _ = Init(true)
+	cli.conn = &tcpTransport{conn}
+	return
+}
+
+// read wait for packet from client
+func (l0 *l0Mock) read(t *testing.T, cli *TeoLNull, cmd byte, peer,
+	data string) {
+	pac, err := cli.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pac.Command() != cmd || pac.Name() != peer ||
+		string(pac.Data()) != data {
+		t.Fatalf("wrong packet received: %d %s %q, wait for: %d %s %q",
+			pac.Command(), pac.Name(), pac.Data(), cmd, peer, data)
+	}
+}
+
+func TestSession(t *testing.T) {
+
+	// Connect, login, send offline queue, save cookie, reconnect and resume
+	// session with cookie
+	t.Run("resume", func(t *testing.T) {
+		l0 := newL0Mock(t)
+		defer l0.ln.Close()
+		states := make(chan State, 16)
+		cookieFile := filepath.Join(t.TempDir(), "teocli", "cookie")
+		s := NewSession("tst-name", "127.0.0.1", l0.port(), true,
+			SessionConfig{Reconnect: 20 * time.Millisecond,
+				CookieFile: cookieFile,
+				OnState:    func(state State, err error) { states <- state }})
+
+		// Send packet while offline
+		if _, err := s.SendTo(peer, cmd, data); err != nil {
+			t.Fatal(err)
+		}
+		read := make(chan *Packet, 4)
+		go func() {
+			for {
+				pac, err := s.Read()
+				if err != nil {
+					close(read)
+					return
+				}
+				read <- pac
+			}
+		}()
+
+		// First connection: login with name, get queued packet and send
+		// cookie
+		conn, cli := l0.accept(t)
+		l0.read(t, cli, 0, "", "tst-name\x00")
+		l0.read(t, cli, cmd, peer, msg)
+		p, _ := cli.PacketCreate(cmdCookie, "", []byte("tst-cookie"))
+		conn.Write(p)
+		if pac := <-read; pac == nil || string(pac.Data()) != "tst-cookie" {
+			t.Fatal("cookie packet does not received")
+		}
+		if s.Cookie() != "tst-cookie" || readCookie(cookieFile) != "tst-cookie" {
+			t.Fatalf("wrong cookie saved: %s", readCookie(cookieFile))
+		}
+		conn.Close()
+
+		// Second connection: login with cookie
+		conn, cli = l0.accept(t)
+		defer conn.Close()
+		l0.read(t, cli, 0, "", "tst-cookie\x00")
+		p, _ = cli.PacketCreate(cmd, peer, data)
+		conn.Write(p)
+		if pac := <-read; pac == nil || string(pac.Data()) != msg {
+			t.Fatal("packet does not received after reconnect")
+		}
+		s.Close()
+		if _, ok := <-read; ok {
+			t.Fatal("read after session closed")
+		}
+		for _, state := range []State{StateConnecting, StateConnected,
+			StateDisconnected, StateConnecting, StateConnected, StateClosed} {
+			if st := <-states; st != state {
+				t.Fatalf("wrong state %s, wait for %s", st, state)
+			}
+		}
+
+		// New session read cookie from file
+		s = NewSession("tst-name", "127.0.0.1", l0.port(), true,
+			SessionConfig{CookieFile: cookieFile})
+		if s.login() != "tst-cookie" {
+			t.Fatalf("wrong login: %s", s.login())
+		}
+	})
+
+	// Request waits for answer with request ID, other packets processed by
+	// handler
+	t.Run("request", func(t *testing.T) {
+		l0 := newL0Mock(t)
+		defer l0.ln.Close()
+		s := NewSession("tst-name", "127.0.0.1", l0.port(), true,
+			SessionConfig{Reconnect: 20 * time.Millisecond})
+		defer s.Close()
+		handled := make(chan *Packet, 1)
+		s.Handle(cmd, func(pac *Packet) { handled <- pac })
+		type result struct {
+			pac *Packet
+			err error
+		}
+		answer := make(chan result, 1)
+		id := s.NewReqID()
+		reqID := func(id uint32) []byte {
+			b := make([]byte, reqIDLen)
+			binary.LittleEndian.PutUint32(b, id)
+			return b
+		}
+		req := reqID(id)
+		go func() {
+			pac, err := s.Request(context.Background(), peer, cmd,
+				append(req, "request"...), ReqID(id))
+			answer <- result{pac, err}
+		}()
+
+		conn, cli := l0.accept(t)
+		defer conn.Close()
+		l0.read(t, cli, 0, "", "tst-name\x00")
+		l0.read(t, cli, cmd, peer, string(req)+"request")
+		for _, p := range []struct {
+			cmd  byte
+			data []byte
+		}{
+			{cmd, data},                         // Processed by handler
+			{cmd + 1, reqID(id + 1)},            // Dropped
+			{cmd + 1, append(req, "answer"...)}, // Answer
+		} {
+			packet, _ := cli.PacketCreate(p.cmd, peer, p.data)
+			conn.Write(packet)
+		}
+		select {
+		case pac := <-handled:
+			if string(pac.Data()) != msg {
+				t.Fatalf("wrong handled packet: %q", pac.Data())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("packet does not handled")
+		}
+		select {
+		case r := <-answer:
+			if r.err != nil || string(r.pac.Data()[4:]) != "answer" {
+				t.Fatalf("wrong answer: %v", r.err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("answer does not received")
+		}
+
+		// Request without answer
+		ctx, cancel := context.WithTimeout(context.Background(),
+			50*time.Millisecond)
+		defer cancel()
+		if _, err := s.Request(ctx, peer, cmd, data); err != context.DeadlineExceeded {
+			t.Fatalf("wrong request result: %v", err)
+		}
+	})
+
+	// Offline send queue is limited
+	t.Run("queue", func(t *testing.T) {
+		s := NewSession("tst-name", "127.0.0.1", 1, true,
+			SessionConfig{QueueSize: 2})
+		for i := 0; i < 3; i++ {
+			_, err := s.SendTo(peer, cmd, data)
+			if i < 2 && err != nil || i == 2 && err != ErrQueueFull {
+				t.Fatalf("wrong send %d result: %v", i, err)
+			}
+		}
+		s.Close()
+		if _, err := s.SendTo(peer, cmd, data); err != ErrSessionClosed {
+			t.Fatalf("wrong send result after close: %v", err)
+		}
+		if _, err := s.Read(); err != ErrSessionClosed {
+			t.Fatalf("wrong read result after close: %v", err)
+		}
+	})
+}
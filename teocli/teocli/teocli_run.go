@@ -2,6 +2,9 @@ package teocli
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -19,13 +22,11 @@ type Command interface {
 	Command(pac *Packet) bool
 }
 
-// Run conect and run
+// Run conect and run. It reconnects after timeout when disconnected and
+// resumes session with cookie received from users registrar.
 func Run(name, raddr string, rport int, tcp bool, timeout time.Duration,
 	startCommand StartCommand, commands ...Command) {
 
-	var err error
-	var teo *TeoLNull
-
 	network := func(tcp bool) string {
 		if tcp {
 			return "tcp"
@@ -33,59 +34,62 @@ func Run(name, raddr string, rport int, tcp bool, timeout time.Duration,
 		return "trudp"
 	}
 
-	// Reconnect loop, reconnect if disconnected afer timeout time (in sec)
-	for {
-		// Connect to L0 server
-		fmt.Printf("Try %s connecting to %s:%d ...\n", network(tcp), raddr, rport)
-		teo, err = Connect(raddr, rport, tcp)
-		if err != nil {
+	var s *Session
+	var connected bool
+	onState := func(state State, err error) {
+		switch state {
+		case StateConnecting:
+			fmt.Printf("Try %s connecting to %s:%d ...\n", network(tcp), raddr, rport)
+		case StateConnected:
+			// Execute start command
+			fmt.Printf("login: '%s'\n", s.login())
+			connected = true
+			startCommand.Command(s.Conn(), nil)
+		case StateDisconnected:
 			fmt.Println(err)
-			time.Sleep(timeout)
-			continue
-		}
-
-		// Send Teonet L0 login (requered after connect)
-		fmt.Printf("send login: '%s'\n", name)
-		if _, err := teo.SendLogin(name); err != nil {
-			fmt.Println(err)
-			time.Sleep(timeout)
-			continue
-		}
-
-		// Execute start command
-		startCommand.Command(teo, nil)
-
-		// Reader (receive data and process it)
-		for {
-			packet, err := teo.Read()
-			if err != nil {
-				fmt.Println(err)
-				startCommand.Disconnected()
+			if !connected {
 				break
 			}
-			// Process loadded commands
-			for _, com := range commands {
-				if cmd := com.Cmd(); cmd == packet.Command() {
-					if com.Command(packet) {
-						break
-					}
-				}
+			connected = false
+			startCommand.Disconnected()
+			// Stop running if ganning flag set to false
+			if !startCommand.Running() {
+				s.Close()
 			}
 		}
+	}
+	s = NewSession(name, raddr, rport, tcp, SessionConfig{Reconnect: timeout,
+		OnState: onState})
 
-		// Stop running if ganning flag set to false
-		if !startCommand.Running() {
-			break
-		}
-
-		// Disconnect
-		teo.Disconnect()
-		time.Sleep(timeout)
+	// Process loadded commands in background reader
+	for _, com := range commands {
+		cmd := com.Cmd()
+		s.Handle(cmd, func(packet *Packet) {
+			for _, com := range commands {
+				if com.Cmd() == cmd && com.Command(packet) {
+					break
+				}
+			}
+		})
 	}
+	s.Start()
+	<-s.Done()
 }
 
-func readСookie() {
+// readCookie read session cookie from file, it returns empty string if the
+// file does not exists
+func readCookie(file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
 }
 
-func writeСookie() {
+// writeCookie save session cookie to file
+func writeCookie(file, cookie string) (err error) {
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return
+	}
+	return os.WriteFile(file, []byte(cookie+"\n"), 0600)
 }
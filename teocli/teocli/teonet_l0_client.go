@@ -6,19 +6,13 @@
 //
 package teocli
 
-// #include <string.h>
-// #include "packet.h"
-import "C"
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
-	"net"
 	"strconv"
-	"time"
-	"unsafe"
-
-	"github.com/kirill-scherba/teonet-go/trudp/trudp"
 )
 
 // Version teocli version
@@ -26,25 +20,27 @@ const Version = "3.0.0"
 
 const (
 	// CmdLEcho Echo command
-	CmdLEcho = C.CMD_L_ECHO
+	CmdLEcho = 65
 
 	// CmdLEchoAnswer Answer to Echo command
-	CmdLEchoAnswer = C.CMD_L_ECHO_ANSWER
+	CmdLEchoAnswer = 66
 
 	// CmdLPeers Get peers command
-	CmdLPeers = C.CMD_L_PEERS
+	CmdLPeers = 72
 
 	// CmdLPeersAnswer Answer to get peers command
-	CmdLPeersAnswer = C.CMD_L_PEERS_ANSWER
+	CmdLPeersAnswer = 73
+
+	// CmdL0Error L0 server error answer command (limit exceeded or access
+	// denied), the answer data is JSON with error description
+	CmdL0Error = 101
 )
 
 // TeoLNull teonet l0 client connection data
 type TeoLNull struct {
-	readBuffer []byte             // Read buffer
-	tcp        bool               // TCP connection flag - if true than tcp
-	conn       net.Conn           // TCP connection
-	td         *trudp.TRUDP       // TRUDP connection
-	tcd        *trudp.ChannelData // TRUDP channel
+	readBuffer []byte    // Read buffer
+	tcp        bool      // TCP connection flag - if true than tcp
+	conn       transport // Connection transport: tcp, trudp or websocket
 }
 
 // Init initialize teocli
@@ -53,70 +49,41 @@ func Init(tcp bool) (teo *TeoLNull, err error) {
 	return
 }
 
-// Connect connect to L0 server
-func Connect(addr string, port int, tcp bool) (teo *TeoLNull, err error) {
+// Connect connect to L0 server. The options are trudp.Init options used in
+// trudp connection (e.g. trudp.ConnectionID to keep connection when client
+// address changed) and *tls.Config which sets TLS connection to L0 server
+// tcp port.
+func Connect(addr string, port int, tcp bool, opts ...interface{}) (teo *TeoLNull, err error) {
 	teo, err = Init(tcp)
 	if tcp {
-		teo.conn, err = net.Dial("tcp", addr+":"+strconv.Itoa(port))
-		if err != nil {
-			return
-		}
+		teo.conn, err = connectTCP(addr+":"+strconv.Itoa(port), opts...)
 	} else {
-		localport := 0
-		teo.td = trudp.Init(&localport)
-		teo.tcd = teo.td.ConnectChannel(addr, port, 0)
-		go teo.td.Run()
-		// Wait channel answer and marked as connected
-		const timeout = 2500 * time.Millisecond
-		done := make(chan bool)
-		go func() {
-			t := time.Now()
-			teo.tcd.Write(nil)
-			for !teo.tcd.Connected() {
-				if time.Since(t) > timeout {
-					err = errors.New("can't connect during timeout")
-					break
-				}
-				time.Sleep(10 * time.Millisecond)
-			}
-			done <- true
-		}()
-		<-done
+		teo.conn, err = connectTrudp(addr, port, opts...)
 	}
 	return
 }
 
+// ConnectWS connect to L0 server websocket, the url is websocket server url
+// (e.g. ws://localhost:8080/ws). The websocket L0 server exchanges JSON
+// messages, so packets data should be text or JSON. It is the only L0
+// connection available in the browser (GOOS=js). The *tls.Config option
+// sets TLS parameters of wss:// connection (it is not used in the browser).
+func ConnectWS(url string, opts ...interface{}) (teo *TeoLNull, err error) {
+	teo, err = Init(false)
+	teo.conn, err = connectWS(url, opts...)
+	return
+}
+
 // Disconnect from L0 server
 func (teocli *TeoLNull) Disconnect() {
-	if teocli.tcp {
-		teocli.conn.Close()
-	} else {
-		teocli.td.ChanEventClosed()
-		teocli.td.Close()
+	if teocli.conn != nil {
+		teocli.conn.close()
 	}
 }
 
 // PacketCreate create teonet l0 client packet
 func (teocli *TeoLNull) PacketCreate(command uint8, peer string, data []byte) (buffer []byte, err error) {
-	var dataLen int
-	var dataPtr unsafe.Pointer
-	if data != nil && len(data) > 0 {
-		dataPtr = unsafe.Pointer(&data[0])
-		dataLen = len(data)
-	}
-	bufferLength := C.teoLNullHeaderSize() + C.size_t(len(peer)+1+dataLen)
-	buffer = make([]byte, bufferLength)
-	peerC := C.CString(peer)
-	defer C.free(unsafe.Pointer(peerC))
-	lengh := C.teoLNullPacketCreate(unsafe.Pointer(&buffer[0]), C.size_t(bufferLength), C.uint8_t(command), peerC,
-		dataPtr, C.size_t(dataLen))
-	if int(lengh) != len(buffer) {
-		err = fmt.Errorf("can't create packet: "+
-			"the length of created packet %d not equal to packet buffer %d",
-			lengh, len(buffer))
-	}
-
-	return
+	return packetCreate(command, peer, data)
 }
 
 // packetCreateString creates packet with string data
@@ -131,19 +98,10 @@ func (teocli *TeoLNull) packetCreateLogin(data string) (buffer []byte, err error
 
 // packetCreateEcho creates teonet l0 client echo packet
 func (teocli *TeoLNull) packetCreateEcho(peer string, msg string) (buffer []byte, err error) {
-	bufferLength := C.teoLNullHeaderSize() + C.size_t(len(peer)+1+len(msg)+1) + C.sizeof_int64_t
-	buffer = make([]byte, bufferLength)
-	peerC := C.CString(peer)
-	msgC := C.CString(msg)
-	defer func() { C.free(unsafe.Pointer(peerC)); C.free(unsafe.Pointer(msgC)) }()
-	lengh := C.teoLNullPacketCreateEcho(unsafe.Pointer(&buffer[0]), C.size_t(bufferLength), peerC, msgC)
-	if int(lengh) != len(buffer) {
-		err = fmt.Errorf("can't create echo packet: "+
-			"the length of created packet %d not equal to packet buffer %d",
-			lengh, len(buffer),
-		)
-	}
-	return
+	data := make([]byte, len(msg)+1+echoTimeLen)
+	copy(data, msg)
+	binary.LittleEndian.PutUint64(data[len(msg)+1:], uint64(currentTime()))
+	return teocli.PacketCreate(CmdLEcho, peer, data)
 }
 
 // PacketCheck check received packet, combine packets and return valid packet.
@@ -161,12 +119,8 @@ func (teocli *TeoLNull) PacketCheck(packet []byte) (retpacket []byte, retval int
 	}
 
 	// Check packet length and checksums and parse return value (0, 1, -1, -2, -3)
-	var packetPtr unsafe.Pointer
-	if packet != nil && len(packet) > 0 {
-		packetPtr = unsafe.Pointer(&packet[0])
-	}
-	retval = int(C.packetCheck(packetPtr, C.size_t(len(packet))))
-	//fmt.Println("C.packetCheck(before):", retval, "buffer len:", len(teocli.readBuffer))
+	retval = packetCheck(packet)
+	//fmt.Println("packetCheck(before):", retval, "buffer len:", len(teocli.readBuffer))
 	switch {
 
 	// valid packet
@@ -174,7 +128,7 @@ func (teocli *TeoLNull) PacketCheck(packet []byte) (retpacket []byte, retval int
 		//if len(teocli.readBuffer) > 0 {
 		//teocli.readBuffer = teocli.readBuffer[:0]
 		//}
-		packetLength := C.packetGetLength(packetPtr)
+		packetLength := packetLength(packet)
 		retpacket = packet[0:packetLength]
 		teocli.readBuffer = packet[packetLength:]
 
@@ -186,13 +140,12 @@ func (teocli *TeoLNull) PacketCheck(packet []byte) (retpacket []byte, retval int
 	// next part of splitted packet
 	case /*(retval == -3 || retval == -2 || retval == -1 || retval == 0) &&*/ len(teocli.readBuffer) > 0:
 		teocli.readBuffer = append(teocli.readBuffer, packet...)
-		bufPtr := unsafe.Pointer(&teocli.readBuffer[0])
-		retval = int(C.packetCheck(bufPtr, C.size_t(len(teocli.readBuffer))))
-		//fmt.Println("C.packetCheck(after):", retval, "buffer len:", len(teocli.readBuffer))
+		retval = packetCheck(teocli.readBuffer)
+		//fmt.Println("packetCheck(after):", retval, "buffer len:", len(teocli.readBuffer))
 		switch retval {
 		// valid packet received
 		case 0:
-			packetLength := C.packetGetLength(bufPtr)
+			packetLength := packetLength(teocli.readBuffer)
 			retpacket = append([]byte(nil), teocli.readBuffer[:packetLength]...)
 			teocli.readBuffer = teocli.readBuffer[packetLength:]
 		// invalid packet received
@@ -203,6 +156,11 @@ func (teocli *TeoLNull) PacketCheck(packet []byte) (retpacket []byte, retval int
 		default:
 			retval = -1
 		}
+
+	// wrong packet received (wrong checksum and it is not next part of
+	// splitted packet)
+	default:
+		retval = 1
 	}
 	//fmt.Println("packetCheck(end):", retval, "buffer len:", len(teocli.readBuffer))
 	return
@@ -215,21 +173,11 @@ func (teocli *TeoLNull) ResetReadBuf() {
 
 // send packet to L0 server
 func (teocli *TeoLNull) send(packet []byte) (length int, err error) {
-	if teocli.tcp {
-		length, err = teocli.conn.Write(packet)
-	} else {
-		length = len(packet)
-		for {
-			if len(packet) <= 512 {
-				_, err = teocli.tcd.Write(packet)
-				break
-			} else {
-				_, err = teocli.tcd.Write(packet[:512])
-				packet = packet[512:]
-			}
-		}
+	if teocli.conn == nil {
+		err = errors.New("not connected")
+		return
 	}
-	return
+	return teocli.conn.send(packet)
 }
 
 // sendEchoAnswer send echo answer to echo command
@@ -239,11 +187,11 @@ func (teocli *TeoLNull) sendEchoAnswer(packet []byte) (length int, err error) {
 		return
 	}
 	pac := teocli.NewPacket(packet)
-	if pac.Command() != C.CMD_L_ECHO {
+	if pac.Command() != CmdLEcho {
 		err = fmt.Errorf("wrong echo packet command: %d", pac.Command())
 		return
 	}
-	return teocli.SendTo(pac.From(), C.CMD_L_ECHO_ANSWER, pac.Data())
+	return teocli.SendTo(pac.From(), CmdLEchoAnswer, pac.Data())
 }
 
 // SendTo sends data packet to teonet peer
@@ -273,7 +221,8 @@ func (teocli *TeoLNull) SendLogin(name string) (int, error) {
 	return teocli.send(packet)
 }
 
-// Read wait for receiving data from tcp or trudp and return teocli packet
+// Read wait for receiving data from tcp, trudp or websocket and return
+// teocli packet
 func (teocli *TeoLNull) Read() (pac *Packet, err error) {
 	packetCheck := func(packet []byte) (pac *Packet) {
 		packet, _ = teocli.PacketCheck(packet)
@@ -283,93 +232,64 @@ func (teocli *TeoLNull) Read() (pac *Packet, err error) {
 		}
 		return
 	}
-FOR:
 	for {
 		// Get next valid packet from teocli read buffer
 		if pac = packetCheck(nil); pac != nil {
-			break FOR
+			return
+		}
+		if teocli.conn == nil {
+			err = errors.New("not connected")
+			return
+		}
+		// Get received data from tcp, trudp or websocket
+		var packet []byte
+		if packet, err = teocli.conn.read(); err != nil {
+			return
 		}
-		// Get received data from tcp or udp
-		if teocli.tcp {
-			packet := make([]byte, 2048)
-			length, _ := teocli.conn.Read(packet)
-			if length == 0 {
-				err = errors.New("server disconnected")
-				break FOR
-			}
-			packet = packet[:length]
-			if pac = packetCheck(packet); pac != nil {
-				break FOR
-			}
-		} else {
-			ev := <-teocli.td.ChanEvent()
-			packet := ev.Data
-			switch ev.Event {
-
-			case trudp.EvDisconnected:
-				err = errors.New("channel with key " + string(packet) + " disconnected")
-				break FOR
-
-			case trudp.EvResetLocal:
-				err = errors.New("need to reconnect")
-				break FOR
-
-			case trudp.EvGotData:
-				if pac = packetCheck(packet); pac != nil {
-					break FOR
-				}
-			default:
-				fmt.Println("got event:", ev.Event)
-			}
+		if pac = packetCheck(packet); pac != nil {
+			return
 		}
 	}
-	return
 }
 
 // PeerData create arp peer bynary data
 func PeerData(mode int, peer, addr string, port int, triptime float32) (d []byte) {
-
-	// Fill ksnet_arp data structure
-	arpData := &C.ksnet_arp_data{}
-	arpDataLen := C.sizeof_ksnet_arp_data
-	arpData.mode = C.int16_t(mode)
-	if len(addr) > 0 {
-		C.memcpy(unsafe.Pointer(&arpData.addr[0]), unsafe.Pointer(&[]byte(addr)[0]),
-			C.size_t(len(addr)))
-	}
-	arpData.port = C.int16_t(port)
-	arpData.last_triptime = C.double(triptime)
-
-	// Peer name
-	cname := []byte(peer)
-	if l := len(cname); l < int(C.ARP_TABLE_IP_SIZE) {
-		cname = append(cname, make([]byte, C.ARP_TABLE_IP_SIZE-l)...)
-	} else {
-		cname = cname[:C.ARP_TABLE_IP_SIZE]
-	}
-
-	// Create slice from unsafe C raw pointer (the data does not copy)
-	d = (*[1 << 28]byte)(unsafe.Pointer(arpData))[:arpDataLen:arpDataLen]
-	d = append(cname, d...)
-
+	d = make([]byte, peerDataLen)
+	le := binary.LittleEndian
+	copy(d[:arpTableIPSize], peer)
+	le.PutUint16(d[arpModePos:], uint16(int16(mode)))
+	copy(d[arpAddrPos:arpAddrPos+arpTableIPSize-1], addr)
+	le.PutUint16(d[arpPortPos:], uint16(int16(port)))
+	le.PutUint64(d[arpTriptimePos:], math.Float64bits(float64(triptime)))
 	return
 }
 
-// ParsePeerData parse peer data from binary buffer
+// ParsePeerData parse peer data from binary buffer. It returns empty values
+// if buffer length less than PeerDataLength.
 func ParsePeerData(d []byte) (mode int, peer, addr string, port int, triptime float32) {
-	cpeer := (*C.char)(unsafe.Pointer(&d[0]))
-	dptr := unsafe.Pointer(&d[C.ARP_TABLE_IP_SIZE])
-	arpData := (*C.ksnet_arp_data)(dptr)
-	mode = int(arpData.mode)
-	peer = C.GoString(cpeer)
-	addr = C.GoString(&arpData.addr[0])
-	port = int(arpData.port)
-	triptime = float32(math.Round(float64(arpData.last_triptime)*1000) / 1000)
-	//triptime = float32(arpData.last_triptime)
+	if len(d) < PeerDataLength() {
+		return
+	}
+	le := binary.LittleEndian
+	mode = int(int16(le.Uint16(d[arpModePos:])))
+	peer = goString(d[:arpTableIPSize])
+	addr = goString(d[arpAddrPos : arpAddrPos+arpTableIPSize])
+	port = int(int16(le.Uint16(d[arpPortPos:])))
+	t := math.Float64frombits(le.Uint64(d[arpTriptimePos:]))
+	triptime = float32(math.Round(t*1000) / 1000)
 	return
 }
 
+// goString return string from zero terminated string in byte slice, the
+// string is limited by slice length
+func goString(b []byte) string {
+	if l := bytes.IndexByte(b, 0); l >= 0 {
+		b = b[:l]
+	}
+	return string(b)
+}
+
 // PeerDataLength return length of binary PeerData buffer
 func PeerDataLength() int {
-	return C.ARP_TABLE_IP_SIZE + C.sizeof_ksnet_arp_data
+	return peerDataLen
 }
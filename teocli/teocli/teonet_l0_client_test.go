@@ -2,8 +2,14 @@ package teocli
 
 import (
 	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"golang.org/x/net/websocket"
 )
 
 var cmd uint8 = 129
@@ -268,6 +274,111 @@ func TestPacketCheck(t *testing.T) {
 	})
 }
 
+// TestWireCompatibility check packets and peers data are equal to created by
+// original C teocli library
+func TestWireCompatibility(t *testing.T) {
+	golden := func(s string) []byte {
+		b, _ := hex.DecodeString(s)
+		return b
+	}
+
+	t.Run("packets", func(t *testing.T) {
+		packet, _ := teo.PacketCreate(cmd, peer, []byte(msg))
+		login, _ := teo.packetCreateLogin("teo-go")
+		empty, _ := teo.PacketCreate(0x55, "", nil)
+		for _, p := range []struct{ packet, golden []byte }{
+			{packet, golden("810a0d0000004be370732d7365727665720048656c6c6f2054656f6e657421")},
+			{login, golden("0001070000004b530074656f2d676f00")},
+			{empty, golden("550100000000005600")},
+		} {
+			if !bytes.Equal(p.packet, p.golden) {
+				t.Errorf("wrong packet:\n%x\nwait for:\n%x", p.packet, p.golden)
+			}
+		}
+		pac := teo.NewPacket(packet)
+		if pac.Command() != cmd || pac.From() != peer || string(pac.Data()) != msg {
+			t.Errorf("wrong parsed packet: %d %s %s", pac.Command(), pac.From(),
+				pac.Data())
+		}
+	})
+
+	t.Run("peers", func(t *testing.T) {
+		p1 := PeerData(-1, "teo-go-1", "127.0.0.1", 9010, 0.125)
+		if g := golden("74656f2d676f2d31" + strings.Repeat("00", 40) + "ffff" +
+			"3132372e302e302e31" + strings.Repeat("00", 39) + "3223" +
+			strings.Repeat("00", 34) + "c03f" + strings.Repeat("00", 24)); !bytes.Equal(p1, g) {
+			t.Errorf("wrong peer data:\n%x\nwait for:\n%x", p1, g)
+		}
+		p2 := PeerData(0, "teo-go-2", "10.0.0.1", 9011, 12.5)
+		packet, _ := teo.PacketCreate(CmdLPeersAnswer, "", append(append(
+			[]byte{2, 0, 0, 0}, p1...), p2...))
+		pac := teo.NewPacket(packet)
+		const peers = "  1 teo-go-1    (-1)   127.0.0.1         9010    0.125 ms\n" +
+			"  2 teo-go-2    ( 0)   10.0.0.1          9011   12.500 ms\n"
+		if pac.PeersLength() != 2 || pac.Peers() != peers {
+			t.Errorf("wrong peers %d:\n%s", pac.PeersLength(), pac.Peers())
+		}
+	})
+}
+
+// TestWebsocket check websocket connection exchanges JSON messages with L0
+// websocket server
+func TestWebsocket(t *testing.T) {
+	type request struct {
+		Cmd    byte        `json:"cmd"`
+		To     string      `json:"to"`
+		Data   interface{} `json:"data"`
+		Base64 bool        `json:"base64"`
+	}
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		// Answer received message data to the sender in L0 server format
+		for {
+			var req request
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				return
+			}
+			websocket.JSON.Send(ws, map[string]interface{}{"cmd": req.Cmd + 1,
+				"from": req.To, "data": req.Data, "base64": req.Base64})
+		}
+	}))
+	defer srv.Close()
+
+	cli, err := ConnectWS("ws" + strings.TrimPrefix(srv.URL, "http") + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Disconnect()
+	binary := "\x01\xff\xfe\x00\x80teo\xc3"
+	for _, data := range []string{msg, `{"id":1,"name":"teo"}`, "", binary} {
+		d := []byte(data)
+		if len(d) > 0 {
+			d = append(d, 0)
+		}
+		if _, err := cli.SendTo(peer, cmd, d); err != nil {
+			t.Fatal(err)
+		}
+		pac, err := cli.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pac.Command() != cmd+1 || pac.From() != peer {
+			t.Errorf("wrong answer: %d %s", pac.Command(), pac.From())
+		}
+		got := bytes.TrimSuffix(pac.Data(), []byte{0})
+		if data != "" && data[0] == '{' {
+			var a, b interface{}
+			json.Unmarshal(got, &a)
+			json.Unmarshal([]byte(data), &b)
+			got, _ = json.Marshal(a)
+			d, _ := json.Marshal(b)
+			data = string(d)
+		}
+		if string(got) != data {
+			t.Errorf("wrong answer data: %q, wait for: %q", got, data)
+		}
+	}
+}
+
 // Test bytes packet
 func TestBytes(t *testing.T) {
 
@@ -277,3 +388,41 @@ func TestBytes(t *testing.T) {
 	//b.WriteTo(os.Stdout)
 	sliceCompare(b.Bytes(), []byte("Hello world!"))
 }
+
+// FuzzPacketCheck check received L0 packets check does not panic and return
+// valid packets and statuses. The fuzzer data is split to two received parts.
+func FuzzPacketCheck(f *testing.F) {
+	packet, _ := teo.PacketCreate(cmd, peer, []byte(msg))
+	echo, _ := teo.packetCreateEcho(peer, msg)
+	login, _ := teo.packetCreateLogin("teo-go-fuzz")
+	f.Add(packet, 0)
+	f.Add(append(packet, echo...), len(packet)+3)
+	f.Add(login, 5)
+	f.Add(packet[:7], 3)
+	// Header only packet is valid inside received buffer only
+	headerLen := len(packet) - len(peer) - 1 - len(msg)
+	f.Fuzz(func(t *testing.T, data []byte, split int) {
+		if split < 0 || split > len(data) {
+			split = len(data)
+		}
+		cli := &TeoLNull{}
+		for _, part := range [][]byte{data[:split], data[split:], nil} {
+			pac, status := cli.PacketCheck(part)
+			switch status {
+			case 0:
+				if pac == nil {
+					t.Fatal("valid packet status without packet")
+				}
+				if _, status := (&TeoLNull{}).PacketCheck(pac); status != 0 &&
+					len(pac) > headerLen {
+					t.Fatalf("returned packet is not valid, status: %d", status)
+				}
+				p := cli.NewPacket(pac)
+				_, _, _ = p.Command(), p.From(), p.Data()
+			case -1, 1:
+			default:
+				t.Fatalf("wrong status %d", status)
+			}
+		}
+	})
+}
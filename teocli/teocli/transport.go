@@ -0,0 +1,74 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Transport module of teocli package: L0 client connection interface and
+// TCP connection.
+
+package teocli
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// transport is L0 server connection
+type transport interface {
+	send(packet []byte) (int, error) // Send L0 packet
+	read() ([]byte, error)           // Wait and return received data
+	close() error                    // Close connection
+}
+
+// tcpTransport is TCP L0 server connection
+type tcpTransport struct {
+	conn net.Conn
+}
+
+// connectTCP connect to L0 server by TCP, the *tls.Config option sets TLS
+// connection
+func connectTCP(addr string, opts ...interface{}) (t transport, err error) {
+	var conn net.Conn
+	if config := tlsOption(opts); config != nil {
+		conn, err = tls.Dial("tcp", addr, config)
+	} else {
+		conn, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		return
+	}
+	t = &tcpTransport{conn}
+	return
+}
+
+// tlsOption return *tls.Config from connect options or nil if it absent
+func tlsOption(opts []interface{}) *tls.Config {
+	for _, opt := range opts {
+		if config, ok := opt.(*tls.Config); ok {
+			return config
+		}
+	}
+	return nil
+}
+
+// send packet to L0 server
+func (t *tcpTransport) send(packet []byte) (int, error) {
+	return t.conn.Write(packet)
+}
+
+// read wait and return data received from L0 server
+func (t *tcpTransport) read() (data []byte, err error) {
+	data = make([]byte, 2048)
+	length, _ := t.conn.Read(data)
+	if length == 0 {
+		err = errors.New("server disconnected")
+		return
+	}
+	data = data[:length]
+	return
+}
+
+// close TCP connection
+func (t *tcpTransport) close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !js
+// +build !js
+
+// Transport module of teocli package: TRUDP connection.
+
+package teocli
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/trudp/trudp"
+)
+
+// trudpTransport is TRUDP L0 server connection
+type trudpTransport struct {
+	td   *trudp.TRUDP       // TRUDP connection
+	tcd  *trudp.ChannelData // TRUDP channel
+	once sync.Once          // Close once
+}
+
+// connectTrudp connect to L0 server by TRUDP. The options are trudp.Init
+// options.
+func connectTrudp(addr string, port int, opts ...interface{}) (transport,
+	error) {
+	var err error
+	localport := 0
+	t := &trudpTransport{}
+	t.td = trudp.Init(&localport, opts...)
+	t.tcd = t.td.ConnectChannel(addr, port, 0)
+	go t.td.Run()
+	// Wait channel answer and marked as connected
+	const timeout = 2500 * time.Millisecond
+	done := make(chan bool)
+	go func() {
+		tm := time.Now()
+		t.tcd.Write(nil)
+		for !t.tcd.Connected() {
+			if time.Since(tm) > timeout {
+				err = errors.New("can't connect during timeout")
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		done <- true
+	}()
+	<-done
+	return t, err
+}
+
+// send packet to L0 server
+func (t *trudpTransport) send(packet []byte) (length int, err error) {
+	length = len(packet)
+	for {
+		if len(packet) <= 512 {
+			_, err = t.tcd.Write(packet)
+			break
+		} else {
+			_, err = t.tcd.Write(packet[:512])
+			packet = packet[512:]
+		}
+	}
+	return
+}
+
+// read wait and return data received from L0 server
+func (t *trudpTransport) read() (data []byte, err error) {
+	for {
+		ev, ok := <-t.td.ChanEvent()
+		if !ok {
+			err = errors.New("trudp connection closed")
+			return
+		}
+		data = ev.Data
+		switch ev.Event {
+
+		case trudp.EvDisconnected:
+			err = errors.New("channel with key " + string(data) + " disconnected")
+			return
+
+		case trudp.EvClosed:
+			err = errors.New("channel with key " + string(data) + " closed")
+			return
+
+		case trudp.EvResetLocal:
+			err = errors.New("need to reconnect")
+			return
+
+		case trudp.EvGotData:
+			return
+		}
+	}
+}
+
+// close TRUDP connection
+func (t *trudpTransport) close() error {
+	t.once.Do(func() {
+		t.td.ChanEvent() // Register events reader if it was not registered
+		t.td.ChanEventClosed()
+		t.td.Close()
+	})
+	return nil
+}
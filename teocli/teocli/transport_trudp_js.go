@@ -0,0 +1,17 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Transport module of teocli package: TRUDP connection is not available in
+// browser.
+
+package teocli
+
+import "errors"
+
+// connectTrudp return error: there is not UDP in browser
+func connectTrudp(addr string, port int, opts ...interface{}) (transport,
+	error) {
+	return nil, errors.New("trudp connection is not supported in browser, " +
+		"use websocket connection")
+}
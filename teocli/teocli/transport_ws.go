@@ -0,0 +1,80 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Transport module of teocli package: websocket JSON messages. The L0
+// websocket server receives messages {"cmd":N,"to":"peer","data":...} and
+// sends messages {"cmd":N,"from":"peer","data":...}, where data is JSON
+// object or string. Binary data (not valid UTF-8 string) is sent as base64
+// string with "base64":true marker.
+
+package teocli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// wsRequest is websocket message sent to L0 server
+type wsRequest struct {
+	Cmd    byte        `json:"cmd"`
+	To     string      `json:"to"`
+	Data   interface{} `json:"data"`
+	Base64 bool        `json:"base64,omitempty"`
+}
+
+// wsAnswer is websocket message received from L0 server
+type wsAnswer struct {
+	Cmd    byte            `json:"cmd"`
+	From   string          `json:"from"`
+	Data   json.RawMessage `json:"data"`
+	Base64 bool            `json:"base64"`
+}
+
+// wsMarshal convert L0 packet to websocket message. The L0 server adds
+// trailing zero to received data so it is removed from packet data. Data
+// which is JSON object or array sends as is, binary data sends as base64
+// string, other data sends as string.
+func wsMarshal(packet []byte) ([]byte, error) {
+	pac := &Packet{packet}
+	data := bytes.TrimSuffix(pac.Data(), []byte{0})
+	req := wsRequest{Cmd: pac.Command(), To: pac.Name(), Data: string(data)}
+	switch l := len(data); {
+	case l > 0 && (data[0] == '{' && data[l-1] == '}' ||
+		data[0] == '[' && data[l-1] == ']') && json.Valid(data):
+		req.Data = json.RawMessage(data)
+	case !utf8.Valid(data):
+		req.Data = base64.StdEncoding.EncodeToString(data)
+		req.Base64 = true
+	}
+	return json.Marshal(req)
+}
+
+// wsUnmarshal convert websocket message to L0 packet. String data is
+// unquoted (and decoded if it has base64 marker), JSON data is used as is. Not empty data gets trailing zero as
+// the L0 server removes it.
+func wsUnmarshal(msg []byte) (packet []byte, err error) {
+	var ans wsAnswer
+	if err = json.Unmarshal(msg, &ans); err != nil {
+		return
+	}
+	var data []byte
+	var s string
+	switch {
+	case len(ans.Data) == 0 || string(ans.Data) == "null":
+	case json.Unmarshal(ans.Data, &s) == nil && ans.Base64:
+		if data, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return
+		}
+	case json.Unmarshal(ans.Data, &s) == nil:
+		data = []byte(s)
+	default:
+		data = ans.Data
+	}
+	if len(data) > 0 {
+		data = append(data, 0)
+	}
+	return packetCreate(ans.Cmd, ans.From, data)
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Transport module of teocli package: browser websocket connection.
+
+package teocli
+
+import (
+	"errors"
+	"sync"
+	"syscall/js"
+)
+
+// wsTransport is browser websocket L0 server connection. The websocket
+// callbacks can't block so received messages are saved in queue.
+type wsTransport struct {
+	ws     js.Value      // Browser WebSocket object
+	funcs  []wsListener  // WebSocket event listeners
+	mx     sync.Mutex    // Queue and err mutex
+	queue  [][]byte      // Received messages
+	err    error         // Connection error (connection closed)
+	notify chan struct{} // Message received or connection closed
+}
+
+// wsListener is WebSocket event listener
+type wsListener struct {
+	event string
+	fn    js.Func
+}
+
+// connectWS connect to L0 server websocket, the browser checks TLS
+// certificate of wss connection so options are not used
+func connectWS(url string, opts ...interface{}) (transport, error) {
+	t := &wsTransport{notify: make(chan struct{}, 1)}
+	opened := make(chan error, 1)
+	t.ws = js.Global().Get("WebSocket").New(url)
+	t.ws.Set("binaryType", "arraybuffer")
+	t.on("open", func(js.Value) {
+		select {
+		case opened <- nil:
+		default:
+		}
+	})
+	t.on("close", func(js.Value) {
+		t.setErr(errors.New("server disconnected"))
+		select {
+		case opened <- errors.New("can't connect to " + url):
+		default:
+		}
+	})
+	t.on("message", func(ev js.Value) {
+		var msg []byte
+		if data := ev.Get("data"); data.Type() == js.TypeString {
+			msg = []byte(data.String())
+		} else {
+			arr := js.Global().Get("Uint8Array").New(data)
+			msg = make([]byte, arr.Length())
+			js.CopyBytesToGo(msg, arr)
+		}
+		t.mx.Lock()
+		t.queue = append(t.queue, msg)
+		t.mx.Unlock()
+		t.wakeup()
+	})
+	if err := <-opened; err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// on add WebSocket event listener
+func (t *wsTransport) on(event string, f func(ev js.Value)) {
+	fn := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		f(args[0])
+		return nil
+	})
+	t.funcs = append(t.funcs, wsListener{event, fn})
+	t.ws.Call("addEventListener", event, fn)
+}
+
+// setErr set connection error and wake up reader
+func (t *wsTransport) setErr(err error) {
+	t.mx.Lock()
+	if t.err == nil {
+		t.err = err
+	}
+	t.mx.Unlock()
+	t.wakeup()
+}
+
+// wakeup reader
+func (t *wsTransport) wakeup() {
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// send packet to L0 server
+func (t *wsTransport) send(packet []byte) (length int, err error) {
+	const open = 1 // WebSocket.OPEN ready state
+	if t.ws.Get("readyState").Int() != open {
+		err = errors.New("websocket is not connected")
+		return
+	}
+	msg, err := wsMarshal(packet)
+	if err != nil {
+		return
+	}
+	t.ws.Call("send", string(msg))
+	return len(packet), nil
+}
+
+// read wait and return L0 packet received from L0 server, wrong websocket
+// messages are skipped
+func (t *wsTransport) read() (packet []byte, err error) {
+	for {
+		t.mx.Lock()
+		if len(t.queue) > 0 {
+			msg := t.queue[0]
+			t.queue = t.queue[1:]
+			t.mx.Unlock()
+			if packet, err = wsUnmarshal(msg); err == nil {
+				return
+			}
+			continue
+		}
+		err = t.err
+		t.mx.Unlock()
+		if err != nil {
+			return
+		}
+		<-t.notify
+	}
+}
+
+// close websocket connection and release callbacks
+func (t *wsTransport) close() error {
+	t.ws.Call("close")
+	t.setErr(errors.New("connection closed"))
+	for _, l := range t.funcs {
+		t.ws.Call("removeEventListener", l.event, l.fn)
+		l.fn.Release()
+	}
+	t.funcs = nil
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !js
+// +build !js
+
+// Transport module of teocli package: websocket connection.
+
+package teocli
+
+import (
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// wsTransport is websocket L0 server connection
+type wsTransport struct {
+	ws *websocket.Conn
+}
+
+// connectWS connect to L0 server websocket, the *tls.Config option sets TLS
+// parameters of wss connection
+func connectWS(url string, opts ...interface{}) (t transport, err error) {
+	origin := "http://localhost/"
+	if strings.HasPrefix(url, "wss://") {
+		origin = "https://localhost/"
+	}
+	config, err := websocket.NewConfig(url, origin)
+	if err != nil {
+		return
+	}
+	config.TlsConfig = tlsOption(opts)
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		return
+	}
+	t = &wsTransport{ws}
+	return
+}
+
+// send packet to L0 server
+func (t *wsTransport) send(packet []byte) (length int, err error) {
+	msg, err := wsMarshal(packet)
+	if err != nil {
+		return
+	}
+	if err = websocket.Message.Send(t.ws, string(msg)); err != nil {
+		return
+	}
+	return len(packet), nil
+}
+
+// read wait and return L0 packet received from L0 server, wrong websocket
+// messages are skipped
+func (t *wsTransport) read() (packet []byte, err error) {
+	for {
+		var msg []byte
+		if err = websocket.Message.Receive(t.ws, &msg); err != nil {
+			return
+		}
+		if packet, err = wsUnmarshal(msg); err == nil {
+			return
+		}
+	}
+}
+
+// close websocket connection
+func (t *wsTransport) close() error {
+	return t.ws.Close()
+}
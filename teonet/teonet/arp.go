@@ -88,15 +88,20 @@ func (arp *arp) peerNew(rec *receiveData) (peerArp *arpData) {
 	arp.mx.Unlock()
 	arp.print()
 	arp.teo.sendToTcd(rec.tcd, CmdNone, []byte{0})
-	arp.teo.sendToTcd(rec.tcd, CmdHostInfo, []byte{0})
 	go func() {
+		// Resend host info request on timeout: it may be lost when trudp
+		// channel reset clears send queue (after reconnect in lossy network)
 		for {
+			arp.teo.sendToTcd(rec.tcd, CmdHostInfo, []byte{0})
 			r := <-arp.teo.WaitFrom(peer, CmdHostInfoAnswer)
 			if r.Err == nil {
 				arp.teo.ev.send(EventConnected,
 					arp.teo.PacketCreateNew(peer, 0, nil))
 				break
 			}
+			if _, ok := arp.find(rec.tcd); !ok {
+				break
+			}
 		}
 	}()
 	return
@@ -364,12 +369,19 @@ type peersDataArJSON struct {
 }
 
 // binaryToJSON convert binary peers array to JSON format
-func (arp *arp) binaryToJSON(indata []byte) (data []byte, peersDataArLen int) {
+func (arp *arp) binaryToJSON(indata []byte) (data []byte, peersDataArLen int,
+	err error) {
 	peersDataAr := peersDataArJSON{}
 	buf := bytes.NewReader(indata)
 	le := binary.LittleEndian
 	var numOfPeers uint32
-	binary.Read(buf, le, &numOfPeers) // Number of peers
+	if err = binary.Read(buf, le, &numOfPeers); err != nil { // Number of peers
+		return
+	}
+	if int64(numOfPeers)*int64(teocli.PeerDataLength()) > int64(buf.Len()) {
+		err = errors.New("wrong peers array length")
+		return
+	}
 	for i := 0; i < int(numOfPeers); i++ {
 		peerData := make([]byte, teocli.PeerDataLength())
 		binary.Read(buf, le, peerData)
@@ -380,11 +392,7 @@ func (arp *arp) binaryToJSON(indata []byte) (data []byte, peersDataArLen int) {
 	}
 	peersDataAr.Length = int(numOfPeers)
 	peersDataArLen = int(numOfPeers)
-	var err error
 	data, err = json.Marshal(peersDataAr)
-	if err != nil {
-		//
-	}
 	//data = append(data, 0) // add trailing zero (cstring)
 	//fmt.Printf("binaryToJSON: %s\n", string(data))
 	return
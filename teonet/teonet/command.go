@@ -46,6 +46,7 @@ const (
 	CmdHostInfo           = C.CMD_HOST_INFO           // #90 Request host info, allow JSON in request
 	CmdHostInfoAnswer     = C.CMD_HOST_INFO_ANSWER    // #91 Request host info, allow JSON in request
 	CmdL0Auth             = C.CMD_L0_AUTH             // #96 L0 server auth request answer command
+	CmdL0Error            = C.CMD_L0_ERROR            // #101 L0 server error answer command
 	CmdUser               = C.CMD_USER                // #129 User command
 )
 
@@ -277,28 +278,49 @@ func (com *command) hostInfo(rec *receiveData) (err error) {
 	return
 }
 
-// hostInfoAnswer process 'hostInfoAnswer' command and add host info to the arp table
-func (com *command) hostInfoAnswer(rec *receiveData) (err error) {
-	data := rec.rd.Data()
-	var typeAr []string
-	var version string
+// parseHostInfo parse 'hostInfoAnswer' command data in json or binary format
+// and return host version and types array (first element is host name)
+func parseHostInfo(data []byte) (version string, typeAr []string, err error) {
 
 	// Parse json or binary format depend of data.
 	// If first char = '{' and last char = '}' than data is in json
 	if l := len(data); l > 3 && data[0] == '{' && data[l-2] == '}' && data[l-1] == 0 {
 		var j hostInfo
-		json.Unmarshal(data, &j)
+		if err = json.Unmarshal(data[:l-1], &j); err != nil {
+			return
+		}
 		version = j.Version
 		typeAr = append([]string{j.Name}, j.Type...)
-	} else {
-		version = strconv.Itoa(int(data[0])) + "." + strconv.Itoa(int(data[1])) + "." + strconv.Itoa(int(data[2]))
-		typeArLen := int(data[3])
-		ptr := 4
-		for i := 0; i < typeArLen; i++ {
-			charPtr := unsafe.Pointer(&data[ptr])
-			typeAr = append(typeAr, C.GoString((*C.char)(charPtr)))
-			ptr += len(typeAr[i]) + 1
+		return
+	}
+
+	// Binary format: version (3 bytes), types array length (1 byte) and types
+	// array of zero terminated strings
+	if len(data) < 4 || data[3] == 0 {
+		err = errors.New("wrong host info length")
+		return
+	}
+	version = strconv.Itoa(int(data[0])) + "." + strconv.Itoa(int(data[1])) + "." + strconv.Itoa(int(data[2]))
+	typeArLen := int(data[3])
+	data = data[4:]
+	for i := 0; i < typeArLen; i++ {
+		l := bytes.IndexByte(data, 0)
+		if l < 0 {
+			err = errors.New("wrong host info types array")
+			return
 		}
+		typeAr = append(typeAr, string(data[:l]))
+		data = data[l+1:]
+	}
+	return
+}
+
+// hostInfoAnswer process 'hostInfoAnswer' command and add host info to the arp table
+func (com *command) hostInfoAnswer(rec *receiveData) (err error) {
+	version, typeAr, err := parseHostInfo(rec.rd.Data())
+	if err != nil {
+		com.error(rec.rd, "CMD_HOST_INFO_ANSWER command processed with error: "+err.Error())
+		return
 	}
 
 	// Save to arp Table
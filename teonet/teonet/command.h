@@ -68,6 +68,7 @@ enum ksnCMD {
   CMD_L0_CLIENT_RESET, ///< #99 L0 client reset command
   CMD_SUBSCRIBE_RND, ///< #100 Subscribe command extension. (Send answer for one
                      ///< random peer by type)
+  CMD_L0_ERROR,      ///< #101 L0 server error answer command
 
   // Application level TR-UDP mode: 128...191
   CMD_128_RESERVED = 128, ///< #128 Reserver for future use
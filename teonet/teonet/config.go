@@ -9,12 +9,14 @@
 package teonet
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 
 	"github.com/kirill-scherba/teonet-go/services/teoapi"
+	"github.com/kirill-scherba/teonet-go/trudp/trudp"
 )
 
 // Parameters Teonet parameters
@@ -42,6 +44,37 @@ type Parameters struct {
 	L0tcpPort        int    `json:"l0-tcp-port"`      // l0 Server tcp port number (default 9000)
 	L0wsAllow        bool   `json:"l0-ws-allow"`      // allow l0 WebSocket server
 	L0wsPort         int    `json:"l0-ws-port"`       // l0 Server websocket tcp port number (default 9080)
+	L0tlsCert        string `json:"l0-tls-cert"`      // l0 Server TLS certificate file (enable TLS for tcp and websocket servers)
+	L0tlsKey         string `json:"l0-tls-key"`       // l0 Server TLS private key file
+	L0auth           string `json:"l0-auth"`          // l0 clients authenticator: peer, none, file:path or http(s) url (default teonet peers if connected)
+	L0authPeer       string `json:"l0-auth-peer"`     // l0 clients auth peer name (default teo-auth)
+	L0registrar      string `json:"l0-registrar"`     // l0 clients users registrar peer name (default teo-cdb)
+	L0authAPI        string `json:"l0-auth-api"`      // l0 auth HTTP server api url used by auth command
+	L0jwtKey         string `json:"l0-jwt-key"`       // l0 clients JWT login keys files: Ed25519 public key PEM or HS256 secret (comma separated)
+	L0jwtIssuer      string `json:"l0-jwt-issuer"`    // l0 clients JWT login valid issuer
+	L0jwtAudience    string `json:"l0-jwt-audience"`  // l0 clients JWT login valid audience
+	L0limitMsgs      int    `json:"l0-limit-msgs"`    // l0 client max messages per second (0 - unlimited)
+	L0limitBytes     int    `json:"l0-limit-bytes"`   // l0 client max bytes per second (0 - unlimited)
+	L0limitCmd       string `json:"l0-limit-cmd"`     // l0 client max messages per second of commands: cmd:rate,... (e.g. 129:10,130:5)
+	L0limitSize      int    `json:"l0-limit-size"`    // l0 client max message data size (0 - unlimited)
+	L0limitAction    string `json:"l0-limit-action"`  // l0 client limit exceeded action: drop, error or disconnect (default drop)
+	L0confReload     int    `json:"l0-conf-reload"`   // l0 configuration (ACL rules) reload from teo-cdb interval in seconds (0 - read when teo-cdb connected only)
+	TrudpCookie      bool   `json:"trudp-cookie"`     // create trudp channels after handshake cookie checked
+	TrudpMaxChannels int    `json:"trudp-max-ch"`     // max number of trudp channels (0 - unlimited)
+	TrudpMaxChanIP   int    `json:"trudp-max-ch-ip"`  // max number of trudp channels from one IP (0 - unlimited)
+	TrudpPMTU        bool   `json:"trudp-pmtu"`       // enable trudp channels path MTU discovery (set don't fragment flag on node socket)
+
+	// Transport is the trudp packet transport used instead of UDP (in memory
+	// network in tests or user provided connection)
+	Transport trudp.PacketTransport `json:"-"`
+
+	// L0tlsConfig is the l0 server TLS configuration used instead of
+	// L0tlsCert and L0tlsKey files
+	L0tlsConfig *tls.Config `json:"-"`
+
+	// L0Authenticator is the l0 clients authenticator used instead of
+	// authenticator selected by L0auth parameter
+	L0Authenticator Authenticator `json:"-"`
 }
 
 // Params read Teonet parameters from configuration file and parse application
@@ -80,7 +113,26 @@ func Params(apiiII ...interface{}) (param *Parameters) {
 	flag.IntVar(&param.L0tcpPort, "l0-tcp-port", param.L0tcpPort, "l0 server tcp port number")
 	flag.BoolVar(&param.L0wsAllow, "l0-ws-allow", param.L0wsAllow, "allow l0 websocket server")
 	flag.IntVar(&param.L0wsPort, "l0-ws-port", param.L0wsPort, "l0 websocket server tcp port number")
+	flag.StringVar(&param.L0tlsCert, "l0-tls-cert", param.L0tlsCert, "l0 server TLS certificate file (enable TLS for tcp and websocket servers)")
+	flag.StringVar(&param.L0tlsKey, "l0-tls-key", param.L0tlsKey, "l0 server TLS private key file")
+	flag.StringVar(&param.L0auth, "l0-auth", param.L0auth, "l0 clients authenticator: peer, none, file:path or http(s) url (default teonet peers if connected)")
+	flag.StringVar(&param.L0authPeer, "l0-auth-peer", param.L0authPeer, "l0 clients auth peer name")
+	flag.StringVar(&param.L0registrar, "l0-registrar", param.L0registrar, "l0 clients users registrar peer name")
+	flag.StringVar(&param.L0authAPI, "l0-auth-api", param.L0authAPI, "l0 auth HTTP server api url used by auth command")
+	flag.StringVar(&param.L0jwtKey, "l0-jwt-key", param.L0jwtKey, "l0 clients JWT login keys files: Ed25519 public key PEM or HS256 secret (comma separated)")
+	flag.StringVar(&param.L0jwtIssuer, "l0-jwt-issuer", param.L0jwtIssuer, "l0 clients JWT login valid issuer")
+	flag.StringVar(&param.L0jwtAudience, "l0-jwt-audience", param.L0jwtAudience, "l0 clients JWT login valid audience")
+	flag.IntVar(&param.L0limitMsgs, "l0-limit-msgs", param.L0limitMsgs, "l0 client max messages per second (0 - unlimited)")
+	flag.IntVar(&param.L0limitBytes, "l0-limit-bytes", param.L0limitBytes, "l0 client max bytes per second (0 - unlimited)")
+	flag.StringVar(&param.L0limitCmd, "l0-limit-cmd", param.L0limitCmd, "l0 client max messages per second of commands: cmd:rate,... (e.g. 129:10,130:5)")
+	flag.IntVar(&param.L0limitSize, "l0-limit-size", param.L0limitSize, "l0 client max message data size (0 - unlimited)")
+	flag.StringVar(&param.L0limitAction, "l0-limit-action", param.L0limitAction, "l0 client limit exceeded action: drop, error or disconnect")
+	flag.IntVar(&param.L0confReload, "l0-conf-reload", param.L0confReload, "l0 configuration (ACL rules) reload from teo-cdb interval in seconds (0 - read when teo-cdb connected only)")
 	flag.BoolVar(&param.DisallowEncrypt, "disable-encrypt", param.DisallowEncrypt, "disable teonet packets encryption")
+	flag.BoolVar(&param.TrudpCookie, "trudp-cookie", param.TrudpCookie, "create trudp channels after handshake cookie checked")
+	flag.IntVar(&param.TrudpMaxChannels, "trudp-max-ch", param.TrudpMaxChannels, "max number of trudp channels (0 - unlimited)")
+	flag.IntVar(&param.TrudpMaxChanIP, "trudp-max-ch-ip", param.TrudpMaxChanIP, "max number of trudp channels from one IP (0 - unlimited)")
+	flag.BoolVar(&param.TrudpPMTU, "trudp-pmtu", param.TrudpPMTU, "enable trudp channels path MTU discovery (set don't fragment flag on node socket)")
 
 	// Teonet api flags
 	var showAPI bool
@@ -156,21 +208,21 @@ func (param *Parameters) setDefault() {
 	param.Loglevel = "DEBUG"
 	param.CtrlcF = true
 	param.ShowParametersF = true
+	param.L0authPeer = "teo-auth"
+	param.L0registrar = "teo-cdb"
+	param.L0authAPI = "http://teomac.ksproject.org:1234/api/auth/"
+	param.L0limitAction = "drop"
+	param.L0confReload = 30
 }
 
 // read read teonet parameters from selected configuration file
 func (param *Parameters) read(fileName string) {
 	confDir := param.configDir()
-	f, err := os.Open(confDir + fileName)
+	data, err := os.ReadFile(confDir + fileName)
 	if err != nil {
 		return
 	}
-	data := make([]byte, 1024)
-	n, err := f.Read(data)
-	if err != nil {
-		return
-	}
-	json.Unmarshal(data[:n], param)
+	json.Unmarshal(data, param)
 }
 
 // println print teonet parameters
@@ -42,6 +42,14 @@ func (cry *crypt) destroy() {
 	}
 }
 
+// overhead return max length added to packet by encrypt
+func (cry *crypt) overhead() int {
+	if cry.kcr == nil || cry.teo.param.DisallowEncrypt {
+		return 0
+	}
+	return int(C.ksnCryptGetBlockSize(cry.kcr)) + C.sizeof_size_t
+}
+
 // encryptp Encryptp teonet packet
 func (cry *crypt) encrypt(packet []byte) []byte {
 	if cry.kcr == nil || cry.teo.param.DisallowEncrypt {
@@ -12,10 +12,12 @@
 package teonet
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"strconv"
 	"sync"
+	"sync/atomic"
 
 	"github.com/kirill-scherba/teonet-go/teocli/teocli"
 	"github.com/kirill-scherba/teonet-go/teolog/teolog"
@@ -26,22 +28,27 @@ const notL0ServerError = "can't process this command because I'm not L0 server"
 
 // l0Conn is Module data structure
 type l0Conn struct {
-	teo     *Teonet            // Pointer to Teonet
-	stat    *l0Stat            // Statistic
-	auth    *l0AuthCom         // Authentication
-	param   *paramConf         // Config parameters
-	allow   bool               // Allow L0 Server
-	wsAllow bool               // Allow L0 websocket server
-	wsConn  *wsConn            // Websocket server connector
-	wsPort  int                // Websocket TCP port (if 0 - not allowed websocket)
-	tcpPort int                // TCP port (if 0 - not allowed TCP)
-	conn    net.Listener       // TCP listener connection
-	ch      chan *packet       // Packet processing channel
-	ma      map[string]*client // Clients address map
-	mn      map[string]*client // Clients name map
-	mux     sync.Mutex         // Maps mutex
-	closed  bool               // Closet flag
-	reqID   uint32             // Request ID
+	teo           *Teonet            // Pointer to Teonet
+	stat          *l0Stat            // Statistic
+	auth          *l0AuthCom         // Authentication
+	authenticator Authenticator      // Clients login authenticator (nil - no authentication)
+	authPeer      *authPeer          // Teonet peers authenticator (may be wrapped in authenticator)
+	limits        *l0Limits          // Clients rate limits (nil - unlimited)
+	acl           atomic.Value       // Clients ACL rules (*l0ACL)
+	param         *paramConf         // Config parameters
+	allow         bool               // Allow L0 Server
+	wsAllow       bool               // Allow L0 websocket server
+	wsConn        *wsConn            // Websocket server connector
+	wsPort        int                // Websocket TCP port (if 0 - not allowed websocket)
+	tcpPort       int                // TCP port (if 0 - not allowed TCP)
+	conn          net.Listener       // TCP listener connection
+	tls           *tls.Config        // TLS config of TCP and websocket servers (nil - TLS does not used)
+	ch            chan *packet       // Packet processing channel
+	ma            map[string]*client // Clients address map
+	mn            map[string]*client // Clients name map
+	mux           sync.Mutex         // Maps mutex
+	closed        bool               // Closet flag
+	reqID         uint32             // Request ID
 }
 
 // packet is Packet processing channels data structure
@@ -72,10 +79,34 @@ func (teo *Teonet) l0New() *l0Conn {
 		l0.auth = l0.authNew()        // Authenticate module
 		l0.param = l0.parametersNew() // Configuration parameters module
 
+		// Clients login authenticator. Reject all logins when authenticator
+		// parameters are wrong
+		var err error
+		if l0.authenticator, err = l0.authenticatorNew(); err != nil {
+			teolog.Error(MODULE, err)
+			l0.authenticator = AuthFunc(func(string) (*AuthResult, error) {
+				return nil, err
+			})
+		}
+
+		// Clients rate limits. Drop all clients messages when limits
+		// parameters are wrong
+		if l0.limits, err = l0.limitsNew(); err != nil {
+			teolog.Error(MODULE, err)
+			l0.limits = &l0Limits{action: limitDrop, deny: true}
+		}
+
 		// Start L0 pocessing
 		l0.ma = make(map[string]*client)
 		l0.mn = make(map[string]*client)
 		l0.process()
+		// TLS config of tcp and websocket l0 servers. Don't start this
+		// servers with wrong TLS parameters to not send clients
+		// credentials in clear text
+		if l0.tls, err = l0.tlsConfig(); err != nil {
+			teolog.Error(MODULE, "l0 server TLS config error:", err)
+			l0.tcpPort, l0.wsPort = 0, 0
+		}
 		// Start udp l0 server
 		if l0.allow {
 			teolog.Connect(MODULE, "l0 server start listen udp port:", l0.teo.param.Port)
@@ -125,6 +156,24 @@ func (l0 *l0Conn) network(client *client) (network string) {
 	return
 }
 
+// tlsConfig return TLS config of tcp and websocket l0 servers from teonet
+// parameters or nil if TLS certificate does not set
+func (l0 *l0Conn) tlsConfig() (config *tls.Config, err error) {
+	param := l0.teo.param
+	switch {
+	case param.L0tlsConfig != nil:
+		config = param.L0tlsConfig
+	case param.L0tlsCert != "" || param.L0tlsKey != "":
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(param.L0tlsCert, param.L0tlsKey)
+		if err != nil {
+			return
+		}
+		config = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	return
+}
+
 // tcpServer TCP L0 server
 func (l0 *l0Conn) tcpServer(port *int) {
 
@@ -149,12 +198,17 @@ func (l0 *l0Conn) tcpServer(port *int) {
 	if *port == 0 {
 		*port = l0.conn.Addr().(*net.TCPAddr).Port
 	}
-	teolog.Connect(MODULE, "l0 server start listen tcp port:", *port)
+	if l0.tls != nil {
+		l0.conn = tls.NewListener(l0.conn, l0.tls)
+		teolog.Connect(MODULE, "l0 server start listen tcp (tls) port:", *port)
+	} else {
+		teolog.Connect(MODULE, "l0 server start listen tcp port:", *port)
+	}
 
 	// Listen for an incoming connection
-	go func(port int) {
+	go func(ln net.Listener, port int) {
 		for {
-			conn, err := l0.conn.Accept()
+			conn, err := ln.Accept()
 			if err != nil {
 				//teolog.Debug(MODULE, "stop accepting: ", err.Error())
 				break
@@ -163,7 +217,7 @@ func (l0 *l0Conn) tcpServer(port *int) {
 			go l0.handleConnection(conn)
 		}
 		teolog.Connect(MODULE, "l0 server stop listen tcp port:", port)
-	}(*port)
+	}(l0.conn, *port)
 }
 
 // Handle TCP connection
@@ -178,7 +232,10 @@ func (l0 *l0Conn) handleConnection(conn net.Conn) {
 		}
 		teolog.DebugVvf(MODULE, "got %d bytes data from tcp clien: %v\n",
 			n, conn.RemoteAddr().String())
-		l0.packetCheck(cli, conn.RemoteAddr().String(), conn, b[:n])
+		// Packets are processed in other goroutine, so don't share read
+		// buffer with them
+		data := append([]byte(nil), b[:n]...)
+		l0.packetCheck(cli, conn.RemoteAddr().String(), conn, data)
 	}
 	teolog.Connectf(MODULE, "l0 server tcp client %v disconnected...", conn.RemoteAddr())
 	if !l0.closeAddr(conn.RemoteAddr().String()) {
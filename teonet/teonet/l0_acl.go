@@ -0,0 +1,147 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Teonet L0 server clients access control lists module.
+//
+// ACL rules are read from L0 configuration (acl key). Each rule selects
+// clients by name prefixes and authenticated roles and allows them to send
+// commands to peers selected by names and application types. When ACL rules
+// are set, client messages which are not allowed by any rule are dropped and
+// answered with error (CMD_L0_ERROR command). Without rules all messages are
+// allowed.
+
+package teonet
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+// aclRule is L0 configuration ACL rule
+type aclRule struct {
+	Clients []string `json:"clients,omitempty"` // Clients names prefixes ("*" or empty - any client)
+	Roles   []string `json:"roles,omitempty"`   // Clients roles (empty - any roles)
+	Peers   []string `json:"peers,omitempty"`   // Allowed peers names ("*" - any peer)
+	Types   []string `json:"types,omitempty"`   // Allowed peers application types
+	Cmds    []int    `json:"cmds,omitempty"`    // Allowed commands (empty - any command)
+}
+
+// l0ACL is l0 server ACL rules
+type l0ACL struct {
+	rules []aclRule
+}
+
+// aclContains return true if list contains s or "*"
+func aclContains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// client return true if rule selects client with name and roles
+func (r *aclRule) client(name string, roles []string) bool {
+	if len(r.Clients) > 0 {
+		var ok bool
+		for _, prefix := range r.Clients {
+			if prefix == "*" || strings.HasPrefix(name, prefix) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(r.Roles) > 0 {
+		for _, role := range roles {
+			if aclContains(r.Roles, role) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// allow return true if rule allows command to peer with application types
+func (r *aclRule) allow(peer string, types []string, cmd byte) bool {
+	if len(r.Peers) > 0 || len(r.Types) > 0 {
+		ok := aclContains(r.Peers, peer)
+		for i := 0; !ok && i < len(types); i++ {
+			ok = aclContains(r.Types, types[i])
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(r.Cmds) > 0 {
+		for _, c := range r.Cmds {
+			if c == int(cmd) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// allow return true if ACL allows client command to peer
+func (acl *l0ACL) allow(name string, roles []string, peer string,
+	types []string, cmd byte) bool {
+	for i := range acl.rules {
+		r := &acl.rules[i]
+		if r.client(name, roles) && r.allow(peer, types, cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// aclSet set new l0 server ACL rules, empty rules allows all messages
+func (l0 *l0Conn) aclSet(rules []aclRule) {
+	acl := &l0ACL{}
+	if len(rules) > 0 {
+		acl.rules = append([]aclRule(nil), rules...)
+	}
+	if old, ok := l0.acl.Load().(*l0ACL); ok &&
+		reflect.DeepEqual(old.rules, acl.rules) {
+		return
+	}
+	l0.acl.Store(acl)
+	teolog.Connectf(MODULE, "l0 ACL loaded, %d rules\n", len(acl.rules))
+}
+
+// access check client message to peer by ACL rules and send error answer
+// when message is not allowed, it returns false if message should not be sent
+func (l0 *l0Conn) access(client *client, to string, cmd byte) bool {
+	acl, ok := l0.acl.Load().(*l0ACL)
+	if !ok || len(acl.rules) == 0 {
+		return true
+	}
+	l0.mux.Lock()
+	name, roles := client.name, client.roles
+	l0.mux.Unlock()
+	var types []string
+	if peerArp, ok := l0.teo.arp.find(to); ok {
+		types = peerArp.appType
+	}
+	if acl.allow(name, roles, to, types, cmd) {
+		return true
+	}
+	teolog.Debugf(MODULE, "client %s access denied, cmd: %d, to: %s\n", name,
+		cmd, to)
+	data, _ := json.Marshal(struct {
+		Error string `json:"error"`
+		To    string `json:"to"`
+		Cmd   byte   `json:"cmd"`
+	}{"access denied", to, cmd})
+	l0.sendTo("", name, CmdL0Error, data)
+	return false
+}
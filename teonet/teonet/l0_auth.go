@@ -9,7 +9,7 @@ package teonet
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -28,11 +28,12 @@ func (l0 *l0Conn) authNew() (auth *l0AuthCom) {
 	return &l0AuthCom{l0, l0.teo}
 }
 
-// cmdAuth process command CMD_AUTH (#77 Auth command) received from
+// cmdAuth process command CMD_AUTH (#77 Auth command) received from peer or
+// l0 client: send HTTP request to teonet auth server api (l0-auth-api
+// parameter) and send answer with HTTP status and answer data. The status is
+// 502 (Bad Gateway) and data is {"error": error} when request failed.
 func (auth *l0AuthCom) cmdAuth(rec *receiveData) {
 	auth.teo.com.log(rec.rd, "CMD_AUTH command")
-	fmt.Printf("CMD_AUTH command, from: %s, data: %s\n%v\n",
-		rec.rd.From(), string(rec.rd.Data()), rec.rd.Data())
 
 	type authDataIn struct {
 		Data    interface{} `json:"data"`
@@ -46,43 +47,64 @@ func (auth *l0AuthCom) cmdAuth(rec *receiveData) {
 		Status int         `json:"status"`
 	}
 
+	// Send answer
+	answer := func(status int, data interface{}) {
+		jdataOutData, _ := json.Marshal(authDataOut{Status: status, Data: data})
+		auth.teo.sendAnswer(rec, cmdAuthAnswer, jdataOutData)
+	}
+	answerError := func(err error) {
+		teolog.Error(MODULE, "CMD_AUTH command error:", err)
+		answer(http.StatusBadGateway, struct {
+			Error string `json:"error"`
+		}{err.Error()})
+	}
+
 	// Parse json (and Remove trailing zero first)
 	jauth := authDataIn{}
-	json.Unmarshal(auth.teo.com.removeTrailingZero(rec.rd.Data()), &jauth)
+	data := auth.teo.com.removeTrailingZero(rec.rd.Data())
+	if err := json.Unmarshal(data, &jauth); err != nil {
+		answerError(err)
+		return
+	}
 
 	// Create html request to teonet auth server
 	jdata, _ := json.Marshal(jauth.Data)
-	req, _ := http.NewRequest(
-		jauth.Method,
-		// \TODO: add teonet l0 authentication server url to parameters (defaults and configuration)
-		"http://teomac.ksproject.org:1234/api/auth/"+jauth.URL,
-		bytes.NewBuffer(jdata),
-	)
+	req, err := http.NewRequest(jauth.Method, auth.teo.param.L0authAPI+jauth.URL,
+		bytes.NewBuffer(jdata))
+	if err != nil {
+		answerError(err)
+		return
+	}
 	if jauth.Headers != "" {
-		h := strings.Split(jauth.Headers, ": ")
+		h := strings.SplitN(jauth.Headers, ": ", 2)
+		if len(h) != 2 {
+			answerError(errors.New("wrong headers: " + jauth.Headers))
+			return
+		}
 		req.Header.Set(h[0], h[1])
-		fmt.Println(h[0], h[1])
 	}
 	req.Header.Set("Content-Type", "application/json")
-	fmt.Println(req) // \TODO (to delete it) Print request
+	teolog.Debugf(MODULE, "CMD_AUTH request: %s %s\n", req.Method, req.URL)
 
 	// Send request and get result
-	client := &http.Client{}
+	client := &http.Client{Timeout: authTimeout}
 	resp, err := client.Do(req)
 	if err != nil {
-		// \TODO replace panic to thomething valid
-		panic(err)
+		answerError(err)
+		return
 	}
 	defer resp.Body.Close()
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println(resp, "\n", string(body), "\n", resp.StatusCode) // \TODO (to delete it) Print responce
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		answerError(err)
+		return
+	}
+	teolog.Debugf(MODULE, "CMD_AUTH answer: %d %s\n", resp.StatusCode, body)
 
 	// Send answer
 	var jbody interface{}
 	json.Unmarshal(body, &jbody)
-	jdataOut := authDataOut{Status: resp.StatusCode, Data: jbody}
-	jdataOutData, _ := json.Marshal(jdataOut)
-	auth.teo.sendAnswer(rec, cmdAuthAnswer, jdataOutData)
+	answer(resp.StatusCode, jbody)
 }
 
 // cmdL0Auth Check l0 client answer from authentication application
@@ -106,23 +128,29 @@ func (auth *l0AuthCom) cmdL0Auth(rec *receiveData) {
 	var user map[string]interface{}
 	userJSON, _ := json.Marshal(j.User)
 	json.Unmarshal([]byte(userJSON), &user)
-	userID := user["userId"]
-	clientID := user["clientId"]
+	userID, _ := user["userId"].(string)
+	clientID, _ := user["clientId"].(string)
 	teolog.Debugf(MODULE,
 		"got access token from auth: d: %s, accessToken: %s, userId: %s, clientId: %s\n",
 		string(rec.rd.Data()), j.AccessToken, userID, clientID)
 
 	// Define new name for this client
 	var name string
-	if userID != nil && clientID != nil {
-		name = userID.(string) + ":" + clientID.(string)
+	if userID != "" && clientID != "" {
+		name = userID + ":" + clientID
 	} else {
 		name = j.AccessToken
 	}
 
-	// Send to client and rename
+	// Send answer to authenticator waiting for it, or send to client and
+	// rename
 	var jt = authToJSON{Name: name, Networks: j.Networks}
 	jdata, _ := json.Marshal(jt)
-	auth.l0.sendTo(rec.rd.From(), j.AccessToken, rec.rd.Cmd(), jdata)
+	res := &AuthResult{Name: name, From: rec.rd.From(), Cmd: rec.rd.Cmd(),
+		Data: jdata}
+	if a := auth.l0.authPeer; a != nil && a.answer(j.AccessToken, res) {
+		return
+	}
+	auth.l0.sendTo(res.From, j.AccessToken, res.Cmd, res.Data)
 	auth.l0.rename(j.AccessToken, name)
 }
@@ -0,0 +1,335 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Teonet L0 server clients authentication module.
+//
+// The L0 server authenticates login of connected clients with Authenticator
+// selected by the l0-auth parameter: teonet peers (users registrar and auth
+// peer), HTTP authentication server or static users file. The client is
+// renamed to its teonet name when authentication succeeded, or gets error
+// answer and disconnected when authentication failed.
+
+package teonet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/kirill-scherba/teonet-go/services/teouserscli"
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+// Authenticator authenticates L0 clients login
+type Authenticator interface {
+	// Auth check client login and return authentication result, or error if
+	// login is not valid. The nil result accepts login without answer.
+	Auth(login string) (*AuthResult, error)
+}
+
+// AuthResult is client authentication result
+type AuthResult struct {
+	Name string // Client name in teonet (empty - login is used)
+	From string // Login answer sender (empty - L0 server)
+	Cmd  byte   // Login answer command
+	Data []byte // Login answer data (nil - answer is not sent)
+
+	Roles []string // Client roles used in L0 ACL rules
+}
+
+// AuthFunc is function adapter to use ordinary function as Authenticator
+type AuthFunc func(login string) (*AuthResult, error)
+
+// Auth calls f(login)
+func (f AuthFunc) Auth(login string) (*AuthResult, error) {
+	return f(login)
+}
+
+// ErrAuthDenied returned by authenticators when login is not valid
+var ErrAuthDenied = errors.New("authentication denied")
+
+// Authenticators default timeout
+const authTimeout = 20 * time.Second
+
+// authAnswer is login answer data of HTTP and file authenticators
+type authAnswer struct {
+	Name  string          `json:"name"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Roles []string        `json:"roles,omitempty"`
+}
+
+// answer return authentication result with login answer
+func (a *authAnswer) answer(login string) (res *AuthResult, err error) {
+	if a.Name == "" {
+		a.Name = login
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	return &AuthResult{Name: a.Name, Cmd: CmdL0Auth, Data: data,
+		Roles: a.Roles}, nil
+}
+
+// AuthHTTP authenticates clients by HTTP authentication server. It sends
+// POST request with JSON {"login": login} to the URL, the server should
+// answer with status 200 and JSON {"name": name, "data": data} where name is
+// client name in teonet (login is used if empty) and data is any JSON sent
+// to client in login answer. The optional "roles" array is client roles used
+// in L0 ACL rules.
+type AuthHTTP struct {
+	URL    string       // Authentication server url
+	Client *http.Client // HTTP client (default client with 20 seconds timeout)
+}
+
+// Auth check client login by HTTP authentication server
+func (a *AuthHTTP) Auth(login string) (res *AuthResult, err error) {
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: authTimeout}
+	}
+	req, _ := json.Marshal(struct {
+		Login string `json:"login"`
+	}{login})
+	resp, err := client.Post(a.URL, "application/json", bytes.NewReader(req))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized ||
+		resp.StatusCode == http.StatusForbidden:
+		return nil, ErrAuthDenied
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("authentication server answer: %s",
+			resp.Status)
+	}
+	var a0 authAnswer
+	if err = json.Unmarshal(body, &a0); err != nil {
+		return nil, fmt.Errorf("wrong authentication server answer: %s", err)
+	}
+	return a0.answer(login)
+}
+
+// AuthFile authenticates clients by static users file. The file is JSON
+// object with logins keys and {"name": name, "data": data} values where name
+// is client name in teonet (login is used if empty) and data is any JSON
+// sent to client in login answer, optional "roles" array is client roles used
+// in L0 ACL rules. The file is read in each Auth call, so it may be changed
+// without L0 server restart.
+type AuthFile struct {
+	Path string // Users file path
+}
+
+// Auth check client login in users file
+func (a *AuthFile) Auth(login string) (res *AuthResult, err error) {
+	data, err := os.ReadFile(a.Path)
+	if err != nil {
+		return
+	}
+	var users map[string]authAnswer
+	if err = json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("wrong users file %s: %s", a.Path, err)
+	}
+	user, ok := users[login]
+	if !ok {
+		return nil, ErrAuthDenied
+	}
+	return user.answer(login)
+}
+
+// authPeer authenticates clients by teonet peers: logins with users
+// registrar prefix (from L0 configuration) are registered by users registrar,
+// other logins are access tokens checked by auth peer
+type authPeer struct {
+	l0        *l0Conn
+	registrar string                      // Users registrar peer name
+	peer      string                      // Auth peer name
+	optional  bool                        // Accept login when auth peer is not connected or does not answer
+	mx        sync.Mutex                  // Wait map mutex
+	wait      map[string]chan *AuthResult // Logins waiting for auth peer answer
+}
+
+// authenticatorNew create authenticator selected by l0 parameters: empty
+// string - teonet peers if auth peer connected, 'peer' - teonet peers, 'none' -
+// no authentication, 'file:path' - users file, http(s) url - HTTP
+// authentication server. JWT logins are validated locally when l0-jwt-key
+// parameter set.
+func (l0 *l0Conn) authenticatorNew() (auth Authenticator, err error) {
+	param := l0.teo.param
+	if param.L0Authenticator != nil {
+		return param.L0Authenticator, nil
+	}
+	switch a := param.L0auth; {
+	case a == "" || a == "peer":
+		l0.authPeer = &authPeer{l0: l0, registrar: param.L0registrar,
+			peer: param.L0authPeer, optional: a == "",
+			wait: make(map[string]chan *AuthResult)}
+		auth = l0.authPeer
+	case a == "none":
+	case strings.HasPrefix(a, "file:"):
+		auth = &AuthFile{Path: strings.TrimPrefix(a, "file:")}
+	case strings.HasPrefix(a, "http://") || strings.HasPrefix(a, "https://"):
+		auth = &AuthHTTP{URL: a}
+	default:
+		err = fmt.Errorf("wrong l0 authenticator '%s'", a)
+		return
+	}
+	if param.L0jwtKey != "" {
+		jwt := &AuthJWT{Issuer: param.L0jwtIssuer,
+			Audience: param.L0jwtAudience, Next: auth}
+		if jwt.Keys, err = jwtKeysRead(param.L0jwtKey); err != nil {
+			return
+		}
+		auth = jwt
+	}
+	return
+}
+
+// login authenticate client login, rename client to its teonet name and send
+// login answer, or send error answer and disconnect client when
+// authentication failed. Packets received from client while authentication
+// is pending are forwarded when client logged in.
+func (l0 *l0Conn) login(client *client) {
+	if l0.authenticator == nil {
+		return
+	}
+	login := client.name
+	res, err := l0.authenticator.Auth(login)
+	if err != nil {
+		teolog.Errorf(MODULE, "client %s authentication failed: %s\n", login,
+			err)
+		data, _ := json.Marshal(struct {
+			Error string `json:"error"`
+		}{err.Error()})
+		l0.sendTo("", login, CmdL0Auth, data)
+		l0.close(client)
+		return
+	}
+	if res == nil {
+		l0.loginDone(client)
+		return
+	}
+	name := login
+	if res.Name != "" {
+		l0.rename(login, res.Name)
+		name = res.Name
+	}
+	if res.Roles != nil {
+		l0.mux.Lock()
+		client.roles = res.Roles
+		l0.mux.Unlock()
+	}
+	if res.Data != nil {
+		l0.sendTo(res.From, name, res.Cmd, res.Data)
+	}
+	l0.loginDone(client)
+}
+
+// Auth check client login by users registrar or auth peer
+func (a *authPeer) Auth(login string) (res *AuthResult, err error) {
+	if a.l0.param != nil {
+		for _, p := range a.l0.param.current().Prefix {
+			if strings.HasPrefix(login, p) {
+				return a.register(login)
+			}
+		}
+	}
+
+	// Send login (access token) to auth peer and wait its CMD_L0_AUTH answer
+	ch := make(chan *AuthResult, 1)
+	a.mx.Lock()
+	a.wait[login] = ch
+	a.mx.Unlock()
+	defer func() {
+		a.mx.Lock()
+		delete(a.wait, login)
+		a.mx.Unlock()
+	}()
+	teolog.Debugf(MODULE, "login command, send to auth: %s, data: %s\n",
+		a.peer, login)
+	if _, err = a.l0.teo.SendTo(a.peer, CmdUser, append([]byte(login), 0)); err != nil {
+		if a.optional {
+			return nil, nil
+		}
+		return
+	}
+	select {
+	case res = <-ch:
+	case <-time.After(authTimeout):
+		if a.optional {
+			teolog.Debugf(MODULE,
+				"does not receive answer from auth peer %s, accept login: %s\n",
+				a.peer, login)
+			return nil, nil
+		}
+		err = fmt.Errorf("does not receive answer from auth peer %s", a.peer)
+	}
+	return
+}
+
+// answer send auth peer answer to Auth waiting for it, it returns false if
+// nobody waits this login
+func (a *authPeer) answer(login string, res *AuthResult) bool {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	ch, ok := a.wait[login]
+	if ok {
+		ch <- res
+		delete(a.wait, login)
+	}
+	return ok
+}
+
+// register sends login command to users registrar and return new client name
+// and session cookie answer
+func (a *authPeer) register(login string) (res *AuthResult, err error) {
+	const cmdRegister = 133
+	teolog.Debugf(MODULE,
+		"login command, send to users registrar: %s, data: %s\n", a.registrar,
+		login)
+	req := &teouserscli.UserRequest{ReqID: atomic.AddUint32(&a.l0.reqID, 1)}
+	req.UnmarshalText1(append([]byte(login), 0))
+	packetData, _ := req.MarshalBinary()
+	if _, err = a.l0.teo.SendTo(a.registrar, cmdRegister, packetData); err != nil {
+		return
+	}
+	checkData := func(data []byte) bool {
+		return len(data) >= int(unsafe.Sizeof(req.ReqID)) &&
+			binary.LittleEndian.Uint32(data) == req.ReqID
+	}
+	r := <-a.l0.teo.WaitFrom(a.registrar, cmdRegister, authTimeout, checkData)
+	if r.Err != nil {
+		err = fmt.Errorf("does not receive answer from users registrar %s",
+			a.registrar)
+		return
+	}
+	teolog.Debugf(MODULE, "got answer from users registrar: %s, %v\n",
+		a.registrar, r.Data)
+
+	// Check answer
+	user := &teouserscli.UserResponce{}
+	if err = user.UnmarshalBinary(r.Data); err != nil {
+		// can't create new user
+		return
+	}
+
+	// New client name and session cookie
+	return &AuthResult{Name: user.Prefix + "-" + user.ID.String(), Cmd: 129,
+		Data: []byte(user.Prefix + "-" + user.AccessToken.String())}, nil
+}
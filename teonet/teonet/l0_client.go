@@ -20,12 +20,23 @@ type client struct {
 	conn conn             // Connection tcp (net.Conn), websocket or trudp (*trudp.ChannelData)
 	stat clientStat       // Statistic
 	cli  *teocli.TeoLNull // teocli connection to use readBuffer
+
+	limit *clientLimit // Rate limits token buckets
+	roles []string     // Authenticated client roles used in ACL rules
+
+	login   bool     // Login authentication is pending
+	pending [][]byte // Packets received while login authentication is pending
+	closed  bool     // Client is disconnected
 }
 
+// Max number of packets queued while client login authentication is pending
+const loginQueueLen = 64
+
 // clientStat client statistic
 type clientStat struct {
 	send    int // send packes to client counter
 	receive int // receive packes from client counter
+	limited int // messages exceeded limits counter
 	// sendRT    trudp.RealTimeSpeed // send packes to client real time counter
 	// receiveRT trudp.RealTimeSpeed // receive packes to client real time counter
 }
@@ -60,6 +71,21 @@ func (l0 *l0Conn) rename(name, newname string) {
 	l0.mux.Unlock()
 }
 
+// readdress change client address (when client trudp channel migrated to new
+// address)
+func (l0 *l0Conn) readdress(addr, newaddr string) {
+	cli, ok := l0.findAddr(addr)
+	if !ok {
+		return
+	}
+	teolog.Connectf(MODULE, "client %s address changed to %s\n", cli.name, newaddr)
+	l0.mux.Lock()
+	delete(l0.ma, cli.addr)
+	cli.addr = newaddr
+	l0.ma[cli.addr] = cli
+	l0.mux.Unlock()
+}
+
 // close disconnect connected client
 func (l0 *l0Conn) close(client *client) (err error) {
 	if client == nil {
@@ -67,15 +93,21 @@ func (l0 *l0Conn) close(client *client) (err error) {
 		teolog.Error(MODULE, err.Error())
 		return
 	}
+	l0.mux.Lock()
+	closed := client.closed
+	client.closed, client.pending = true, nil
+	if !closed {
+		delete(l0.ma, client.addr)
+		delete(l0.mn, client.name)
+	}
+	l0.mux.Unlock()
+	if closed {
+		return
+	}
 	if client.conn != nil {
 		teolog.Connectf(MODULE, "client %s (%s) disconnected\n", client.name, client.addr)
 		client.conn.Close()
-		client.conn = nil
 	}
-	l0.mux.Lock()
-	delete(l0.ma, client.addr)
-	delete(l0.mn, client.name)
-	l0.mux.Unlock()
 	l0.stat.updated()
 	return
 }
@@ -100,7 +132,13 @@ func (l0 *l0Conn) closeName(name string) (done bool) {
 
 // closeAll disconnect all connected clients
 func (l0 *l0Conn) closeAll() {
+	l0.mux.Lock()
+	clients := make([]*client, 0, len(l0.mn))
 	for _, client := range l0.mn {
+		clients = append(clients, client)
+	}
+	l0.mux.Unlock()
+	for _, client := range clients {
 		l0.close(client)
 	}
 }
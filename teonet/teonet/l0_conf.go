@@ -4,7 +4,12 @@
 
 // Teonet L0 configuration parameters module.
 //
-// Read-write teonet L0 configuration from file and from teo-cdb.
+// Read-write teonet L0 configuration from file and from teo-cdb. The
+// configuration is reloaded from teo-cdb every l0-conf-reload seconds while
+// teo-cdb connected, so ACL rules changes applied without L0 server restart.
+// The reload runs in its own goroutine and replaces current parameters with
+// new parameters struct, so the teonet events and parameters readers are not
+// blocked while teo-cdb answers.
 
 // TODO: create separate service package to read config using this module.
 // Now it uses here and in teoroom package  gameparameters module
@@ -12,38 +17,122 @@
 package teonet
 
 import (
-	"fmt"
+	"encoding/json"
 	"os"
+	"sync/atomic"
+	"time"
 
+	"github.com/kirill-scherba/teonet-go/services/teocdbcli"
 	"github.com/kirill-scherba/teonet-go/services/teocdbcli/conf"
+	"github.com/kirill-scherba/teonet-go/services/teoconf"
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
 )
 
 // param is l0 configuration parameters.
 type param struct {
 	Descr  string   // L0 configuration parameters description
 	Prefix []string // Prefixes allowed quick registration with teonet
+
+	ACL []aclRule `json:"acl,omitempty"` // Clients access control lists rules
 }
 
 // paramConf is module receiver.
 type paramConf struct {
 	*conf.Teoconf
 	chanEvent
-	l0 *l0Conn
+	l0        *l0Conn
+	cdb       bool         // Teo-cdb connected
+	value     atomic.Value // Current parameters (*param)
+	reloading int32        // Reload from teo-cdb is running (atomic)
 }
 
 // parametersNew initialize parameters module.
 func (l0 *l0Conn) parametersNew() (p *paramConf) {
-	p = &paramConf{conf.New(l0.teo, &param{}), l0.teo.ev.subscribe(), l0}
-	fmt.Printf("!!! Subscribed - peer connected !!!\n")
+	p = &paramConf{Teoconf: conf.New(l0.teo, &param{}),
+		chanEvent: l0.teo.ev.subscribe(), l0: l0}
+	v := *p.Value().(*param)
+	p.value.Store(&v)
+	l0.aclSet(v.ACL)
+	teolog.DebugVv(MODULE, "l0 config subscribed to teonet events")
 	go func() {
 		// TODO: uncomment wg using when normolise close channel during exit
 		l0.teo.wg.Add(1)
-		for ev := range p.chanEvent {
-			p.eventProcess(ev)
+		defer l0.teo.wg.Done()
+		var reload <-chan time.Time
+		if sec := l0.teo.param.L0confReload; sec > 0 {
+			ticker := time.NewTicker(time.Duration(sec) * time.Second)
+			defer ticker.Stop()
+			reload = ticker.C
+		}
+		for {
+			select {
+			case ev, ok := <-p.chanEvent:
+				if !ok {
+					teolog.DebugVv(MODULE, "l0 config events channel closed")
+					return
+				}
+				p.eventProcess(ev)
+			case <-reload:
+				if !p.cdb {
+					continue
+				}
+				p.reloadStart()
+			}
+		}
+	}()
+	return
+}
+
+// current return current parameters, the returned struct is not changed by
+// reload
+func (p *paramConf) current() *param {
+	return p.value.Load().(*param)
+}
+
+// reloadStart start parameters reload from teo-cdb in its own goroutine if it
+// is not running now
+func (p *paramConf) reloadStart() {
+	if !atomic.CompareAndSwapInt32(&p.reloading, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&p.reloading, 0)
+		if err := p.reload(); err != nil {
+			teolog.Debugf(MODULE, "reload l0 config error: %s\n", err)
+			return
 		}
-		fmt.Printf("!!! Subscribed channel closed !!!\n")
-		l0.teo.wg.Done()
+		teolog.Debugf(MODULE, "l0 config reloaded: %s\n", p.current().Descr)
 	}()
+}
+
+// reload read parameters from teo-cdb to new parameters struct, replace
+// current parameters with it and apply ACL rules. The config is written to
+// teo-cdb if it does not exists there.
+func (p *paramConf) reload() (err error) {
+	cdb := teocdbcli.New(p.l0.teo)
+	data, err := cdb.Send(teocdbcli.CmdGet, p.Key())
+	if err != nil {
+		return
+	}
+	cur := p.current()
+	if len(data) == 0 {
+		if data, err = json.Marshal(cur); err != nil {
+			return
+		}
+		_, err = cdb.Send(teocdbcli.CmdSet, p.Key(), data)
+		return
+	}
+	v := *cur
+	v.Prefix = append([]string(nil), cur.Prefix...)
+	v.ACL = nil // Rules removed from config are not cleared by json.Unmarshal
+	if err = json.Unmarshal(data, &v); err != nil {
+		return
+	}
+	p.value.Store(&v)
+	p.l0.aclSet(v.ACL)
+	if err := (&teoconf.Teoconf{Config: &v}).Write(); err != nil {
+		teolog.Debugf(MODULE, "write l0 config error: %s\n", err)
+	}
 	return
 }
 
@@ -54,19 +143,15 @@ func (p *paramConf) eventProcess(ev *EventData) {
 	}
 	// Process event #3:  New peer connected to this host
 	if ev.Event == EventConnected && ev.Data.From() == "teo-cdb" {
-		fmt.Printf("Teo-cdb peer connectd. Read config...\n")
-		if err := p.ReadBoth(); err != nil {
-			fmt.Printf("Error: %s\n", err)
-		}
-		var v = p.Value().(*param)
-		fmt.Printf("Descr: %s\n", v.Descr)
+		teolog.Connect(MODULE, "teo-cdb peer connected, read l0 config")
+		p.cdb = true
+		p.reloadStart()
 	}
 
-	// // Process event #4:  Peer disconnected to this host
-	// if ev.Event == EventDisconnected && ev.Data.From() == "teo-cdb" {
-	// 	p.l0.teo.ev.unsubscribe(p.chanEvent)
-	// 	fmt.Printf("!!! Unsubscribed - peer disconnected !!!\n")
-	// }
+	// Process event #4:  Peer disconnected to this host
+	if ev.Event == EventDisconnected && ev.Data.From() == "teo-cdb" {
+		p.cdb = false
+	}
 }
 
 // Default return default value in json format.
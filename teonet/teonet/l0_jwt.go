@@ -0,0 +1,215 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Teonet L0 server JWT authentication module.
+//
+// The L0 server may validate JSON Web Token sent by client as login locally,
+// without request to users registrar or auth peer. The token should be signed
+// with HS256 or EdDSA (Ed25519) key from the l0-jwt-key parameter, issuer and
+// audience are checked when l0-jwt-issuer and l0-jwt-audience parameters set.
+
+package teonet
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// jwtLeeway is allowed clock skew when checking token time claims
+const jwtLeeway = time.Minute
+
+// AuthJWT authenticates clients which send JSON Web Token as login. Client
+// name is taken from userId and clientId claims in 'userId:clientId' format
+// (or from sub claim if they absent), allowed networks are taken from
+// networks claim and client roles used in L0 ACL rules from roles claim.
+// Logins which are not JWT are sent to Next authenticator.
+type AuthJWT struct {
+	Keys     []interface{} // Keys: []byte HS256 secret or ed25519.PublicKey
+	Issuer   string        // Valid issuer (empty - don't check)
+	Audience string        // Valid audience (empty - don't check)
+	Next     Authenticator // Authenticator of not JWT logins (nil - accept)
+}
+
+// jwtClaims is JWT claims used by AuthJWT
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  jwtAudience     `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+	UserID    string          `json:"userId"`
+	ClientID  string          `json:"clientId"`
+	Networks  json.RawMessage `json:"networks"`
+	Roles     []string        `json:"roles"`
+}
+
+// jwtAudience is JWT aud claim which may be string or array of strings
+type jwtAudience []string
+
+// UnmarshalJSON unmarshal aud claim string or array
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = jwtAudience{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// contains return true if audience contains aud
+func (a jwtAudience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// isJWT return true if login looks like JWT
+func isJWT(login string) bool {
+	return strings.HasPrefix(login, "eyJ") && strings.Count(login, ".") == 2
+}
+
+// Auth validate JWT login and return client name and networks answer
+func (a *AuthJWT) Auth(login string) (res *AuthResult, err error) {
+	if !isJWT(login) {
+		if a.Next == nil {
+			return
+		}
+		return a.Next.Auth(login)
+	}
+	claims, err := a.validate(login, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAuthDenied, err)
+	}
+	name := claims.Subject
+	if claims.UserID != "" && claims.ClientID != "" {
+		name = claims.UserID + ":" + claims.ClientID
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%w: token has no client name claims",
+			ErrAuthDenied)
+	}
+	data, err := json.Marshal(struct {
+		Name     string          `json:"name"`
+		Networks json.RawMessage `json:"networks,omitempty"`
+	}{name, claims.Networks})
+	if err != nil {
+		return
+	}
+	return &AuthResult{Name: name, Cmd: CmdL0Auth, Data: data,
+		Roles: claims.Roles}, nil
+}
+
+// validate check token signature, issuer, audience and time claims and
+// return token claims
+func (a *AuthJWT) validate(token string, now time.Time) (claims *jwtClaims,
+	err error) {
+	parts := strings.Split(token, ".")
+	dec := base64.RawURLEncoding
+	h, err := dec.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("wrong token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err = json.Unmarshal(h, &header); err != nil {
+		return nil, errors.New("wrong token header")
+	}
+	sig, err := dec.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("wrong token signature")
+	}
+	if !a.verify(header.Alg, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, fmt.Errorf("wrong %s token signature", header.Alg)
+	}
+	p, err := dec.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("wrong token payload")
+	}
+	claims = &jwtClaims{}
+	if err = json.Unmarshal(p, claims); err != nil {
+		return nil, errors.New("wrong token payload")
+	}
+	switch {
+	case a.Issuer != "" && claims.Issuer != a.Issuer:
+		err = fmt.Errorf("wrong token issuer '%s'", claims.Issuer)
+	case a.Audience != "" && !claims.Audience.contains(a.Audience):
+		err = fmt.Errorf("wrong token audience %v", claims.Audience)
+	case claims.ExpiresAt == 0:
+		err = errors.New("token has no expiration time")
+	case now.Add(-jwtLeeway).Unix() >= claims.ExpiresAt:
+		err = errors.New("token expired")
+	case now.Add(jwtLeeway).Unix() < claims.NotBefore:
+		err = errors.New("token is not valid yet")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// verify check token signature by keys of alg algorithm
+func (a *AuthJWT) verify(alg string, signed, sig []byte) bool {
+	for _, key := range a.Keys {
+		switch k := key.(type) {
+		case []byte:
+			if alg != "HS256" {
+				continue
+			}
+			mac := hmac.New(sha256.New, k)
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return true
+			}
+		case ed25519.PublicKey:
+			if alg == "EdDSA" && ed25519.Verify(k, signed, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jwtKeysRead read JWT keys from comma separated list of files. The PEM file
+// contains Ed25519 public key, other file contains HS256 secret.
+func jwtKeysRead(files string) (keys []interface{}, err error) {
+	for _, file := range strings.Split(files, ",") {
+		data, err := os.ReadFile(strings.TrimSpace(file))
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			secret := []byte(strings.TrimSpace(string(data)))
+			if len(secret) == 0 {
+				return nil, fmt.Errorf("empty jwt secret in %s", file)
+			}
+			keys = append(keys, secret)
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("wrong jwt key %s: %s", file, err)
+		}
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("jwt key %s is not ed25519 public key", file)
+		}
+		keys = append(keys, k)
+	}
+	return
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 Teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Teonet L0 server clients rate limits module.
+//
+// Limits messages and bytes per second sent by each L0 client to peers with
+// token buckets, limits messages per second of selected commands and max
+// message size. The l0-limit-action parameter defines what to do with client
+// message when limit exceeded: drop it, answer with error (CMD_L0_ERROR
+// command) or disconnect client.
+
+package teonet
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+// L0 clients limits actions
+const (
+	limitDrop       = "drop"       // Drop message
+	limitError      = "error"      // Drop message and answer with error
+	limitDisconnect = "disconnect" // Disconnect client
+)
+
+// l0Limits is l0 server clients limits parameters
+type l0Limits struct {
+	msgs   float64          // Messages per second (0 - unlimited)
+	bytes  float64          // Bytes per second (0 - unlimited)
+	cmd    map[byte]float64 // Messages per second of commands
+	size   int              // Max message data size (0 - unlimited)
+	action string           // Action when limit exceeded
+	deny   bool             // Deny all messages (limits parameters are wrong)
+}
+
+// clientLimit is l0 client token buckets
+type clientLimit struct {
+	msgs  *tokenBucket
+	bytes *tokenBucket
+	cmd   map[byte]*tokenBucket
+}
+
+// tokenBucket is token bucket with one second of rate capacity
+type tokenBucket struct {
+	rate   float64   // Tokens per second and bucket capacity
+	tokens float64   // Current number of tokens
+	last   time.Time // Last refill time
+}
+
+// newTokenBucket create full token bucket
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// allow refill bucket and check it has n tokens, it returns false if bucket
+// has not enough tokens. The n greater than bucket capacity is allowed when
+// bucket is full.
+func (b *tokenBucket) allow(n float64, now time.Time) bool {
+	b.tokens = math.Min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	return b.tokens >= math.Min(n, b.rate)
+}
+
+// take take n tokens from bucket, the n greater than tokens number makes it
+// negative
+func (b *tokenBucket) take(n float64) {
+	b.tokens -= n
+}
+
+// limitsNew create l0 clients limits from parameters, it returns nil if
+// limits are not set
+func (l0 *l0Conn) limitsNew() (limits *l0Limits, err error) {
+	param := l0.teo.param
+	limits = &l0Limits{msgs: float64(param.L0limitMsgs),
+		bytes: float64(param.L0limitBytes), size: param.L0limitSize,
+		action: param.L0limitAction, cmd: make(map[byte]float64)}
+	switch limits.action {
+	case "":
+		limits.action = limitDrop
+	case limitDrop, limitError, limitDisconnect:
+	default:
+		return nil, fmt.Errorf("wrong l0 limit action '%s'", limits.action)
+	}
+	if param.L0limitCmd != "" {
+		for _, c := range strings.Split(param.L0limitCmd, ",") {
+			kv := strings.SplitN(strings.TrimSpace(c), ":", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("wrong l0 command limit '%s'", c)
+			}
+			cmd, err := strconv.ParseUint(kv[0], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("wrong l0 command limit '%s'", c)
+			}
+			rate, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil || rate <= 0 {
+				return nil, fmt.Errorf("wrong l0 command limit '%s'", c)
+			}
+			limits.cmd[byte(cmd)] = rate
+		}
+	}
+	if limits.msgs <= 0 && limits.bytes <= 0 && limits.size <= 0 &&
+		len(limits.cmd) == 0 {
+		return nil, nil
+	}
+	return
+}
+
+// exceeded return name of limit exceeded by client message or empty string
+// if message is allowed. Tokens are taken from client buckets only when
+// message is allowed by all of them.
+func (limits *l0Limits) exceeded(client *client, cmd byte, data []byte) string {
+	if limits.deny {
+		return "config"
+	}
+	if client.limit == nil {
+		client.limit = &clientLimit{cmd: make(map[byte]*tokenBucket)}
+		if limits.msgs > 0 {
+			client.limit.msgs = newTokenBucket(limits.msgs)
+		}
+		if limits.bytes > 0 {
+			client.limit.bytes = newTokenBucket(limits.bytes)
+		}
+	}
+	now := time.Now()
+	var cmdBucket *tokenBucket
+	if limits.cmd[cmd] > 0 {
+		cmdBucket = client.limit.cmdBucket(cmd, limits.cmd[cmd])
+	}
+	n := float64(len(data))
+	switch {
+	case limits.size > 0 && len(data) > limits.size:
+		return "size"
+	case cmdBucket != nil && !cmdBucket.allow(1, now):
+		return "cmd"
+	case client.limit.msgs != nil && !client.limit.msgs.allow(1, now):
+		return "msgs"
+	case client.limit.bytes != nil && !client.limit.bytes.allow(n, now):
+		return "bytes"
+	}
+	if cmdBucket != nil {
+		cmdBucket.take(1)
+	}
+	if client.limit.msgs != nil {
+		client.limit.msgs.take(1)
+	}
+	if client.limit.bytes != nil {
+		client.limit.bytes.take(n)
+	}
+	return ""
+}
+
+// cmdBucket return client token bucket of command, the bucket is created
+// when first used
+func (l *clientLimit) cmdBucket(cmd byte, rate float64) *tokenBucket {
+	b, ok := l.cmd[cmd]
+	if !ok {
+		b = newTokenBucket(rate)
+		l.cmd[cmd] = b
+	}
+	return b
+}
+
+// limit check client message limits and apply limits action when limit
+// exceeded, it returns false if message should not be sent
+func (l0 *l0Conn) limit(client *client, to string, cmd byte, data []byte) bool {
+	if l0.limits == nil {
+		return true
+	}
+	exceeded := l0.limits.exceeded(client, cmd, data)
+	if exceeded == "" {
+		return true
+	}
+	l0.stat.limit(client, exceeded, l0.limits.action)
+	teolog.Debugf(MODULE,
+		"client %s exceeded %s limit, cmd: %d, to: %s, length: %d, %s\n",
+		client.name, exceeded, cmd, to, len(data), l0.limits.action)
+	switch l0.limits.action {
+	case limitError:
+		data, _ := json.Marshal(struct {
+			Error string `json:"error"`
+			Limit string `json:"limit"`
+			To    string `json:"to"`
+			Cmd   byte   `json:"cmd"`
+		}{"limit exceeded", exceeded, to, cmd})
+		l0.sendTo("", client.name, CmdL0Error, data)
+	case limitDisconnect:
+		l0.close(client)
+	}
+	return false
+}
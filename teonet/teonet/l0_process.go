@@ -8,7 +8,6 @@ package teonet
 
 import (
 	"net"
-	"strings"
 
 	"github.com/kirill-scherba/teonet-go/teocli/teocli"
 	"github.com/kirill-scherba/teonet-go/teolog/teolog"
@@ -69,7 +68,6 @@ func (l0 *l0Conn) process() {
 	l0.ch = make(chan *packet)
 	l0.teo.wg.Add(1)
 	go func() {
-	packetGet:
 		for pac := range l0.ch {
 			teolog.DebugVvf(MODULE,
 				"valid packet received from client %s, length: %d\n",
@@ -86,38 +84,15 @@ func (l0 *l0Conn) process() {
 				// When we got valid data in l0 login we add clien to cliens map and all
 				// next commands form this client resends to peers with this name (name
 				// from login command data)
-				if d := p.Data(); p.Command() == 0 && p.Name() == "" {
+				if d := p.Data(); p.Command() == 0 && p.Name() == "" && len(d) > 0 {
 					pac.client.name = string(d[:len(d)-1])
+					pac.client.login = l0.authenticator != nil
 					l0.stat.receive(pac.client, d)
 					l0.add(pac.client)
 
-					// Send to users registrar.
-					// Check l0 config and find valid prefixes and if prefix
-					// find than send login command to users registrar service.
-					// Users registrar return answer [1] if login valid and user
-					// my continue or data structure:
-					// UserNew{user_id gocql.UUID,access_tocken gocql.UUID,prefix string}
-					prefix := l0.param.Value().(*param).Prefix
-					for _, p := range prefix {
-						if strings.HasPrefix(pac.client.name, p) {
-							go func() {
-								_, err := l0.sendToRegistrar([]byte(pac.client.name))
-								if err != nil {
-									// TODO: disconnect this client?
-									// send to registrar error: %s
-									return
-								}
-								// TODO: send answer to client and set valid client id
-								// to it name with `l0.rename`.
-								// It alread set inside sendToRegistrar...
-								// Move that code here?
-							}()
-							continue packetGet
-						}
-					}
-
-					// Send login command to auth service
-					l0.sendToAuth(d)
+					// Authenticate client login (users registrar, auth peer
+					// or other authenticator selected in parameters)
+					go l0.login(pac.client)
 					continue
 				}
 
@@ -140,14 +115,60 @@ func (l0 *l0Conn) process() {
 			// if client exists: send it command to Client connected to this server
 			// or to Peer for exising client
 			l0.stat.receive(client, p.Data())
-			if _, ok := l0.findName(p.Name()); ok {
-				l0.sendTo(client.name, p.Name(), p.Command(), p.Data())
-			} else {
-				l0.sendToPeer(p.Name(), client.name, p.Command(), p.Data())
+			if l0.loginPending(client, pac.packet) {
+				continue
 			}
+			l0.forward(client, p)
 		}
 		l0.closeAll()
 		teolog.DebugVv(MODULE, "l0 packet process stopped")
 		l0.teo.wg.Done()
 	}()
 }
+
+// forward send client packet to client connected to this server or to peer
+func (l0 *l0Conn) forward(client *client, p *teocli.Packet) {
+	if !l0.limit(client, p.Name(), p.Command(), p.Data()) ||
+		!l0.access(client, p.Name(), p.Command()) {
+		return
+	}
+	if _, ok := l0.findName(p.Name()); ok {
+		l0.sendTo(client.name, p.Name(), p.Command(), p.Data())
+	} else {
+		l0.sendToPeer(p.Name(), client.name, p.Command(), p.Data())
+	}
+}
+
+// loginPending queue packet of client which login authentication is pending
+// (or drop it when queue is full), it returns false if client is logged in
+func (l0 *l0Conn) loginPending(client *client, packet []byte) bool {
+	l0.mux.Lock()
+	defer l0.mux.Unlock()
+	if !client.login {
+		return false
+	}
+	if len(client.pending) >= loginQueueLen {
+		teolog.Debugf(MODULE, "client %s login is pending, drop packet\n",
+			client.name)
+		return true
+	}
+	client.pending = append(client.pending, append([]byte(nil), packet...))
+	return true
+}
+
+// loginDone forward packets queued while client login was pending and mark
+// client logged in
+func (l0 *l0Conn) loginDone(client *client) {
+	for {
+		l0.mux.Lock()
+		if len(client.pending) == 0 {
+			client.login = false
+			l0.mux.Unlock()
+			return
+		}
+		packet := client.pending[0]
+		client.pending = client.pending[1:]
+		l0.mux.Unlock()
+		l0.forward(client, client.cli.NewPacket(packet))
+	}
+}
@@ -10,11 +10,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"sync/atomic"
-	"time"
-	"unsafe"
 
-	"github.com/kirill-scherba/teonet-go/services/teouserscli"
 	"github.com/kirill-scherba/teonet-go/teolog/teolog"
 )
 
@@ -102,57 +98,3 @@ func (l0 *l0Conn) sendTo(from string, toClient string, cmd byte, data []byte) (l
 	l0.stat.send(client, packet)
 	return client.conn.Write(packet)
 }
-
-// sendToRegistrar sends login commands to users registrar got answer and send
-// answer to client
-func (l0 *l0Conn) sendToRegistrar(d []byte) (data []byte, err error) {
-	teoCDB := "teo-cdb"
-	CmdAuth := byte(133)
-	teolog.Debugf(MODULE,
-		"login command, send to users registrar: %s, data: %v\n", teoCDB, d)
-	req := &teouserscli.UserRequest{ReqID: atomic.AddUint32(&l0.reqID, 1)}
-	req.UnmarshalText1(d)
-	packetData, _ := req.MarshalBinary()
-	l0.teo.SendTo(teoCDB, CmdAuth, packetData)
-	checkData := func(data []byte) bool {
-		return len(data) >= int(unsafe.Sizeof(req.ReqID)) &&
-			binary.LittleEndian.Uint32(data) == req.ReqID
-	}
-	r := <-l0.teo.WaitFrom(teoCDB, CmdAuth, 20*time.Second, checkData)
-	if r.Err != nil {
-		err = r.Err
-		teolog.Errorf(MODULE,
-			"does not receive answer from users registrar (teo-cdb): %s\n",
-			teoCDB)
-		return
-	}
-	data = r.Data
-	teolog.Debugf(MODULE, "got answer from users registrar (teo-cdb): %s, %v\n",
-		teoCDB, r.Data)
-
-	// Check answer
-	res := &teouserscli.UserResponce{}
-	err = res.UnmarshalBinary(data)
-	if err != nil {
-		// can't create new user
-		return
-	}
-
-	// Set client name in system
-	client := res.Prefix + "-" + res.ID.String()
-	cookies := res.Prefix + "-" + res.AccessToken.String()
-	l0.rename(string(d), client)
-
-	// Send command to client
-	l0.sendTo("", client, 129, []byte(cookies))
-
-	return
-}
-
-// sendToRegistrar sends login commands to users registrar
-func (l0 *l0Conn) sendToAuth(d []byte) (length int, err error) {
-	teoAuth := "teo-auth"
-	teolog.Debugf(MODULE, "login command, send to auth: %s, data: %v\n", teoAuth, d)
-	l0.teo.SendTo(teoAuth, CmdUser, d)
-	return
-}
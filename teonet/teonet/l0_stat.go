@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/kirill-scherba/teonet-go/teokeys/teokeys"
@@ -21,12 +22,24 @@ import (
 // stat teonet l0 server staistic
 type l0Stat struct {
 	l0        *l0Conn
-	isUpdated bool
+	isUpdated int32       // Statistic updated flag (atomic)
+	limits    l0LimitStat // Clients limits counters
+}
+
+// l0LimitStat l0 clients limits counters
+type l0LimitStat struct {
+	size        int // Messages exceeded max size
+	cmd         int // Messages exceeded command limit
+	msgs        int // Messages exceeded messages per second limit
+	bytes       int // Messages exceeded bytes per second limit
+	dropped     int // Dropped messages
+	errors      int // Error answers sent
+	disconnects int // Disconnected clients
 }
 
 // statNew sreates new statistic data struct and method receiver
 func (l0 *l0Conn) statNew() (stat *l0Stat) {
-	stat = &l0Stat{l0: l0, isUpdated: true}
+	stat = &l0Stat{l0: l0, isUpdated: 1}
 	if l0.teo.param.ShowClientsStatF {
 		stat.process()
 	}
@@ -35,7 +48,7 @@ func (l0 *l0Conn) statNew() (stat *l0Stat) {
 
 // update set update l0Stat value to true
 func (stat *l0Stat) updated() {
-	stat.isUpdated = true
+	atomic.StoreInt32(&stat.isUpdated, 1)
 }
 
 // process print statistic continuously
@@ -45,7 +58,7 @@ func (stat *l0Stat) process() {
 		stat.updated()
 		stat.l0.teo.wg.Add(1)
 		for stat.l0.teo.running && stat.l0.teo.param.ShowClientsStatF {
-			if stat.isUpdated {
+			if atomic.LoadInt32(&stat.isUpdated) == 1 {
 				str = stat.sprint()
 			}
 			fmt.Print(str)
@@ -70,7 +83,7 @@ func (stat *l0Stat) sprint() (str string) {
 
 	var line = "\033[2K" + strings.Repeat("-", 77) + "\n"
 	var length, lenadd = 0, 7
-	stat.isUpdated = false
+	atomic.StoreInt32(&stat.isUpdated, 0)
 
 	// Sort clients table:
 	// read clients map keys to slice and sort it
@@ -116,6 +129,17 @@ func (stat *l0Stat) sprint() (str string) {
 		)
 	}
 
+	// Limits
+	if stat.l0.limits != nil {
+		l := stat.limits
+		lenadd++
+		str += fmt.Sprintf(line+"\033[2K"+
+			"Limits exceeded: size %d, cmd %d, msgs %d, bytes %d; "+
+			"dropped %d, errors %d, disconnects %d\n",
+			l.size, l.cmd, l.msgs, l.bytes, l.dropped, l.errors,
+			l.disconnects)
+	}
+
 	// Footer
 	str += fmt.Sprintf(line+
 		"\033[2K\n"+ // Clear line
@@ -133,6 +157,29 @@ func (stat *l0Stat) send(client *client, packet []byte) {
 	stat.updated()
 }
 
+// limit set limit exceeded operation in statistic
+func (stat *l0Stat) limit(client *client, exceeded, action string) {
+	client.stat.limited++
+	switch exceeded {
+	case "size":
+		stat.limits.size++
+	case "cmd":
+		stat.limits.cmd++
+	case "msgs":
+		stat.limits.msgs++
+	case "bytes":
+		stat.limits.bytes++
+	}
+	switch action {
+	case limitError:
+		stat.limits.errors++
+	case limitDisconnect:
+		stat.limits.disconnects++
+	}
+	stat.limits.dropped++
+	stat.updated()
+}
+
 // receive set receive operation in statistic
 func (stat *l0Stat) receive(client *client, packet []byte) {
 	client.stat.receive++
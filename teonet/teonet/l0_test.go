@@ -0,0 +1,862 @@
+package teonet
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/services/teocdbcli"
+	"github.com/kirill-scherba/teonet-go/teocli/teocli"
+	"github.com/kirill-scherba/teonet-go/trudp/netsim"
+)
+
+// tlsTestCA generate self-signed CA and localhost server certificate signed
+// by it, save server certificate and key to files and return CA pool
+func tlsTestCA(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	caKey, key := newKey(), newKey()
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "teonet test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey,
+		caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca, err = x509.ParseCertificate(caDER); err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey,
+		caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	for file, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: certDER},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(ca)
+	return
+}
+
+// freePort return free local tcp port
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// l0Read read packets from L0 server until packet with command cmd received
+func l0Read(t *testing.T, cli *teocli.TeoLNull, cmd byte) *teocli.Packet {
+	for {
+		pac, err := cli.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pac.Command() == cmd {
+			return pac
+		}
+	}
+}
+
+// l0Echo login to L0 server, send echo to peer and wait echo answer with
+// valid triptime
+func l0Echo(t *testing.T, cli *teocli.TeoLNull, name, peer string) {
+	if _, err := cli.SendLogin(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.SendEcho(peer, "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	pac := l0Read(t, cli, teocli.CmdLEchoAnswer)
+	for pac.From() != peer {
+		pac = l0Read(t, cli, teocli.CmdLEchoAnswer)
+	}
+	if triptime, err := pac.Triptime(); err != nil || triptime < 0 ||
+		triptime > int64(10*time.Second/time.Millisecond) {
+		t.Errorf("wrong echo answer triptime: %d, err: %v", triptime, err)
+	}
+}
+
+// l0Node start teonet node with L0 server tcp port, parameters may be changed
+// by setup function before node started
+func l0Node(t *testing.T, name string, setup func(param *Parameters)) (
+	teo *Teonet, param *Parameters) {
+	conn, err := netsim.New(1).Listen("10.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	param = CreateParameters()
+	param.Name = name
+	param.Loglevel = "NONE"
+	param.ForbidHotkeysF = true
+	param.CtrlcF = false
+	param.ShowParametersF = false
+	param.Transport = conn
+	param.L0allow = true
+	param.L0tcpPort = freePort(t)
+	if setup != nil {
+		setup(param)
+	}
+	teo = Connect(param, []string{"teo-test"}, "0.0.1")
+	go teo.Run(func(teo *Teonet) {
+		for range teo.Event() {
+		}
+	})
+	return
+}
+
+// TestL0TLS connects L0 clients to L0 server tcp and websocket ports over
+// TLS with locally generated CA
+func TestL0TLS(t *testing.T) {
+	certFile, keyFile, pool := tlsTestCA(t)
+	teo, param := l0Node(t, "l0-tls", func(param *Parameters) {
+		param.L0wsAllow = true
+		param.L0wsPort = freePort(t)
+		param.L0tlsCert = certFile
+		param.L0tlsKey = keyFile
+	})
+	defer teo.Close()
+	config := &tls.Config{RootCAs: pool}
+
+	t.Run("tcp", func(t *testing.T) {
+		cli, err := teocli.Connect("127.0.0.1", param.L0tcpPort, true, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Disconnect()
+		l0Echo(t, cli, "tls-client", param.Name)
+	})
+
+	t.Run("wss", func(t *testing.T) {
+		var cli *teocli.TeoLNull
+		var err error
+		url := "wss://localhost:" + strconv.Itoa(param.L0wsPort) + "/ws"
+		for i := 0; i < 50; i++ {
+			if cli, err = teocli.ConnectWS(url, config); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Disconnect()
+		l0Echo(t, cli, "wss-client", param.Name)
+	})
+
+	t.Run("unknown CA", func(t *testing.T) {
+		_, err := teocli.Connect("127.0.0.1", param.L0tcpPort, true,
+			&tls.Config{})
+		if err == nil {
+			t.Fatal("connected to server with unknown CA")
+		}
+	})
+
+	t.Run("plain tcp", func(t *testing.T) {
+		cli, err := teocli.Connect("127.0.0.1", param.L0tcpPort, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Disconnect()
+		cli.SendLogin("plain-client")
+		if _, err := cli.Read(); err == nil {
+			t.Fatal("plain tcp client got answer from TLS server")
+		}
+	})
+}
+
+// TestL0Auth login L0 clients with file, HTTP and custom authenticators
+func TestL0Auth(t *testing.T) {
+	users := filepath.Join(t.TempDir(), "users.json")
+	err := os.WriteFile(users, []byte(`{"user1": {"name": "user-one", "data": {"role": "admin"}}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		var req struct {
+			Login string `json:"login"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Login != "user1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"name": "user-one", "data": {"role": "admin"}}`))
+	}))
+	defer srv.Close()
+
+	// login send login to L0 server and return login answer
+	login := func(t *testing.T, param *Parameters, name string) (
+		cli *teocli.TeoLNull, answer map[string]interface{}) {
+		cli, err := teocli.Connect("127.0.0.1", param.L0tcpPort, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = cli.SendLogin(name); err != nil {
+			t.Fatal(err)
+		}
+		pac := l0Read(t, cli, CmdL0Auth)
+		if err = json.Unmarshal(pac.Data(), &answer); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	for _, auth := range []string{"file:" + users, srv.URL} {
+		t.Run(strings.SplitN(auth, ":", 2)[0], func(t *testing.T) {
+			teo, param := l0Node(t, "l0-auth", func(param *Parameters) {
+				param.L0auth = auth
+			})
+			defer teo.Close()
+
+			cli, answer := login(t, param, "user1")
+			defer cli.Disconnect()
+			if answer["name"] != "user-one" {
+				t.Fatalf("wrong login answer: %v", answer)
+			}
+			if _, err := cli.SendEcho(param.Name, "Hello"); err != nil {
+				t.Fatal(err)
+			}
+			l0Read(t, cli, teocli.CmdLEchoAnswer)
+			if _, ok := teo.l0.findName("user-one"); !ok {
+				t.Fatal("client is not renamed")
+			}
+
+			cli, answer = login(t, param, "user2")
+			defer cli.Disconnect()
+			if answer["error"] == nil {
+				t.Fatalf("unknown login accepted: %v", answer)
+			}
+			if _, err := cli.Read(); err == nil {
+				t.Fatal("unknown login is not disconnected")
+			}
+		})
+	}
+
+	t.Run("func", func(t *testing.T) {
+		teo, param := l0Node(t, "l0-auth", func(param *Parameters) {
+			param.L0Authenticator = AuthFunc(func(login string) (*AuthResult,
+				error) {
+				return nil, nil
+			})
+		})
+		defer teo.Close()
+		cli, err := teocli.Connect("127.0.0.1", param.L0tcpPort, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Disconnect()
+		l0Echo(t, cli, "user3", param.Name)
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		release := make(chan struct{})
+		teo, param := l0Node(t, "l0-auth", func(param *Parameters) {
+			param.L0Authenticator = AuthFunc(func(login string) (*AuthResult,
+				error) {
+				<-release
+				return &AuthResult{Name: "user-four"}, nil
+			})
+		})
+		defer teo.Close()
+		cli, err := teocli.Connect("127.0.0.1", param.L0tcpPort, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Disconnect()
+		answer := make(chan *teocli.Packet, 1)
+		go func() {
+			defer close(answer)
+			for {
+				pac, err := cli.Read()
+				if err != nil {
+					return
+				}
+				if pac.Command() == teocli.CmdLEchoAnswer {
+					answer <- pac
+					return
+				}
+			}
+		}()
+		if _, err := cli.SendLogin("user4"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cli.SendEcho(param.Name, "Hello"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-answer:
+			t.Fatal("packet forwarded before client logged in")
+		case <-time.After(200 * time.Millisecond):
+		}
+		close(release)
+		select {
+		case pac := <-answer:
+			if pac == nil || pac.From() != param.Name {
+				t.Fatal("queued packet is not forwarded after login")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("queued packet is not forwarded after login")
+		}
+	})
+}
+
+// jwtToken create signed JWT with claims, the key is []byte HS256 secret or
+// ed25519.PrivateKey
+func jwtToken(t *testing.T, key interface{}, claims interface{}) string {
+	alg := "HS256"
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		alg = "EdDSA"
+	}
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	return signed + "." + enc.EncodeToString(sig)
+}
+
+// TestL0AuthJWT validate JWT logins signed with HS256 and EdDSA keys
+func TestL0AuthJWT(t *testing.T) {
+	secret := []byte("jwt-test-secret")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	exp := time.Now().Add(time.Hour).Unix()
+	claims := func(c map[string]interface{}) map[string]interface{} {
+		m := map[string]interface{}{"iss": "teonet", "aud": "l0", "exp": exp,
+			"userId": "user", "clientId": "client",
+			"networks": []string{"local"}}
+		for k, v := range c {
+			if v == nil {
+				delete(m, k)
+				continue
+			}
+			m[k] = v
+		}
+		return m
+	}
+
+	auth := &AuthJWT{Keys: []interface{}{secret, pub}, Issuer: "teonet",
+		Audience: "l0"}
+	for _, test := range []struct {
+		name  string
+		login string
+		user  string // Client name or empty if token should be denied
+	}{
+		{"hs256", jwtToken(t, secret, claims(nil)), "user:client"},
+		{"eddsa", jwtToken(t, priv, claims(nil)), "user:client"},
+		{"sub", jwtToken(t, secret, claims(map[string]interface{}{
+			"userId": nil, "sub": "subject"})), "subject"},
+		{"audience array", jwtToken(t, priv, claims(map[string]interface{}{
+			"aud": []string{"web", "l0"}})), "user:client"},
+		{"wrong secret", jwtToken(t, []byte("other"), claims(nil)), ""},
+		{"wrong key", jwtToken(t, otherKey, claims(nil)), ""},
+		{"issuer", jwtToken(t, secret, claims(map[string]interface{}{
+			"iss": "other"})), ""},
+		{"audience", jwtToken(t, secret, claims(map[string]interface{}{
+			"aud": "web"})), ""},
+		{"expired", jwtToken(t, secret, claims(map[string]interface{}{
+			"exp": time.Now().Add(-time.Hour).Unix()})), ""},
+		{"no exp", jwtToken(t, secret, claims(map[string]interface{}{
+			"exp": nil})), ""},
+		{"not before", jwtToken(t, secret, claims(map[string]interface{}{
+			"nbf": exp})), ""},
+		{"no name", jwtToken(t, secret, claims(map[string]interface{}{
+			"userId": nil})), ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := auth.Auth(test.login)
+			if test.user == "" {
+				if !errors.Is(err, ErrAuthDenied) {
+					t.Fatalf("token accepted or wrong error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var answer struct {
+				Name     string   `json:"name"`
+				Networks []string `json:"networks"`
+			}
+			json.Unmarshal(res.Data, &answer)
+			if res.Name != test.user || answer.Name != test.user ||
+				len(answer.Networks) != 1 || answer.Networks[0] != "local" {
+				t.Fatalf("wrong authentication result: %s %s", res.Name,
+					res.Data)
+			}
+		})
+	}
+
+	t.Run("l0", func(t *testing.T) {
+		dir := t.TempDir()
+		secretFile := filepath.Join(dir, "secret")
+		if err := os.WriteFile(secretFile, secret, 0600); err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyFile := filepath.Join(dir, "key.pem")
+		err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+			Type: "PUBLIC KEY", Bytes: keyDER}), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		teo, param := l0Node(t, "l0-jwt", func(param *Parameters) {
+			param.L0auth = "none"
+			param.L0jwtKey = secretFile + "," + keyFile
+			param.L0jwtIssuer = "teonet"
+			param.L0jwtAudience = "l0"
+		})
+		defer teo.Close()
+		cli, err := teocli.Connect("127.0.0.1", param.L0tcpPort, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Disconnect()
+		if _, err = cli.SendLogin(jwtToken(t, priv, claims(nil))); err != nil {
+			t.Fatal(err)
+		}
+		l0Read(t, cli, CmdL0Auth)
+		if _, err := cli.SendEcho(param.Name, "Hello"); err != nil {
+			t.Fatal(err)
+		}
+		l0Read(t, cli, teocli.CmdLEchoAnswer)
+		if _, ok := teo.l0.findName("user:client"); !ok {
+			t.Fatal("client is not renamed")
+		}
+	})
+
+	// JWT logins validated locally and other logins sent to auth peer
+	t.Run("l0 with auth peer", func(t *testing.T) {
+		secretFile := filepath.Join(t.TempDir(), "secret")
+		if err := os.WriteFile(secretFile, secret, 0600); err != nil {
+			t.Fatal(err)
+		}
+		n := netsim.New(1)
+		n.SetLink(netsim.Link{Latency: time.Millisecond})
+		authNode := netsimConnect(t, n, "teo-auth", "10.0.0.1", "", 0)
+		teo, param := l0Node(t, "l0-jwt-peer", func(param *Parameters) {
+			conn, err := n.Listen("10.0.0.2:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			param.Transport = conn
+			param.RAddr, param.RPort = "10.0.0.1", authNode.teo.param.Port
+			param.L0auth = "peer"
+			param.L0jwtKey = secretFile
+		})
+		defer teo.Close()
+		authNode.wait(t, EventConnected, "l0-jwt-peer", 5*time.Second)
+
+		// Fake auth peer answers access tokens
+		go func() {
+			for ev := range authNode.ch {
+				if ev.Event != EventReceived || ev.Data.Cmd() != CmdUser {
+					continue
+				}
+				token := strings.TrimRight(string(ev.Data.Data()), "\x00")
+				data, _ := json.Marshal(map[string]interface{}{
+					"accessToken": token,
+					"user": map[string]string{"userId": "peer",
+						"clientId": "client"}})
+				authNode.teo.SendTo(ev.Data.From(), CmdL0Auth, data)
+			}
+		}()
+
+		for _, test := range []struct{ login, name string }{
+			{jwtToken(t, secret, claims(nil)), "user:client"},
+			{"access-token", "peer:client"},
+		} {
+			cli, err := teocli.Connect("127.0.0.1", param.L0tcpPort, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cli.Disconnect()
+			if _, err = cli.SendLogin(test.login); err != nil {
+				t.Fatal(err)
+			}
+			l0Read(t, cli, CmdL0Auth)
+			if _, err := cli.SendEcho(param.Name, "Hello"); err != nil {
+				t.Fatal(err)
+			}
+			l0Read(t, cli, teocli.CmdLEchoAnswer)
+			if _, ok := teo.l0.findName(test.name); !ok {
+				t.Fatalf("client %s is not renamed", test.name)
+			}
+		}
+	})
+}
+
+// TestL0Limits send L0 client messages exceeded size, command and messages
+// per second limits
+func TestL0Limits(t *testing.T) {
+	connect := func(t *testing.T, setup func(param *Parameters)) (
+		teo *Teonet, cli *teocli.TeoLNull) {
+		teo, param := l0Node(t, "l0-limits", func(param *Parameters) {
+			param.L0auth = "none"
+			setup(param)
+		})
+		cli, err := teocli.Connect("127.0.0.1", param.L0tcpPort, true)
+		if err != nil {
+			teo.Close()
+			t.Fatal(err)
+		}
+		if _, err = cli.SendLogin("limits-client"); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	t.Run("error", func(t *testing.T) {
+		teo, cli := connect(t, func(param *Parameters) {
+			param.L0limitSize = 64
+			param.L0limitCmd = fmt.Sprintf("%d:2", teocli.CmdLEcho)
+			param.L0limitAction = "error"
+		})
+		defer teo.Close()
+		defer cli.Disconnect()
+
+		// Size limit
+		cli.SendEcho(teo.param.Name, strings.Repeat("x", 100))
+		pac := l0Read(t, cli, CmdL0Error)
+		var answer map[string]interface{}
+		json.Unmarshal(pac.Data(), &answer)
+		if pac.From() != "" || answer["limit"] != "size" ||
+			answer["cmd"] != float64(teocli.CmdLEcho) {
+			t.Fatalf("wrong limit answer from %s: %s", pac.From(), pac.Data())
+		}
+
+		// Command limit: two messages per second allowed
+		var echo, denied int
+		for i := 0; i < 5; i++ {
+			cli.SendEcho(teo.param.Name, "Hello")
+		}
+		for echo+denied < 5 {
+			pac, err := cli.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch pac.Command() {
+			case teocli.CmdLEchoAnswer:
+				echo++
+			case CmdL0Error:
+				denied++
+			}
+		}
+		if echo != 2 || denied != 3 {
+			t.Fatalf("wrong number of echo answers %d and errors %d", echo,
+				denied)
+		}
+		if l := teo.l0.stat.limits; l.size != 1 || l.cmd != 3 || l.errors != 4 {
+			t.Fatalf("wrong limits statistic: %+v", l)
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		teo, cli := connect(t, func(param *Parameters) {
+			param.L0limitMsgs = 1
+			param.L0limitAction = "disconnect"
+		})
+		defer teo.Close()
+		defer cli.Disconnect()
+		for i := 0; i < 3; i++ {
+			cli.SendEcho(teo.param.Name, "Hello")
+		}
+		for {
+			if _, err := cli.Read(); err != nil {
+				break
+			}
+		}
+		if l := teo.l0.stat.limits; l.msgs != 1 || l.disconnects != 1 {
+			t.Fatalf("wrong limits statistic: %+v", l)
+		}
+	})
+
+	t.Run("buckets", func(t *testing.T) {
+		// Messages denied by messages per second limit does not take
+		// command limit tokens
+		limits := &l0Limits{msgs: 1, cmd: map[byte]float64{teocli.CmdLEcho: 2}}
+		client := &client{}
+		for _, want := range []string{"", "msgs", "msgs"} {
+			if exceeded := limits.exceeded(client, teocli.CmdLEcho,
+				nil); exceeded != want {
+				t.Fatalf("wrong exceeded limit: %q, wait for: %q", exceeded,
+					want)
+			}
+		}
+		if b := client.limit.cmd[teocli.CmdLEcho]; b.tokens < 1 {
+			t.Fatalf("command bucket tokens taken by denied messages: %f",
+				b.tokens)
+		}
+	})
+
+	t.Run("wrong parameters", func(t *testing.T) {
+		teo, _ := l0Node(t, "l0-limits", func(param *Parameters) {
+			param.L0limitCmd = "echo:fast"
+		})
+		defer teo.Close()
+		if l := teo.l0.limits; l == nil ||
+			l.exceeded(&client{}, teocli.CmdLEcho, nil) == "" {
+			t.Fatal("messages allowed with wrong limits parameters")
+		}
+	})
+}
+
+// TestL0ACL check L0 clients messages by ACL rules selected by clients
+// prefixes and roles, and replace ACL rules when L0 server running
+func TestL0ACL(t *testing.T) {
+	users := filepath.Join(t.TempDir(), "users.json")
+	err := os.WriteFile(users, []byte(`{
+		"admin-1": {},
+		"user1": {"name": "user-one", "roles": ["echo"]},
+		"user2": {"name": "user-two"}
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	teo, param := l0Node(t, "l0-acl", func(param *Parameters) {
+		param.L0auth = "file:" + users
+	})
+	defer teo.Close()
+	teo.l0.aclSet([]aclRule{
+		{Clients: []string{"admin-"}, Peers: []string{"*"}},
+		{Roles: []string{"echo"}, Peers: []string{param.Name},
+			Cmds: []int{teocli.CmdLEcho}},
+		{Types: []string{"teo-test"}, Cmds: []int{int(CmdUser)}},
+	})
+
+	// echo send echo to peer and return true if echo answer received or
+	// false if access denied
+	echo := func(t *testing.T, cli *teocli.TeoLNull, peer string) bool {
+		if _, err := cli.SendEcho(peer, "Hello"); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			pac, err := cli.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case pac.Command() == teocli.CmdLEchoAnswer:
+				return true
+			case pac.Command() == teocli.CmdL0Error:
+				var answer struct {
+					Error string `json:"error"`
+					To    string `json:"to"`
+					Cmd   byte   `json:"cmd"`
+				}
+				json.Unmarshal(pac.Data(), &answer)
+				if answer.Error != "access denied" || answer.To != peer ||
+					answer.Cmd != teocli.CmdLEcho {
+					t.Fatalf("wrong access denied answer: %s", pac.Data())
+				}
+				return false
+			}
+		}
+	}
+	login := func(t *testing.T, name string) *teocli.TeoLNull {
+		cli, err := teocli.Connect("127.0.0.1", param.L0tcpPort, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = cli.SendLogin(name); err != nil {
+			t.Fatal(err)
+		}
+		l0Read(t, cli, CmdL0Auth)
+		return cli
+	}
+	admin, user1, user2 := login(t, "admin-1"), login(t, "user1"),
+		login(t, "user2")
+	defer admin.Disconnect()
+	defer user1.Disconnect()
+	defer user2.Disconnect()
+
+	for _, test := range []struct {
+		name  string
+		cli   *teocli.TeoLNull
+		peer  string
+		allow bool
+	}{
+		{"prefix", admin, param.Name, true},
+		{"role", user1, param.Name, true},
+		{"role peer", user1, "teo-other", false},
+		{"no rules", user2, param.Name, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if echo(t, test.cli, test.peer) != test.allow {
+				t.Fatalf("wrong access, allow: %v", !test.allow)
+			}
+		})
+	}
+
+	t.Run("app type", func(t *testing.T) {
+		acl := teo.l0.acl.Load().(*l0ACL)
+		if !acl.allow("user-two", nil, "teo-x", []string{"teo-test"},
+			CmdUser) {
+			t.Fatal("command to peer app type denied")
+		}
+		if acl.allow("user-two", nil, "teo-x", []string{"teo-cdb"},
+			CmdUser) {
+			t.Fatal("command to peer with other app type allowed")
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		teo.l0.aclSet(nil)
+		if !echo(t, user2, param.Name) {
+			t.Fatal("access denied without ACL rules")
+		}
+	})
+}
+
+// TestL0ConfReload read L0 configuration from teo-cdb, which answers when L0
+// server node processed other teonet packets, and apply its ACL rules
+func TestL0ConfReload(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	n := netsim.New(1)
+	n.SetLink(netsim.Link{Latency: time.Millisecond})
+	cdb := netsimConnect(t, n, "teo-cdb", "10.0.0.1", "", 0)
+	teo, _ := l0Node(t, "l0-conf", func(param *Parameters) {
+		conn, err := n.Listen("10.0.0.2:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		param.Transport = conn
+		param.RAddr, param.RPort = "10.0.0.1", cdb.teo.param.Port
+		param.L0auth = "none"
+	})
+	defer teo.Close()
+
+	// Fake teo-cdb answers config request when got host info answer sent
+	// after user commands events
+	blocked := make(chan bool, 1)
+	go func() {
+		for ev := range cdb.ch {
+			if ev.Event != EventReceived ||
+				ev.Data.Cmd() != teocdbcli.CmdBinary {
+				continue
+			}
+			req := &teocdbcli.KeyValue{}
+			if req.UnmarshalBinary(ev.Data.Data()) != nil ||
+				req.Cmd != teocdbcli.CmdGet {
+				continue
+			}
+			for i := 0; i < 3; i++ {
+				cdb.teo.SendTo("l0-conf", CmdUser+1, []byte("event"))
+			}
+			cdb.teo.SendTo("l0-conf", CmdHostInfo, nil)
+			answered := false
+			for after := time.After(3 * time.Second); !answered; {
+				select {
+				case ev := <-cdb.ch:
+					answered = ev.Event == EventReceived &&
+						ev.Data.Cmd() == CmdHostInfoAnswer
+				case <-after:
+					blocked <- true
+					answered = true
+				}
+			}
+			res := &teocdbcli.KeyValue{Cmd: req.Cmd, ID: req.ID, Key: req.Key,
+				Value: []byte(`{"descr":"teo-cdb config","prefix":["tg002"],` +
+					`"acl":[{"clients":["*"],"peers":["teo-cdb"]}]}`)}
+			data, _ := res.MarshalBinary()
+			cdb.teo.SendAnswer(ev.Data, teocdbcli.CmdBinary, data)
+		}
+	}()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		select {
+		case <-blocked:
+			t.Fatal("teonet packets are not processed while l0 config reload")
+		default:
+		}
+		if v := teo.l0.param.current(); len(v.Prefix) == 1 &&
+			v.Prefix[0] == "tg002" {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("l0 config is not read from teo-cdb")
+		}
+	}
+	acl, ok := teo.l0.acl.Load().(*l0ACL)
+	if !ok || len(acl.rules) != 1 {
+		t.Fatal("ACL rules from teo-cdb config are not applied")
+	}
+}
@@ -7,10 +7,12 @@
 package teonet
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"unicode/utf8"
 
 	"github.com/kirill-scherba/teonet-go/teocli/teocli"
 	"github.com/kirill-scherba/teonet-go/teolog/teolog"
@@ -38,11 +40,19 @@ func (l0 *l0Conn) wsServe(port int) (wsc *wsConn) {
 	wsc = &wsConn{l0: l0}
 	mux := http.NewServeMux()
 	mux.Handle("/ws", websocket.Handler(wsc.handler))
-	wsc.srv = &http.Server{Addr: ":" + strconv.Itoa(port), Handler: mux}
+	wsc.srv = &http.Server{Addr: ":" + strconv.Itoa(port), Handler: mux,
+		TLSConfig: l0.tls}
 	l0.teo.wg.Add(1)
 	go func() {
-		teolog.Connect(MODULE, "l0 websocket server start listen tcp port:", port)
-		if err := wsc.srv.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if l0.tls != nil {
+			teolog.Connect(MODULE, "l0 websocket server start listen tcp (tls) port:", port)
+			err = wsc.srv.ListenAndServeTLS("", "")
+		} else {
+			teolog.Connect(MODULE, "l0 websocket server start listen tcp port:", port)
+			err = wsc.srv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			// \TODO: replace panic to thomething valid :-)
 			panic(fmt.Sprintf("ListenAndServe(): %s", err))
 		}
@@ -79,9 +89,10 @@ func (wsc *wsConn) handler(ws *websocket.Conn) {
 
 		// Parse JSON
 		type teoJSON struct {
-			Cmd  byte        `json:"cmd"`
-			To   string      `json:"to"`
-			Data interface{} `json:"data"`
+			Cmd    byte        `json:"cmd"`
+			To     string      `json:"to"`
+			Data   interface{} `json:"data"`
+			Base64 bool        `json:"base64"`
 		}
 		data := teoJSON{}
 		if err := json.Unmarshal(jdata, &data); err != nil {
@@ -89,9 +100,14 @@ func (wsc *wsConn) handler(ws *websocket.Conn) {
 			break
 		}
 
-		// Parse data
+		// Parse data, binary data is received as base64 string
 		var js []byte
-		if jss, ok := data.Data.(string); ok {
+		if jss, ok := data.Data.(string); ok && data.Base64 {
+			if js, err = base64.StdEncoding.DecodeString(jss); err != nil {
+				teolog.Error(err.Error())
+				continue
+			}
+		} else if ok {
 			js = []byte(jss)
 		} else {
 			js, _ = json.Marshal(data.Data)
@@ -138,7 +154,9 @@ func (conn *wsHandlerConn) Write(packet []byte) (n int, err error) {
 	switch pac.Command() {
 	case CmdPeersAnswer:
 		if !isJSON {
-			data, _ = conn.wsc.l0.teo.arp.binaryToJSON(pac.Data())
+			if d, _, err := conn.wsc.l0.teo.arp.binaryToJSON(pac.Data()); err == nil {
+				data = d
+			}
 		}
 	case CmdL0ClientsAnswer:
 		data = conn.wsc.l0.teo.com.marshalClients(pac.Data())
@@ -149,17 +167,24 @@ func (conn *wsHandlerConn) Write(packet []byte) (n int, err error) {
 	case CmdSubscribeAnswer:
 		data = conn.wsc.l0.teo.com.marshalSubscribe(pac.Data())
 	}
+	var isBase64 bool
 	if err := json.Unmarshal(data, &obj); err != nil {
 		obj = string(data)
+		if !utf8.Valid(data) {
+			// Binary data sends as base64 string with marker
+			obj, isBase64 = base64.StdEncoding.EncodeToString(data), true
+		}
 	}
 
 	// teoJSON structure to marshal JSON
 	type teoJSON struct {
-		Cmd  byte        `json:"cmd"`
-		From string      `json:"from"`
-		Data interface{} `json:"data"`
+		Cmd    byte        `json:"cmd"`
+		From   string      `json:"from"`
+		Data   interface{} `json:"data"`
+		Base64 bool        `json:"base64,omitempty"`
 	}
-	j := teoJSON{Cmd: pac.Command(), From: pac.Name(), Data: obj}
+	j := teoJSON{Cmd: pac.Command(), From: pac.Name(), Data: obj,
+		Base64: isBase64}
 	if d, err := json.Marshal(j); err == nil {
 		teolog.DebugVf(MODULE,
 			"write to websocket client '%s' from: %s, cmd: %d, data_len: %d\n",
@@ -0,0 +1,132 @@
+package teonet
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/trudp/netsim"
+)
+
+// netsimNode is Teonet node connected to virtual network
+type netsimNode struct {
+	teo *Teonet
+	ch  chan *EventData
+}
+
+// netsimConnect start Teonet node on virtual network host. The node connects
+// to r-host if rport > 0.
+func netsimConnect(t *testing.T, n *netsim.Network, name, host, raddr string,
+	rport int) (node *netsimNode) {
+	conn, err := n.Listen(host + ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	param := CreateParameters()
+	param.Name = name
+	param.Loglevel = "NONE"
+	param.ForbidHotkeysF = true
+	param.CtrlcF = false
+	param.ShowParametersF = false
+	param.RAddr = raddr
+	param.RPort = rport
+	param.Transport = conn
+
+	node = &netsimNode{teo: Connect(param, []string{"teo-test"}, "0.0.1"),
+		ch: make(chan *EventData, 64)}
+	go node.teo.Run(func(teo *Teonet) {
+		for ev := range teo.Event() {
+			node.ch <- ev
+		}
+	})
+	t.Cleanup(node.teo.Close)
+	return
+}
+
+// wait waits event from peer and return received packet
+func (node *netsimNode) wait(t *testing.T, event int, peer string,
+	timeout time.Duration) *Packet {
+	after := time.After(timeout)
+	for {
+		select {
+		case ev := <-node.ch:
+			if ev.Event == event && ev.Data != nil && ev.Data.From() == peer {
+				return ev.Data
+			}
+		case <-after:
+			t.Fatalf("%s: timeout, event %d from %s does not received",
+				node.teo.param.Name, event, peer)
+		}
+	}
+}
+
+// TestNetsim execute Teonet nodes over virtual network with adverse
+// conditions
+func TestNetsim(t *testing.T) {
+
+	n := netsim.New(1)
+	n.SetLink(netsim.Link{
+		Latency:   5 * time.Millisecond,
+		Jitter:    5 * time.Millisecond,
+		Loss:      0.03,
+		Reorder:   0.03,
+		Duplicate: 0.03,
+	})
+	nodeA := netsimConnect(t, n, "node-a", "10.0.0.1", "", 0)
+	nodeB := netsimConnect(t, n, "node-b", "10.0.0.2", "10.0.0.1",
+		nodeA.teo.param.Port)
+
+	t.Run("connect to r-host", func(t *testing.T) {
+		nodeA.wait(t, EventConnected, "node-b", 10*time.Second)
+		nodeB.wait(t, EventConnected, "node-a", 10*time.Second)
+	})
+
+	t.Run("split packets reassembly", func(t *testing.T) {
+		data := make([]byte, 64*1024)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := nodeB.teo.SendTo("node-a", CmdUser, data); err != nil {
+				t.Fatal(err)
+			}
+			pac := nodeA.wait(t, EventReceived, "node-b", 10*time.Second)
+			if pac.Cmd() != CmdUser || !bytes.Equal(pac.Data(), data) {
+				t.Fatalf("wrong combined packet, cmd: %d, data len: %d",
+					pac.Cmd(), len(pac.Data()))
+			}
+		}
+	})
+
+	t.Run("split unsafe packet", func(t *testing.T) {
+		data := bytes.Repeat([]byte("unsafe"), 1000)
+		tcd := nodeB.teo.arp.m["node-a"].tcd
+		// The packet may be lost, so resend it until received
+		for i := 0; ; i++ {
+			if i == 20 {
+				t.Fatal("unsafe packet does not received")
+			}
+			if _, err := nodeB.teo.sendToTcdUnsafe(tcd, CmdUser, data); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case ev := <-nodeA.ch:
+				if ev.Event == EventReceived && ev.Data.Cmd() == CmdUser &&
+					bytes.Equal(ev.Data.Data(), data) {
+					return
+				}
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+	})
+
+	t.Run("reconnect after partition", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("skipping in short mode")
+		}
+		n.Partition("10.0.0.1", "10.0.0.2")
+		nodeA.wait(t, EventDisconnected, "node-b", 10*time.Second)
+		n.HealAll()
+		nodeA.wait(t, EventConnected, "node-b", 20*time.Second)
+	})
+}
@@ -23,6 +23,11 @@ type receiveData struct {
 	tcd *trudp.ChannelData
 }
 
+// packetOverhead return length added to data by PacketCreateNew
+func (teo *Teonet) packetOverhead() int {
+	return len(teo.param.Name) + 1 + C.PACKET_HEADER_ADD_SIZE
+}
+
 // PacketCreateNew create teonet packet
 func (teo *Teonet) PacketCreateNew(from string, cmd byte, data []byte) (packet *Packet) {
 	fromC := C.CString(from)
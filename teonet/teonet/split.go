@@ -12,34 +12,61 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 	"unsafe"
+
+	"github.com/kirill-scherba/teonet-go/trudp/trudp"
 )
 
 // splitPacket split module data structure
 type splitPacket struct {
 	packetNum uint16
 	teo       *Teonet
-	m         map[string]*receiveData
+	m         map[string]*splitReceive
+	expired   time.Time // Last time when expired packets removed
+}
+
+// splitReceive is received subpackets of one packet
+type splitReceive struct {
+	parts map[uint16][]byte // Subpackets data by subpacket number
+	last  int               // Last subpacket number (-1 - not received yet)
+	time  time.Time         // Time when first subpacket received
 }
 
 const (
-	maxDataLen     = 448
+	maxDataLen     = 448              // Min subpacket data length (used before channel path MTU probed)
+	splitExpire    = 30 * time.Second // Not combined packet subpackets removed after
 	maxPacketLen   = 0x7FFFF * 2
 	lastPacketFlag = 0x8000
+	splitHeaderLen = 5 // Subpacket header: packet and subpacket numbers and command
 )
 
 // splitNew create splitPacket receiver
 func (teo *Teonet) splitNew() *splitPacket {
-	return &splitPacket{teo: teo, m: make(map[string]*receiveData)}
+	return &splitPacket{teo: teo, m: make(map[string]*splitReceive)}
+}
+
+// splitLen return max subpacket data length to send teonet packet to trudp
+// channel without ip fragmentation. It calculated from channel path MTU and
+// is not less than maxDataLen.
+func (teo *Teonet) splitLen(tcd *trudp.ChannelData) (l int) {
+	l = tcd.MTU() - tcd.Overhead() - splitHeaderLen -
+		teo.packetOverhead() - teo.cry.overhead()
+	if l < maxDataLen {
+		l = maxDataLen
+	}
+	return
 }
 
-// split spits data to subpackets and return number subpacket. For each
-// subpacket the 'f func(data []byte)' callback function calls. If data len
-// less than maxPacketLen num = 0 and callback function does not calls
-func (split *splitPacket) split(cmd byte, data []byte, f func(cmd byte, data []byte)) (num int, err error) {
+// split spits data to subpackets with maxLen data length and return number
+// subpacket. For each subpacket the 'f func(data []byte)' callback function
+// calls. If data len less than maxLen num = 0 and callback function calls
+// once with unsplit data
+func (split *splitPacket) split(cmd byte, data []byte, maxLen int,
+	f func(cmd byte, data []byte)) (num int, err error) {
 
 	// Send unsplit packet
-	if len(data) < maxDataLen {
+	if len(data) < maxLen {
 		f(cmd, data)
 		return
 	}
@@ -69,9 +96,9 @@ func (split *splitPacket) split(cmd byte, data []byte, f func(cmd byte, data []b
 	// Split data to subpackets and execute callback function
 	for len(data) > 0 {
 		l := len(data)
-		last := l <= maxDataLen
+		last := l <= maxLen
 		if !last {
-			l = maxDataLen
+			l = maxLen
 		}
 		callback(&num, data[:l], last)
 		data = data[l:]
@@ -84,6 +111,11 @@ func (split *splitPacket) split(cmd byte, data []byte, f func(cmd byte, data []b
 func (split *splitPacket) combine(rec *receiveData) (packet []byte, cmd byte, err error) {
 
 	// Parse command
+	const ptr = int(unsafe.Sizeof(uint16(0))) * 2
+	if len(rec.rd.Data()) < ptr {
+		err = errors.New("wrong subpacket length")
+		return
+	}
 	buf := bytes.NewReader(rec.rd.Data())
 	le := binary.LittleEndian
 	var packetNum, subpacketNum uint16
@@ -92,47 +124,54 @@ func (split *splitPacket) combine(rec *receiveData) (packet []byte, cmd byte, er
 	lastPacket := subpacketNum&lastPacketFlag != 0
 	subpacketNum = subpacketNum & (lastPacketFlag - 1)
 
-	// makeKey create string to use it as key in map
-	// Map key structure:
-	//
-	// uint8_t  from_length
-	// char[]   from
-	// uint16   packet_num
-	// uint16   sub_packet_num
-	//
-	makeKey := func(from string, packetNum, subpacketNum uint16) string {
-		return fmt.Sprintf("%s:%d:%d", from, packetNum, subpacketNum)
+	// Remove subpackets of packets which was not combined during
+	// splitExpire (subpacket may be lost when packet sent without delivery
+	// guarantee)
+	now := time.Now()
+	if now.Sub(split.expired) > time.Second {
+		split.expired = now
+		for key, r := range split.m {
+			if now.Sub(r.time) > splitExpire {
+				delete(split.m, key)
+			}
+		}
 	}
 
-	// addToMap add packet to map
-	addToMap := func(key string, rec *receiveData) {
-		split.m[key] = rec
+	// Save subpacket to map, subpackets may be received in any order
+	key := fmt.Sprintf("%s:%d", rec.rd.From(), packetNum)
+	r, ok := split.m[key]
+	if !ok {
+		r = &splitReceive{parts: make(map[uint16][]byte), last: -1, time: now}
+		split.m[key] = r
 	}
-
-	// Save packet to map
-	addToMap(makeKey(rec.rd.From(), packetNum, subpacketNum), rec)
-	if !lastPacket {
+	r.parts[subpacketNum] = rec.rd.Data()[ptr:]
+	if lastPacket {
+		r.last = int(subpacketNum)
+	}
+	if r.last < 0 || len(r.parts) < r.last+1 {
 		return
 	}
-
-	// Combine packet
-	const ptr = int(unsafe.Sizeof(packetNum)) * 2
-	for i := 0; i <= int(subpacketNum); i++ {
-		key := makeKey(rec.rd.From(), packetNum, uint16(i))
-		rec, ok := split.m[key]
-		if !ok {
-			err = errors.New("the subpacket has not received or added to the map")
-			packet = nil
+	for i := 0; i <= r.last; i++ {
+		if _, ok := r.parts[uint16(i)]; !ok {
 			return
 		}
-		data := rec.rd.Data()[ptr:]
+	}
+
+	// Combine packet when all subpackets received
+	delete(split.m, key)
+	for i := 0; i <= r.last; i++ {
+		data := r.parts[uint16(i)]
 		if i == 0 {
+			// The first subpacket contains command after data
+			if len(data) == 0 {
+				err = errors.New("the first subpacket has not command")
+				return nil, 0, err
+			}
 			l := len(data) - 1
 			cmd = data[l]
 			data = data[:l]
 		}
 		packet = append(packet, data...)
-		delete(split.m, key)
 	}
 
 	return
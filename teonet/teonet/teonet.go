@@ -95,7 +95,12 @@ func Connect(param *Parameters, appType []string, appVersion string,
 	teo.ev = teo.eventNew()
 
 	// Trudp init
-	teo.td = trudp.Init(&param.Port)
+	teo.td = trudp.Init(&param.Port, param.Transport, trudp.MTUDiscovery(param.TrudpPMTU),
+		trudp.Protection{
+			Cookie:           param.TrudpCookie,
+			MaxChannels:      param.TrudpMaxChannels,
+			MaxChannelsPerIP: param.TrudpMaxChanIP,
+		})
 	teo.td.AllowEvents(1) // \TODO: set events connected by '||'' to allow it
 	teo.td.SetShowStatistic(param.ShowTrudpStatF)
 
@@ -278,11 +283,19 @@ FOR:
 				teolog.Connect(MODULE, "got CONNECTED event, channel key: "+
 					string(packet))
 
-			case trudp.EvDisconnected:
-				teolog.Connect(MODULE, "got DISCONNECTED event, channel key: "+
-					string(packet))
-				// Reconnect to r-host
-				teo.rhost.reconnect(ev.Tcd)
+			case trudp.EvDisconnected, trudp.EvClosed:
+				if ev.Event == trudp.EvClosed {
+					teolog.Connect(MODULE, "got CLOSED event, channel key: "+
+						string(packet))
+				} else {
+					teolog.Connect(MODULE, "got DISCONNECTED event, channel key: "+
+						string(packet))
+				}
+				// Reconnect to r-host if channel lost or closed by r-host,
+				// channel closed by this host does not reconnected
+				if ev.Event == trudp.EvDisconnected || ev.Tcd.ClosedByRemote() {
+					teo.rhost.reconnect(ev.Tcd)
+				}
 				// Delete peer from arp table
 				teo.arp.deleteKey(string(packet))
 				// Close l0 client
@@ -290,6 +303,12 @@ FOR:
 					teo.l0.close(client)
 				}
 
+			case trudp.EvMigrated:
+				teolog.Connect(MODULE, "got MIGRATED event, channel key: "+
+					string(packet)+" changed to: "+ev.Tcd.GetKey())
+				// Change l0 client address
+				teo.l0.readdress(string(packet), ev.Tcd.GetKey())
+
 			case trudp.EvResetLocal:
 				err = errors.New("got RESET_LOCAL event, channel key: " +
 					ev.Tcd.GetKey())
@@ -453,22 +472,13 @@ func (teo *Teonet) sendAnswer(rec *receiveData, cmd byte, data []byte) (length i
 func (teo *Teonet) sendToTcd(tcd *trudp.ChannelData, cmd byte, data []byte) (length int,
 	err error) {
 
-	// makePac creates new teonet packet and show 'send' log message
-	makePac := func(tcd *trudp.ChannelData, cmd byte, data []byte) []byte {
-		pac := teo.PacketCreateNew(teo.param.Name, cmd, data)
-		to, _ := teo.arp.peer(tcd)
-		teolog.DebugVf(MODULE, "send cmd: %d, to: %s, data_len: %d\n", cmd, to,
-			len(data))
-		return teo.cry.encrypt(pac.packet)
-	}
-
 	// send splitted packet or send whole packet
 	if tcd == nil {
 		return teo.sendToHimself(teo.param.Name, cmd, data)
 	}
-	_, err = teo.split.split(cmd, data, func(cmd byte, data []byte) {
+	_, err = teo.split.split(cmd, data, teo.splitLen(tcd), func(cmd byte, data []byte) {
 		var l int
-		l, err = tcd.Write(makePac(tcd, cmd, data))
+		l, err = tcd.Write(teo.makePacket(tcd, cmd, data))
 		if err != nil {
 			return
 		}
@@ -478,18 +488,35 @@ func (teo *Teonet) sendToTcd(tcd *trudp.ChannelData, cmd byte, data []byte) (len
 	return
 }
 
-// sendToTcd send command to Teonet peer by known trudp channel
-func (teo *Teonet) sendToTcdUnsafe(tcd *trudp.ChannelData, cmd byte,
-	data []byte) (int, error) {
+// makePacket creates new encrypted teonet packet and show 'send' log message
+func (teo *Teonet) makePacket(tcd *trudp.ChannelData, cmd byte, data []byte) []byte {
 	pac := teo.PacketCreateNew(teo.param.Name, cmd, data)
 	to, _ := teo.arp.peer(tcd)
-	teolog.DebugVf(MODULE, "send cmd: %d, to: %s, data_len: %d (send direct udp)\n",
-		cmd, to, len(data))
-	// \TODO: split data!! We can't split Unsafe packet bekause we can't delivery
-	// much unfsafe packets and than combine it. So sugest return err "too large
-	// data packet" if the length more than 1024 - 1280 (more than mtu, more than
-	// udp packet)... or lets him try send any size packets :-)
-	return tcd.WriteUnsafe(teo.cry.encrypt(pac.packet))
+	teolog.DebugVf(MODULE, "send cmd: %d, to: %s, data_len: %d\n", cmd, to,
+		len(data))
+	return teo.cry.encrypt(pac.packet)
+}
+
+// sendToTcdUnsafe send command to Teonet peer by known trudp channel without
+// delivery guarantee. The packet is sent direct by udp, large packet is
+// splitted and its subpackets are sent direct by udp too (the packet is lost
+// if one of subpackets lost).
+func (teo *Teonet) sendToTcdUnsafe(tcd *trudp.ChannelData, cmd byte,
+	data []byte) (length int, err error) {
+	splitLen := teo.splitLen(tcd)
+	if len(data) < splitLen {
+		teolog.DebugVf(MODULE, "send direct udp\n")
+		return tcd.WriteUnsafe(teo.makePacket(tcd, cmd, data))
+	}
+	_, err = teo.split.split(cmd, data, splitLen, func(cmd byte, data []byte) {
+		var l int
+		l, err = tcd.WriteUnsafe(teo.makePacket(tcd, cmd, data))
+		if err != nil {
+			return
+		}
+		length += l
+	})
+	return
 }
 
 // Type return this teonet application type (array of types)
@@ -2,8 +2,12 @@ package teonet
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/teocli/teocli"
 )
 
 func TestPacket(t *testing.T) {
@@ -76,3 +80,144 @@ func TestPacket(t *testing.T) {
 		}
 	})
 }
+
+// FuzzHostInfo check host info answer parser does not panic
+func FuzzHostInfo(f *testing.F) {
+	f.Add([]byte("\x00\x04\x05\x02teo-go\x00teo-node\x00"))
+	f.Add([]byte(`{"name":"teo-go","type":["teo-node"],"version":"0.4.5"}` + "\x00"))
+	f.Add([]byte("\x00\x04\x05\x03teo-go\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, typeAr, err := parseHostInfo(data); err == nil && len(typeAr) == 0 {
+			t.Fatal("host info parsed without host name")
+		}
+	})
+}
+
+func TestSplit(t *testing.T) {
+	const peer = "teo-go-test"
+	teo := &Teonet{}
+	data := bytes.Repeat([]byte("split"), 100)
+	var sub [][]byte
+	split := teo.splitNew()
+	split.split(129, data, 64, func(cmd byte, data []byte) {
+		sub = append(sub, append([]byte(nil), data...))
+	})
+	combine := func(split *splitPacket, data []byte) ([]byte, byte, error) {
+		rd, err := teo.PacketCreateNew(peer, CmdSplit, data).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return split.combine(&receiveData{rd: rd})
+	}
+
+	t.Run("combine in any order", func(t *testing.T) {
+		split := teo.splitNew()
+		for i := len(sub) - 1; i >= 0; i-- {
+			packet, cmd, err := combine(split, sub[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i > 0 && packet != nil {
+				t.Fatalf("packet combined before subpacket %d received", i)
+			}
+			if i == 0 && (cmd != 129 || !bytes.Equal(packet, data)) {
+				t.Fatalf("wrong combined packet, cmd: %d, data len: %d", cmd,
+					len(packet))
+			}
+		}
+		if len(split.m) != 0 {
+			t.Errorf("combined packet subpackets does not removed")
+		}
+	})
+
+	t.Run("remove expired subpackets", func(t *testing.T) {
+		split := teo.splitNew()
+		combine(split, sub[0])
+		for _, r := range split.m {
+			r.time = r.time.Add(-splitExpire - time.Second)
+		}
+		split.expired = time.Time{}
+		combine(split, sub[len(sub)-1])
+		if len(split.m) != 1 {
+			t.Fatalf("expired subpackets does not removed, packets: %d",
+				len(split.m))
+		}
+		for _, r := range split.m {
+			if _, ok := r.parts[0]; ok {
+				t.Errorf("expired subpacket does not removed")
+			}
+		}
+	})
+}
+
+// FuzzSplitCombine check splitted packets combine does not panic and
+// combines packets created by split
+func FuzzSplitCombine(f *testing.F) {
+	const peer = "teo-go-fuzz"
+	teo := &Teonet{}
+	subpackets := func(data []byte, maxLen int) (sub [][]byte) {
+		teo.splitNew().split(129, data, maxLen, func(cmd byte, data []byte) {
+			sub = append(sub, append([]byte(nil), data...))
+		})
+		return
+	}
+	f.Add([]byte("Hello teonet!"), 4)
+	f.Add(bytes.Repeat([]byte{1, 2, 3}, 100), 16)
+	for _, sub := range subpackets([]byte("Hello teonet!"), 4) {
+		f.Add(sub, 0)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, maxLen int) {
+		split := teo.splitNew()
+		combine := func(data []byte) ([]byte, byte, error) {
+			rd, err := teo.PacketCreateNew(peer, CmdSplit, data).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return split.combine(&receiveData{rd: rd})
+		}
+
+		// Combine fuzzer data as subpacket
+		combine(data)
+
+		// Combine subpackets created by split
+		if maxLen < 1 || maxLen > len(data) || len(data) > 0x4000 {
+			return
+		}
+		sub := subpackets(data, maxLen)
+		if len(sub) < 2 {
+			return
+		}
+		var packet []byte
+		var cmd byte
+		for _, d := range sub {
+			var err error
+			if packet, cmd, err = combine(d); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if cmd != 129 || !bytes.Equal(packet, data) {
+			t.Fatalf("wrong combined packet, cmd: %d, data: %v", cmd, packet)
+		}
+	})
+}
+
+// FuzzBinaryToJSON check binary peers array parser does not panic
+func FuzzBinaryToJSON(f *testing.F) {
+	peers := func(peer ...[]byte) []byte {
+		data := make([]byte, 4)
+		binary.LittleEndian.PutUint32(data, uint32(len(peer)))
+		for _, p := range peer {
+			data = append(data, p...)
+		}
+		return data
+	}
+	p1 := teocli.PeerData(0, "teo-go-1", "127.0.0.1", 9010, 0.125)
+	p2 := teocli.PeerData(-1, "teo-go-2", "10.0.0.1", 9011, 12.5)
+	f.Add(peers())
+	f.Add(peers(p1))
+	f.Add(peers(p1, p2))
+	f.Add(peers(p1, p2)[:100])
+	f.Fuzz(func(t *testing.T, data []byte) {
+		(&arp{}).binaryToJSON(data)
+	})
+}
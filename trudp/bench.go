@@ -0,0 +1,351 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Benchmark mode of Trudp sample application. The client sends messages to
+// the server during selected time or selected number of bytes and reports
+// throughput, latency percentiles, retransmit ratio and CPU time. The server
+// answers each message with its send time header and reports received data
+// of each channel.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+	"github.com/kirill-scherba/teonet-go/trudp/trudp"
+)
+
+// Benchmark message header: message send time in nanoseconds
+const (
+	benchHeaderLen = 8
+	benchMaxSize   = 0xFFF // Max trudp packet payload length
+	benchMaxChan   = 16    // Number of trudp channels
+)
+
+// benchParams is benchmark mode parameters
+type benchParams struct {
+	client   bool          // Run benchmark client
+	server   bool          // Run benchmark server
+	duration time.Duration // Benchmark duration
+	bytes    int64         // Number of bytes to send (0 - unlimited)
+	size     int           // Message size
+	parallel int           // Number of parallel channels
+	rate     float64       // Send rate in Mbit/s (0 - unlimited)
+	json     string        // Save report in JSON format to file (- to stdout)
+}
+
+// benchLatency is latency percentiles in milliseconds
+type benchLatency struct {
+	Samples int     `json:"samples"`
+	Min     float64 `json:"min_ms"`
+	P50     float64 `json:"p50_ms"`
+	P90     float64 `json:"p90_ms"`
+	P99     float64 `json:"p99_ms"`
+	Max     float64 `json:"max_ms"`
+}
+
+// benchReport is benchmark report
+type benchReport struct {
+	Mode            string        `json:"mode"`
+	Version         string        `json:"version"`
+	Remote          string        `json:"remote"`
+	Channels        int           `json:"channels"`
+	MessageSize     int           `json:"message_size"`
+	Duration        float64       `json:"duration_sec"`
+	Messages        uint64        `json:"messages"`
+	Bytes           uint64        `json:"bytes"`
+	Throughput      float64       `json:"throughput_mbps"`
+	MessagesPerSec  float64       `json:"messages_per_sec"`
+	Latency         *benchLatency `json:"latency,omitempty"`
+	Retransmits     uint32        `json:"retransmits"`
+	RetransmitRatio float64       `json:"retransmit_ratio"`
+	CPUUser         float64       `json:"cpu_user_sec"`
+	CPUSystem       float64       `json:"cpu_system_sec"`
+}
+
+// check benchmark parameters
+func (b *benchParams) check(rport int) error {
+	switch {
+	case b.client && rport == 0:
+		return errors.New("benchmark client requires remote host port")
+	case b.size < benchHeaderLen || b.size > benchMaxSize:
+		return fmt.Errorf("message size should be from %d to %d",
+			benchHeaderLen, benchMaxSize)
+	case b.parallel < 1 || b.parallel > benchMaxChan:
+		return fmt.Errorf("number of channels should be from 1 to %d",
+			benchMaxChan)
+	case b.duration <= 0 && b.bytes <= 0:
+		return errors.New("benchmark requires duration or number of bytes")
+	}
+	return nil
+}
+
+// run start benchmark client or server
+func (b *benchParams) run(port int, rhost string, rport, rchan int) {
+	if err := b.check(rport); err != nil {
+		fmt.Fprintln(os.Stderr, "benchmark:", err)
+		os.Exit(2)
+	}
+	tru := trudp.Init(&port)
+	if b.server {
+		b.runServer(tru)
+		return
+	}
+	go tru.Run()
+	report := b.runClient(tru, rhost, rport, rchan)
+	tru.Close()
+	b.show(report)
+}
+
+// show print benchmark report and save it in JSON format. Server reports
+// are appended to JSON file.
+func (b *benchParams) show(r *benchReport) {
+	if b.json != "" {
+		data, _ := json.MarshalIndent(r, "", "  ")
+		data = append(data, '\n')
+		if b.json == "-" {
+			os.Stdout.Write(data)
+			return
+		}
+		f, err := os.OpenFile(b.json, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err == nil {
+			_, err = f.Write(data)
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "benchmark:", err)
+		}
+	}
+	fmt.Printf("%s %s, channels: %d, message size: %d\n",
+		r.Mode, r.Remote, r.Channels, r.MessageSize)
+	fmt.Printf("  %.3f sec  %d messages  %d bytes  %.3f Mbit/s  %.0f msg/s\n",
+		r.Duration, r.Messages, r.Bytes, r.Throughput, r.MessagesPerSec)
+	if r.Latency != nil {
+		l := r.Latency
+		fmt.Printf("  latency ms: min %.3f  p50 %.3f  p90 %.3f  p99 %.3f  "+
+			"max %.3f (%d samples)\n", l.Min, l.P50, l.P90, l.P99, l.Max,
+			l.Samples)
+	}
+	if r.Mode == "client" {
+		fmt.Printf("  retransmits: %d (%.2f%%)\n", r.Retransmits,
+			100*r.RetransmitRatio)
+	}
+	fmt.Printf("  cpu: user %.3f sec  system %.3f sec\n", r.CPUUser,
+		r.CPUSystem)
+}
+
+// runClient send messages to benchmark server and return report
+func (b *benchParams) runClient(tru *trudp.TRUDP, rhost string, rport,
+	rchan int) (r *benchReport) {
+
+	r = &benchReport{Mode: "client", Version: trudp.Version,
+		Remote: fmt.Sprintf("%s:%d", rhost, rport), Channels: b.parallel,
+		MessageSize: b.size}
+
+	// Receive answers and save latency
+	var mx sync.Mutex
+	var latency []float64
+	var answers uint64
+	go func() {
+		for ev := range tru.ChanEvent() {
+			if ev.Event != trudp.EvGotData || len(ev.Data) < benchHeaderLen {
+				continue
+			}
+			sent := int64(binary.LittleEndian.Uint64(ev.Data))
+			ms := float64(time.Now().UnixNano()-sent) / float64(time.Millisecond)
+			mx.Lock()
+			latency = append(latency, ms)
+			mx.Unlock()
+			atomic.AddUint64(&answers, 1)
+		}
+	}()
+
+	// Send messages to parallel channels
+	var messages, bytes uint64
+	var interval time.Duration
+	if b.rate > 0 {
+		interval = time.Duration(float64(b.size*8*b.parallel) /
+			(b.rate * 1e6) * float64(time.Second))
+	}
+	cpu := benchCPU()
+	start := time.Now()
+	deadline := start.Add(b.duration)
+	var wg sync.WaitGroup
+	tcds := make([]*trudp.ChannelData, b.parallel)
+	for i := range tcds {
+		tcd := tru.ConnectChannel(rhost, rport, (rchan+i)%benchMaxChan)
+		tcds[i] = tcd
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := make([]byte, b.size)
+			next := time.Now()
+			for {
+				now := time.Now()
+				if b.duration > 0 && now.After(deadline) {
+					return
+				}
+				if b.bytes > 0 && atomic.AddUint64(&bytes, uint64(b.size)) >
+					uint64(b.bytes) {
+					atomic.AddUint64(&bytes, ^uint64(b.size-1))
+					return
+				}
+				if interval > 0 {
+					if next.After(now) {
+						time.Sleep(next.Sub(now))
+					}
+					next = next.Add(interval)
+				}
+				binary.LittleEndian.PutUint64(data, uint64(time.Now().UnixNano()))
+				if _, err := tcd.Write(data); err != nil {
+					teolog.Error(MODULE, "benchmark write:", err)
+					return
+				}
+				if b.bytes <= 0 {
+					atomic.AddUint64(&bytes, uint64(b.size))
+				}
+				atomic.AddUint64(&messages, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	r.Duration = time.Since(start).Seconds()
+	r.CPUUser, r.CPUSystem = benchCPU().sub(cpu)
+
+	// Wait answers to last messages
+	for wait := time.Now(); atomic.LoadUint64(&answers) < messages &&
+		time.Since(wait) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Make report
+	s := tru.Stats()
+	r.Messages, r.Bytes = messages, bytes
+	r.Throughput = float64(bytes*8) / r.Duration / 1e6
+	r.MessagesPerSec = float64(messages) / r.Duration
+	r.Retransmits = s.Repeat
+	if s.Send > 0 {
+		r.RetransmitRatio = float64(s.Repeat) / float64(s.Send)
+	}
+	mx.Lock()
+	r.Latency = benchPercentiles(latency)
+	mx.Unlock()
+
+	// Close channels when answers received (the close time does not included
+	// to benchmark duration)
+	for _, tcd := range tcds {
+		tcd.Close()
+	}
+	for _, tcd := range tcds {
+		tcd.CloseWait()
+	}
+	return
+}
+
+// benchServerChannel is benchmark server channel data
+type benchServerChannel struct {
+	start    time.Time
+	messages uint64
+	bytes    uint64
+}
+
+// runServer answer benchmark messages and show report of each channel when
+// it closed
+func (b *benchParams) runServer(tru *trudp.TRUDP) {
+	ip, port := tru.GetAddr()
+	fmt.Printf("benchmark server listen at %s:%d\n", ip, port)
+
+	// Close trudp on Ctrl+C
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		tru.Close()
+	}()
+
+	go func() {
+		channels := make(map[string]*benchServerChannel)
+		cpu := benchCPU()
+		for ev := range tru.ChanEvent() {
+			switch ev.Event {
+			case trudp.EvGotData:
+				key := ev.Tcd.GetKey()
+				ch, ok := channels[key]
+				if !ok {
+					ch = &benchServerChannel{start: time.Now()}
+					channels[key] = ch
+					cpu = benchCPU()
+				}
+				ch.messages++
+				ch.bytes += uint64(len(ev.Data))
+				if len(ev.Data) >= benchHeaderLen {
+					ev.Tcd.WriteMessage(ev.Data[:benchHeaderLen], trudp.Unreliable)
+				}
+			case trudp.EvClosed, trudp.EvDisconnected:
+				key := string(ev.Data)
+				ch, ok := channels[key]
+				if !ok {
+					continue
+				}
+				delete(channels, key)
+				r := &benchReport{Mode: "server", Version: trudp.Version,
+					Remote: key, Channels: 1, Messages: ch.messages,
+					Bytes: ch.bytes, Duration: time.Since(ch.start).Seconds()}
+				if ch.messages > 0 {
+					r.MessageSize = int(ch.bytes / ch.messages)
+				}
+				r.Throughput = float64(ch.bytes*8) / r.Duration / 1e6
+				r.MessagesPerSec = float64(ch.messages) / r.Duration
+				r.CPUUser, r.CPUSystem = benchCPU().sub(cpu)
+				b.show(r)
+			}
+		}
+	}()
+	tru.Run()
+}
+
+// benchPercentiles return latency percentiles or nil if there is not samples
+func benchPercentiles(latency []float64) *benchLatency {
+	if len(latency) == 0 {
+		return nil
+	}
+	sort.Float64s(latency)
+	p := func(p float64) float64 {
+		return latency[int(p*float64(len(latency)-1))]
+	}
+	return &benchLatency{Samples: len(latency), Min: latency[0], P50: p(0.5),
+		P90: p(0.9), P99: p(0.99), Max: latency[len(latency)-1]}
+}
+
+// benchCPUTime is process CPU time
+type benchCPUTime struct {
+	user, system time.Duration
+}
+
+// benchCPU return process CPU time
+func benchCPU() (t benchCPUTime) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return
+	}
+	t.user = time.Duration(ru.Utime.Nano())
+	t.system = time.Duration(ru.Stime.Nano())
+	return
+}
+
+// sub return CPU time in seconds since t0
+func (t benchCPUTime) sub(t0 benchCPUTime) (user, system float64) {
+	return (t.user - t0.user).Seconds(), (t.system - t0.system).Seconds()
+}
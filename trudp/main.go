@@ -48,6 +48,9 @@ func main() {
 		sendTest     bool
 		showStat     bool
 		sendAnswer   bool
+
+		// Benchmark mode parameters
+		bench benchParams
 	)
 
 	flag.IntVar(&maxQueueSize, "Q", trudp.DefaultQueueSize, "maximum send and receive queues size")
@@ -62,9 +65,25 @@ func main() {
 	flag.BoolVar(&sendTest, "send-test", false, "send test data")
 	flag.BoolVar(&sendAnswer, "answer", false, "send answer")
 	flag.BoolVar(&showStat, "S", false, "show statistic")
+	flag.BoolVar(&bench.client, "bench", false, "run benchmark client (connect to remote host)")
+	flag.BoolVar(&bench.server, "bench-server", false, "run benchmark server")
+	flag.DurationVar(&bench.duration, "bench-time", 10*time.Second, "benchmark duration (0 - send selected number of bytes)")
+	flag.Int64Var(&bench.bytes, "bench-bytes", 0, "benchmark number of bytes to send (0 - unlimited)")
+	flag.IntVar(&bench.size, "bench-size", 1024, "benchmark message size")
+	flag.IntVar(&bench.parallel, "bench-parallel", 1, "benchmark number of parallel channels")
+	flag.Float64Var(&bench.rate, "bench-rate", 0, "benchmark send rate in Mbit/s (0 - unlimited)")
+	flag.StringVar(&bench.json, "bench-json", "", "save benchmark report in JSON format to file (- to stdout)")
 
 	flag.Parse()
 
+	// Run benchmark mode
+	if bench.client || bench.server {
+		teolog.Init(logLevel, log.Lmicroseconds|log.Lshortfile, logFilter,
+			logToSyslogF, "trudp")
+		bench.run(port, rhost, rport, rchan)
+		return
+	}
+
 	for reconnectF := false; ; {
 
 		tru := trudp.Init(&port)
@@ -114,6 +133,10 @@ func main() {
 					teolog.Log(teolog.CONNECT, MODULE, "DISCONNECTED from:",
 						string(ev.Data))
 
+				case trudp.EvClosed:
+					teolog.Log(teolog.CONNECT, MODULE, "CLOSED:",
+						string(ev.Data))
+
 				case trudp.EvResetLocal:
 					teolog.Log(teolog.DEBUG, MODULE, "RESET_LOCAL executed at channel:",
 						ev.Tcd.GetKey())
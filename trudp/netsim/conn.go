@@ -0,0 +1,78 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Virtual network connection module.
+
+package netsim
+
+import (
+	"net"
+	"time"
+)
+
+// Conn is the virtual network connection. It implements trudp.PacketTransport
+// interface. Packets sent to loopback address are delivered to connections of
+// the same host.
+type Conn struct {
+	n      *Network      // Network this connection belongs to
+	addr   *net.UDPAddr  // Connection local address
+	ch     chan *packet  // Receive buffer
+	close  chan struct{} // Closed signal
+	closed bool          // Closed flag (protected by network mutex)
+
+	// Delivery queue (protected by network mutex)
+	queue deliveryQueue // Delayed packets
+	seq   uint64        // Last schedule sequence number
+	timer *time.Timer   // Delivery timer
+}
+
+// ReadFrom reads packet from connection receive buffer. It blocks until packet
+// received or connection closed.
+func (c *Conn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	select {
+	case pac := <-c.ch:
+		n = copy(b, pac.data)
+		addr = pac.from
+	case <-c.close:
+		err = ErrClosed
+	}
+	return
+}
+
+// WriteTo sends packet to remote address. The addr should be *net.UDPAddr.
+func (c *Conn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	select {
+	case <-c.close:
+		err = ErrClosed
+		return
+	default:
+	}
+	to, ok := addr.(*net.UDPAddr)
+	if !ok {
+		if to, err = net.ResolveUDPAddr(network, addr.String()); err != nil {
+			return
+		}
+	}
+	c.n.send(c, b, to)
+	n = len(b)
+	return
+}
+
+// LocalAddr returns connection local address
+func (c *Conn) LocalAddr() net.Addr {
+	c.n.mx.Lock()
+	defer c.n.mx.Unlock()
+	return c.addr
+}
+
+// Rebind moves connection to new address (simulates NAT rebinding or network
+// change). Free port is selected if port is 0.
+func (c *Conn) Rebind(address string) error {
+	return c.n.rebind(c, address)
+}
+
+// Close closes connection. Blocked ReadFrom returns error after Close.
+func (c *Conn) Close() error {
+	return c.n.remove(c)
+}
@@ -0,0 +1,370 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package netsim is the in-memory virtual network used to test TR-UDP
+// channels and Teonet nodes.
+//
+// The network connects virtual hosts by links with configurable latency,
+// jitter, loss, reordering, duplication and bandwidth, and may be partitioned.
+// All random decisions are made by the network random generator created from
+// the seed, so the same seed gives the same sequence of impairments. The
+// network Conn implements the trudp.PacketTransport interface.
+package netsim
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Network name returned by virtual addresses
+	network = "udp"
+
+	// Size of connection receive buffer in packets
+	recvBufferSize = 4096
+
+	// First port number used for connections listen on port 0
+	firstPort = 30000
+)
+
+// ErrClosed returned by connection functions after connection was closed
+var ErrClosed = errors.New("use of closed virtual network connection")
+
+// Link is the virtual network link configuration. The zero Link value is an
+// ideal link which delivers all packets immediately and in order.
+type Link struct {
+	Latency      time.Duration // One way delay
+	Jitter       time.Duration // Random delay added to Latency: 0..Jitter
+	Loss         float64       // Probability of packet loss: 0..1
+	Reorder      float64       // Probability of packet reordering: 0..1
+	ReorderDelay time.Duration // Delay added to reordered packet (2 * Latency if 0)
+	Duplicate    float64       // Probability of packet duplication: 0..1
+	Bandwidth    int           // Link bandwidth in bytes per second (0 - unlimited)
+	QueueSize    int           // Max bytes waiting in bandwidth queue (0 - unlimited)
+	MTU          int           // Max packet length, larger packets are dropped (0 - unlimited)
+}
+
+// Stats is the virtual network statistic
+type Stats struct {
+	Sent       uint64 // Packets sent to network
+	Delivered  uint64 // Packets delivered to connections
+	Lost       uint64 // Packets lost by Loss
+	Duplicated uint64 // Packets duplicated by Duplicate
+	Reordered  uint64 // Packets reordered by Reorder
+	Dropped    uint64 // Packets dropped by bandwidth queue or receive buffer
+	Oversized  uint64 // Packets dropped by MTU
+	Blocked    uint64 // Packets blocked by partitions
+	Unreached  uint64 // Packets sent to address without connection
+}
+
+// Network is the in-memory virtual network
+type Network struct {
+	mx         sync.Mutex
+	rand       *rand.Rand           // Random generator created from seed
+	link       Link                 // Default link configuration
+	links      map[linkKey]*Link    // Links configurations between hosts
+	busy       map[linkKey]linkBusy // Bandwidth queues state
+	partitions map[linkKey]bool     // Partitioned hosts
+	conns      map[string]*Conn     // Connections by address
+	nextPort   map[string]int       // Next free port by host
+	stats      Stats                // Network statistic
+}
+
+// linkKey is the directional link key: source and destination hosts IPs
+type linkKey struct{ from, to string }
+
+// linkBusy is the link bandwidth queue state
+type linkBusy struct {
+	until time.Time // Time when last queued packet leave the link
+}
+
+// packet is the packet in network
+type packet struct {
+	data []byte
+	from *net.UDPAddr
+}
+
+// New create new virtual network. The seed initializes network random
+// generator.
+func New(seed int64) *Network {
+	return &Network{
+		rand:       rand.New(rand.NewSource(seed)),
+		links:      make(map[linkKey]*Link),
+		busy:       make(map[linkKey]linkBusy),
+		partitions: make(map[linkKey]bool),
+		conns:      make(map[string]*Conn),
+		nextPort:   make(map[string]int),
+	}
+}
+
+// SetLink sets default link configuration used between hosts which has not
+// its own link configuration.
+func (n *Network) SetLink(link Link) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	n.link = link
+}
+
+// SetHostLink sets link configuration for packets sent from host 'from' to
+// host 'to'. Hosts are IP addresses strings.
+func (n *Network) SetHostLink(from, to string, link Link) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	n.links[linkKey{from, to}] = &link
+}
+
+// Partition blocks all packets between hosts a and b in both directions.
+func (n *Network) Partition(a, b string) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	n.partitions[linkKey{a, b}] = true
+	n.partitions[linkKey{b, a}] = true
+}
+
+// Heal removes partition between hosts a and b.
+func (n *Network) Heal(a, b string) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	delete(n.partitions, linkKey{a, b})
+	delete(n.partitions, linkKey{b, a})
+}
+
+// HealAll removes all partitions.
+func (n *Network) HealAll() {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	n.partitions = make(map[linkKey]bool)
+}
+
+// Stats return copy of network statistic
+func (n *Network) Stats() Stats {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	return n.stats
+}
+
+// Listen create new connection on virtual network. The address is in
+// 'host:port' format where host is IP address. Free port is selected if port
+// is 0.
+func (n *Network) Listen(address string) (conn *Conn, err error) {
+	addr, err := n.resolve(address)
+	if err != nil {
+		return
+	}
+
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	key, err := n.bind(addr)
+	if err != nil {
+		return
+	}
+	conn = &Conn{
+		n:     n,
+		addr:  addr,
+		ch:    make(chan *packet, recvBufferSize),
+		close: make(chan struct{}),
+	}
+	conn.timer = time.AfterFunc(time.Hour, conn.deliverScheduled)
+	conn.timer.Stop()
+	n.conns[key] = conn
+	return
+}
+
+// bind select free port if address port is 0 and check address is free,
+// must be called under network mutex
+func (n *Network) bind(addr *net.UDPAddr) (key string, err error) {
+	host := addr.IP.String()
+	if addr.Port == 0 {
+		port, ok := n.nextPort[host]
+		if !ok {
+			port = firstPort
+		}
+		for ; n.conns[hostPort(host, port)] != nil; port++ {
+		}
+		n.nextPort[host] = port + 1
+		addr.Port = port
+	}
+	key = addr.String()
+	if _, ok := n.conns[key]; ok {
+		err = errors.New("address already in use: " + key)
+	}
+	return
+}
+
+// rebind move connection to new address
+func (n *Network) rebind(conn *Conn, address string) (err error) {
+	addr, err := n.resolve(address)
+	if err != nil {
+		return
+	}
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	if conn.closed {
+		return ErrClosed
+	}
+	key, err := n.bind(addr)
+	if err != nil {
+		return
+	}
+	delete(n.conns, conn.addr.String())
+	conn.addr = addr
+	n.conns[key] = conn
+	return
+}
+
+// resolve resolve connection address, the host IP address is required
+func (n *Network) resolve(address string) (addr *net.UDPAddr, err error) {
+	addr, err = net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return
+	}
+	if addr.IP == nil || addr.IP.IsUnspecified() || addr.IP.IsLoopback() {
+		err = errors.New("host IP address required: " + address)
+	}
+	return
+}
+
+// hostPort return address string
+func hostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// send route packet from connection to destination address
+func (n *Network) send(from *Conn, b []byte, to *net.UDPAddr) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	n.stats.Sent++
+
+	// Loopback address routes packet to the sender host
+	src := from.addr
+	dst := to
+	if to.IP.IsLoopback() {
+		src = &net.UDPAddr{IP: to.IP, Port: from.addr.Port}
+		dst = &net.UDPAddr{IP: from.addr.IP, Port: to.Port}
+	}
+	fromHost, toHost := from.addr.IP.String(), dst.IP.String()
+
+	// Check partitions and destination
+	if n.partitions[linkKey{fromHost, toHost}] {
+		n.stats.Blocked++
+		return
+	}
+	conn, ok := n.conns[dst.String()]
+	if !ok {
+		n.stats.Unreached++
+		return
+	}
+
+	// Select link configuration, loopback packets use ideal link
+	link := &n.link
+	if l, ok := n.links[linkKey{fromHost, toHost}]; ok {
+		link = l
+	}
+	if fromHost == toHost {
+		link = &Link{}
+	}
+
+	// MTU
+	if link.MTU > 0 && len(b) > link.MTU {
+		n.stats.Oversized++
+		return
+	}
+
+	// Loss
+	if link.Loss > 0 && n.rand.Float64() < link.Loss {
+		n.stats.Lost++
+		return
+	}
+
+	// Bandwidth queue
+	now := time.Now()
+	var delay time.Duration
+	if link.Bandwidth > 0 {
+		key := linkKey{fromHost, toHost}
+		busy := n.busy[key]
+		if busy.until.Before(now) {
+			busy.until = now
+		}
+		queued := busy.until.Sub(now)
+		if link.QueueSize > 0 &&
+			int64(queued)*int64(link.Bandwidth)/int64(time.Second) > int64(link.QueueSize) {
+			n.stats.Dropped++
+			return
+		}
+		busy.until = busy.until.Add(time.Duration(len(b)) * time.Second /
+			time.Duration(link.Bandwidth))
+		n.busy[key] = busy
+		delay = busy.until.Sub(now)
+	}
+
+	// Latency, jitter and reordering
+	delay += link.Latency
+	if link.Jitter > 0 {
+		delay += time.Duration(n.rand.Int63n(int64(link.Jitter)))
+	}
+	if link.Reorder > 0 && n.rand.Float64() < link.Reorder {
+		reorderDelay := link.ReorderDelay
+		if reorderDelay == 0 {
+			reorderDelay = 2*link.Latency + time.Millisecond
+		}
+		delay += reorderDelay
+		n.stats.Reordered++
+	}
+
+	// Send packet and its duplicate
+	pac := &packet{append([]byte(nil), b...), src}
+	n.deliver(conn, pac, delay)
+	if link.Duplicate > 0 && n.rand.Float64() < link.Duplicate {
+		var dupDelay time.Duration
+		if link.Jitter > 0 {
+			dupDelay = time.Duration(n.rand.Int63n(int64(link.Jitter)))
+		}
+		n.stats.Duplicated++
+		n.deliver(conn, pac, delay+dupDelay)
+	}
+}
+
+// deliver packet to connection after delay, must be called under network
+// mutex
+func (n *Network) deliver(conn *Conn, pac *packet, delay time.Duration) {
+	if delay <= 0 && conn.queue.Len() == 0 {
+		n.push(conn, pac)
+		return
+	}
+	conn.schedule(pac, time.Now().Add(delay))
+}
+
+// push packet to connection receive buffer, must be called under network
+// mutex
+func (n *Network) push(conn *Conn, pac *packet) {
+	if conn.closed {
+		n.stats.Unreached++
+		return
+	}
+	select {
+	case conn.ch <- pac:
+		n.stats.Delivered++
+	default:
+		n.stats.Dropped++
+	}
+}
+
+// remove connection from network
+func (n *Network) remove(conn *Conn) (err error) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	if conn.closed {
+		return ErrClosed
+	}
+	conn.closed = true
+	conn.timer.Stop()
+	close(conn.close)
+	delete(n.conns, conn.addr.String())
+	return
+}
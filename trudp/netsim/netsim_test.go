@@ -0,0 +1,139 @@
+package netsim
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// sendPackets send num packets from a to b and return number of received
+// packets after wait time
+func sendPackets(t *testing.T, a, b *Conn, num int, wait time.Duration) (received int) {
+	for i := 0; i < num; i++ {
+		if _, err := a.WriteTo([]byte{byte(i)}, b.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(wait)
+	return len(b.ch)
+}
+
+// listenPair create two connections on different hosts
+func listenPair(t *testing.T, n *Network) (a, b *Conn) {
+	var err error
+	if a, err = n.Listen("10.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = n.Listen("10.0.0.2:0"); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestNetwork(t *testing.T) {
+
+	t.Run("ideal link delivers in order", func(t *testing.T) {
+		a, b := listenPair(t, New(1))
+		sendPackets(t, a, b, 100, 0)
+		buf := make([]byte, 16)
+		for i := 0; i < 100; i++ {
+			n, addr, err := b.ReadFrom(buf)
+			if err != nil || n != 1 || buf[0] != byte(i) {
+				t.Fatalf("wrong packet %d: %v, %v", i, buf[:n], err)
+			}
+			if addr.String() != a.LocalAddr().String() {
+				t.Fatalf("wrong source address: %s", addr)
+			}
+		}
+	})
+
+	t.Run("loss is deterministic by seed", func(t *testing.T) {
+		run := func(seed int64) Stats {
+			n := New(seed)
+			n.SetLink(Link{Loss: 0.3})
+			a, b := listenPair(t, n)
+			sendPackets(t, a, b, 1000, 0)
+			return n.Stats()
+		}
+		s1, s2 := run(7), run(7)
+		if s1 != s2 {
+			t.Errorf("different stats with the same seed: %+v, %+v", s1, s2)
+		}
+		if s1.Lost < 200 || s1.Lost > 400 {
+			t.Errorf("wrong number of lost packets: %d", s1.Lost)
+		}
+	})
+
+	t.Run("latency and duplication", func(t *testing.T) {
+		n := New(1)
+		n.SetHostLink("10.0.0.1", "10.0.0.2", Link{Latency: 50 * time.Millisecond,
+			Duplicate: 1})
+		a, b := listenPair(t, n)
+		if r := sendPackets(t, a, b, 10, 10*time.Millisecond); r != 0 {
+			t.Errorf("packets received before latency: %d", r)
+		}
+		if r := sendPackets(t, a, b, 0, 100*time.Millisecond); r != 20 {
+			t.Errorf("wrong number of duplicated packets: %d", r)
+		}
+	})
+
+	t.Run("bandwidth queue drops packets", func(t *testing.T) {
+		n := New(1)
+		n.SetLink(Link{Bandwidth: 1000, QueueSize: 10})
+		a, b := listenPair(t, n)
+		sendPackets(t, a, b, 100, 50*time.Millisecond)
+		if s := n.Stats(); s.Dropped == 0 || s.Delivered == 0 {
+			t.Errorf("wrong bandwidth stats: %+v", s)
+		}
+	})
+
+	t.Run("partition and heal", func(t *testing.T) {
+		n := New(1)
+		a, b := listenPair(t, n)
+		n.Partition("10.0.0.1", "10.0.0.2")
+		if r := sendPackets(t, a, b, 10, 0); r != 0 {
+			t.Errorf("packets received through partition: %d", r)
+		}
+		n.Heal("10.0.0.1", "10.0.0.2")
+		if r := sendPackets(t, a, b, 10, 0); r != 10 {
+			t.Errorf("wrong number of packets after heal: %d", r)
+		}
+	})
+
+	t.Run("loopback and close", func(t *testing.T) {
+		n := New(1)
+		a, _ := listenPair(t, n)
+		c, err := n.Listen("10.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := c.LocalAddr().(*net.UDPAddr).Port
+		a.WriteTo([]byte("hello"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		buf := make([]byte, 16)
+		if n, _, err := c.ReadFrom(buf); err != nil || string(buf[:n]) != "hello" {
+			t.Errorf("wrong loopback packet: %s, %v", buf[:n], err)
+		}
+		c.Close()
+		if _, _, err := c.ReadFrom(buf); err != ErrClosed {
+			t.Errorf("wrong error after close: %v", err)
+		}
+	})
+
+	t.Run("rebind", func(t *testing.T) {
+		n := New(1)
+		a, b := listenPair(t, n)
+		old := a.LocalAddr().String()
+		if err := a.Rebind("10.0.0.3:0"); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Rebind(b.LocalAddr().String()); err == nil {
+			t.Error("rebind to used address does not return error")
+		}
+		sendPackets(t, a, b, 1, 0)
+		buf := make([]byte, 16)
+		if _, addr, err := b.ReadFrom(buf); err != nil ||
+			addr.String() != a.LocalAddr().String() || addr.String() == old {
+			t.Errorf("wrong source address after rebind: %s, %v", addr, err)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Virtual network delivery queue module.
+//
+// Delayed packets waits in connection delivery queue ordered by delivery time.
+// Packets with the same delivery time are delivered in the send order.
+
+package netsim
+
+import (
+	"container/heap"
+	"time"
+)
+
+// scheduled is the packet waiting delivery
+type scheduled struct {
+	pac *packet   // Packet
+	due time.Time // Delivery time
+	seq uint64    // Schedule sequence number
+}
+
+// deliveryQueue is the packets delivery queue, it implements heap.Interface
+type deliveryQueue []*scheduled
+
+func (q deliveryQueue) Len() int { return len(q) }
+func (q deliveryQueue) Less(i, j int) bool {
+	if q[i].due.Equal(q[j].due) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].due.Before(q[j].due)
+}
+func (q deliveryQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *deliveryQueue) Push(x interface{}) { *q = append(*q, x.(*scheduled)) }
+func (q *deliveryQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// schedule add packet to delivery queue, must be called under network mutex
+func (c *Conn) schedule(pac *packet, due time.Time) {
+	c.seq++
+	heap.Push(&c.queue, &scheduled{pac, due, c.seq})
+	if c.queue[0].pac == pac {
+		c.timer.Reset(time.Until(due))
+	}
+}
+
+// deliverScheduled push due packets from delivery queue to receive buffer
+func (c *Conn) deliverScheduled() {
+	c.n.mx.Lock()
+	defer c.n.mx.Unlock()
+	now := time.Now()
+	for c.queue.Len() > 0 && !c.queue[0].due.After(now) {
+		c.n.push(c, heap.Pop(&c.queue).(*scheduled).pac)
+	}
+	if c.queue.Len() > 0 {
+		c.timer.Reset(c.queue[0].due.Sub(now))
+	}
+}
@@ -13,17 +13,38 @@ import (
 
 // ChannelData is the TRUDP channel data structure
 type ChannelData struct {
-	trudp *TRUDP // link to trudp
+	trudp  *TRUDP  // link to trudp
+	worker *worker // worker which owns this channel
 
 	// Channels remote host address and channel number
-	addr *net.UDPAddr // UDP address
-	ch   int          // TRUDP channel number
-	key  string       // TRUDP channel key (address and channel string representation)
+	addr net.Addr // UDP or transport address
+	ch   int      // TRUDP channel number
+	key  string   // TRUDP channel key (address and channel string representation)
+	cid  uint64   // Connection ID (0 - channel does not use connection ID)
+
+	// Address migration
+	migration      migration
+	migrateKey     []byte    // Migration key (nil - channel does not migrate)
+	migrateKeyTime time.Time // Time when migration key sent
+	migrateKeyF    bool      // Migration key delivered to remote host
+
+	// Channel counted in server protection channels limits
+	counted bool
+
+	// Channel created by ConnectChannel sends cookie requests until first
+	// ACK received
+	handshakeF bool
+	cookieTime time.Time // Time when cookie request sent
 
 	// Channels current IDs
 	id         uint32 // Last send packet ID
 	expectedID uint32 // Expected incoming ID
 
+	// Channels unreliable sequenced messages IDs
+	sequencedID         uint32 // Next send unreliable packet ID
+	expectedSequencedID uint32 // Next expected sequenced packet ID
+	sequencedF          bool   // Sequenced packet received
+
 	// Channels packet queues
 	*sendQueue                // send queue
 	receiveQueue              // received queue
@@ -38,6 +59,19 @@ type ChannelData struct {
 	stat channelStat
 
 	connected bool // Channel is connected when it resive data or ack to data
+
+	// Path MTU discovery
+	pmtu pmtuDiscovery
+
+	// Forward error correction
+	fec fecData
+
+	// Graceful close
+	closing closeData
+
+	// Channel configuration
+	cfg      Config
+	pingTime time.Time // Last time ping sent
 }
 
 // reset exequte reset of this cannel
@@ -52,6 +86,10 @@ func (tcd *ChannelData) reset() {
 	tcd.id = firstPacketID
 	// Set tcd.expectedID = 1
 	tcd.expectedID = firstPacketID
+	// Clear FEC group and received packets
+	tcd.fecReset()
+	// Clear sequenced messages IDs
+	tcd.sequencedID, tcd.expectedSequencedID, tcd.sequencedF = 0, 0, false
 	// \TODO reset trudp channel statistic
 	// Send event "RESET was applied" to user level
 	tcd.trudp.sendEvent(tcd, EvResetLocal, nil)
@@ -81,11 +119,20 @@ func (tcd *ChannelData) destroy(msgLevel int, msg string) (err error) {
 	// \TODO clear/correct TRUDP statistics data
 
 	// Remove trudp channel from channels map
-	delete(tcd.trudp.tcdmap, tcd.key)
+	delete(tcd.worker.tcdmap, tcd.key)
+	tcd.removeRoute()
+	if tcd.counted {
+		tcd.trudp.protect.remove(tcd.addr)
+	}
 	teolog.Log(teolog.CONNECT, MODULE, "channel with key", tcd.key, "disconnected")
 	if tcd.connected {
-		tcd.trudp.sendEvent(tcd, EvDisconnected, []byte(tcd.key))
+		event := EvDisconnected
+		if tcd.closing.cleanF {
+			event = EvClosed
+		}
+		tcd.trudp.sendEvent(tcd, event, []byte(tcd.key))
 	}
+	tcd.closeDone()
 
 	return
 }
@@ -126,28 +173,28 @@ func (tcd *ChannelData) TripTime() float32 {
 	return tcd.stat.triptime
 }
 
-// Write send data to remote host
+// Write send data to remote host. It returns error if channel is closed or
+// closing (the channel state is checked by worker).
 func (tcd *ChannelData) Write(data []byte) (n int, err error) {
-	if tcd.stoppedF {
+	chanAnswer := make(chan bool)
+	tcd.worker.chanWrite <- &writeType{tcd: tcd, data: data, chanAnswer: chanAnswer}
+	if !<-chanAnswer {
 		err = errors.New("can't write to: the channel " + tcd.key + " already closed")
 		return
 	}
-	chanAnswer := make(chan bool)
-	tcd.trudp.proc.chanWrite <- &writeType{tcd, data, chanAnswer}
-	<-chanAnswer
 	n = len(data)
 	return
 }
 
 // WriteNowait send data to remote host in no wait mode and got result in callback
 func (tcd *ChannelData) WriteNowait(data []byte, cb func()) (n int, err error) {
-	if tcd.stoppedF {
+	if tcd.stoppedF || tcd.closingF() {
 		err = errors.New("can't write to: the channel " + tcd.key + " already closed")
 		return
 	}
 	go func() {
 		chanAnswer := make(chan bool)
-		tcd.trudp.proc.chanWrite <- &writeType{tcd, data, chanAnswer}
+		tcd.worker.chanWrite <- &writeType{tcd: tcd, data: data, chanAnswer: chanAnswer}
 		<-chanAnswer
 		cb()
 	}()
@@ -164,8 +211,10 @@ func (trudp *TRUDP) makeKey(addr net.Addr, ch int) string {
 	return addr.String() + ":" + strconv.Itoa(ch)
 }
 
-// newChannelData create new TRUDP ChannelData or select existing
-func (trudp *TRUDP) newChannelData(addr *net.UDPAddr, ch int, canCreate,
+// newChannelData create new TRUDP ChannelData or select existing. It should
+// be executed in worker which owns channel with this address and number (or
+// connection ID). The created channel uses connection ID if cid is not 0.
+func (trudp *TRUDP) newChannelData(addr net.Addr, ch int, cid uint64, canCreate,
 	sendEvConnected bool) (tcd *ChannelData, key string, ok bool) {
 
 	// Send event connected
@@ -179,7 +228,8 @@ func (trudp *TRUDP) newChannelData(addr *net.UDPAddr, ch int, canCreate,
 
 	// Channel data select
 	key = trudp.makeKey(addr, ch)
-	tcd, ok = trudp.tcdmap[key]
+	w := trudp.proc.channelWorker(key, cid)
+	tcd, ok = w.tcdmap[key]
 	if ok && !tcd.connected {
 		sendEventConnected()
 	}
@@ -193,52 +243,80 @@ func (trudp *TRUDP) newChannelData(addr *net.UDPAddr, ch int, canCreate,
 	// Channel data create
 	tcd = &ChannelData{
 		trudp:        trudp,
+		worker:       w,
 		addr:         addr,
 		ch:           ch,
 		key:          key,
+		cid:          cid,
 		id:           firstPacketID,
 		expectedID:   firstPacketID,
-		stat:         channelStat{trudp: trudp, timeStarted: now, lastTimeReceived: now, triptimeMiddle: maxRTT},
+		stat:         channelStat{trudp: trudp, total: &w.packets, timeStarted: now, lastTimeReceived: now, triptimeMiddle: trudp.cfg.maxRTTms(), maxRTT: trudp.cfg.maxRTTms()},
 		sendTestMsgF: false,
-		maxQueueSize: trudp.defaultQueueSize,
+		maxQueueSize: trudp.cfg.QueueSize,
+		cfg:          trudp.cfg,
 	}
 	tcd.sendQueue = sendQueueInit()
 	tcd.receiveQueue = receiveQueueInit()
+	tcd.pmtuInit()
 	tcd.writeQueue = make([]*writeType, 0)
 
 	// Add to channels map
-	trudp.tcdmap[key] = tcd
+	w.tcdmap[key] = tcd
+	tcd.addRoute()
 
 	sendEventConnected()
 
 	return
 }
 
-// ConnectChannel to remote host by UDP
-func (trudp *TRUDP) ConnectChannel(rhost string, rport int, ch int) (tcd *ChannelData) {
+// ConnectChannel to remote host by UDP. The options may contain Config to set
+// channel configuration.
+func (trudp *TRUDP) ConnectChannel(rhost string, rport int, ch int,
+	opts ...interface{}) (tcd *ChannelData) {
 	address := rhost + ":" + strconv.Itoa(rport)
 	rUDPAddr, err := trudp.udp.resolveAddr(network, address)
 	if err != nil {
 		panic(err)
 	}
-	teolog.Log(teolog.CONNECT, MODULE, "connecting to host", rUDPAddr, "at channel", ch)
-	done := make(chan bool)
-	// Create new trudp channel and wait while channel created in kernel level
-	go trudp.kernel(func() {
-		tcd, _, _ = trudp.newChannelData(rUDPAddr, ch, true, false)
-		done <- true
-	})
-	<-done
-	return
+	return trudp.ConnectChannelAddr(rUDPAddr, ch, opts...)
 }
 
-// Close close trudp channel
-func (tcd *ChannelData) Close() (err error) {
+// ConnectChannelAddr connect to remote host by transport address. The
+// options may contain Config to set channel configuration.
+func (trudp *TRUDP) ConnectChannelAddr(addr net.Addr, ch int,
+	opts ...interface{}) (tcd *ChannelData) {
+	teolog.Log(teolog.CONNECT, MODULE, "connecting to host", addr, "at channel", ch)
 	done := make(chan bool)
-	go tcd.trudp.kernel(func() {
-		tcd.destroy(teolog.DEBUGv,
-			fmt.Sprint("destroy channel ", tcd.GetKey(), ": closed by user"),
-		)
+	key := trudp.makeKey(addr, ch)
+	var cid uint64
+	if trudp.connectionIDF {
+		// Use existing channel (and its connection ID) if it already created,
+		// new connection ID generates for new channel only
+		var exists bool
+		w := trudp.proc.channelWorker(key, 0)
+		w.kernelWait(func() {
+			var c *ChannelData
+			if c, exists = w.tcdmap[key]; exists {
+				cid = c.cid
+			}
+		})
+		if !exists {
+			cid = newCID()
+		}
+	}
+	// Create new trudp channel and wait while channel created in worker
+	go trudp.proc.channelWorker(key, cid).kernel(func() {
+		tcd, _, _ = trudp.newChannelData(addr, ch, cid, true, false)
+		if cid != 0 && tcd.migrateKey == nil {
+			tcd.migrateKey = newMigrateKey()
+		}
+		tcd.handshakeF = !tcd.connected
+		for _, opt := range opts {
+			switch o := opt.(type) {
+			case Config:
+				tcd.setConfig(o)
+			}
+		}
 		done <- true
 	})
 	<-done
@@ -250,8 +328,17 @@ func (tcd *ChannelData) GetCh() int {
 	return tcd.ch
 }
 
-// GetAddr return trudp channel address
+// GetAddr return trudp channel UDP address. It returns empty address if the
+// channel works over not UDP transport, use GetNetAddr in this case
 func (tcd *ChannelData) GetAddr() *net.UDPAddr {
+	if addr, ok := tcd.addr.(*net.UDPAddr); ok {
+		return addr
+	}
+	return &net.UDPAddr{}
+}
+
+// GetNetAddr return trudp channel transport address
+func (tcd *ChannelData) GetNetAddr() net.Addr {
 	return tcd.addr
 }
 
@@ -275,23 +362,30 @@ func (tcd *ChannelData) canWrite() bool {
 	return tcd.sendQueue.q.Len() < tcd.maxQueueSize /*&& tcd.receiveQueue.Len() < tcd.maxQueueSize*/
 }
 
-// keepAlive Send ping if time since tcd.lastTripTimeReceived >= sleepTime
+// keepAlive Send ping if time since tcd.lastTripTimeReceived and since last
+// ping >= PingAfter
 func (tcd *ChannelData) keepAlive() {
 
 	// Send ping after sleep time
-	if time.Since(tcd.stat.lastTripTimeReceived) >= sleepTime {
+	if time.Since(tcd.stat.lastTripTimeReceived) >= tcd.cfg.PingAfter &&
+		time.Since(tcd.pingTime) >= tcd.cfg.PingAfter {
+		tcd.pingTime = time.Now()
 		tcd.trudp.packet.newPing(tcd.ch, []byte(echoMsg)).writeTo(tcd)
 		teolog.Log(teolog.DEBUGv, MODULE, "send ping to channel: ", tcd.key)
 	}
 
 	// Destroy channel after disconnect time
-	if time.Since(tcd.stat.lastTimeReceived) >= disconnectTime {
+	if time.Since(tcd.stat.lastTimeReceived) >= tcd.cfg.DisconnectAfter {
 		tcd.destroy(teolog.DEBUGv,
 			fmt.Sprint("destroy channel ", tcd.GetKey(),
 				": does not answer long time: ", time.Since(tcd.stat.lastTimeReceived),
 			),
 		)
 	}
+}
+
+// sendTestMsg send test message if sendTestMsgF is set
+func (tcd *ChannelData) sendTestMsg() {
 
 	// \TODO send test data - remove it
 	if tcd.sendTestMsgF {
@@ -10,13 +10,15 @@ import (
 
 // channelStat structure contain channel statistic variables
 type channelStat struct {
-	trudp                *TRUDP      // Pointer to TRUDP structure
-	packets              packetsStat // Packets statistic
-	timeStarted          time.Time   // Time when channel created
-	triptime             float32     // Channels triptime in Millisecond
-	triptimeMiddle       float32     // Channels midle triptime in Millisecond
-	lastTimeReceived     time.Time   // Time when last packet was received
-	lastTripTimeReceived time.Time   // Time when last packet with triptime was received
+	trudp                *TRUDP       // Pointer to TRUDP structure
+	total                *packetsStat // Pointer to total packets statistic
+	packets              packetsStat  // Packets statistic
+	timeStarted          time.Time    // Time when channel created
+	triptime             float32      // Channels triptime in Millisecond
+	triptimeMiddle       float32      // Channels midle triptime in Millisecond
+	maxRTT               float32      // Channels max midle triptime in Millisecond
+	lastTimeReceived     time.Time    // Time when last packet was received
+	lastTripTimeReceived time.Time    // Time when last packet with triptime was received
 }
 
 // RealTimeSpeed type to calculate real time speed
@@ -61,12 +63,12 @@ func (tcs *channelStat) setTriptime(triptime float32) {
 	// 	tcs.triptimeMiddle = tcs.triptime
 	// 	return
 	// }
-	if tcs.triptimeMiddle == maxRTT {
+	if tcs.triptimeMiddle == tcs.maxRTT {
 		tcs.triptimeMiddle = tcs.triptime
 	} else {
 		tcs.triptimeMiddle = (tcs.triptimeMiddle*10 + tcs.triptime) / 11
-		if tcs.triptimeMiddle > maxRTT {
-			tcs.triptimeMiddle = maxRTT
+		if tcs.triptimeMiddle > tcs.maxRTT {
+			tcs.triptimeMiddle = tcs.maxRTT
 		}
 	}
 	tcs.lastTripTimeReceived = time.Now()
@@ -79,40 +81,52 @@ func (tcs *channelStat) setLastTimeReceived() {
 
 // received adds data packets received to statistic
 func (tcs *channelStat) received(length int) {
-	tcs.packets.receive++                             // Channel data packets received
-	tcs.trudp.packets.receive++                       // Total data packets received
-	tcs.packets.receiveLength += uint64(length)       // Length of packet
-	tcs.trudp.packets.receiveLength += uint64(length) // Total length of packet
-	tcs.packets.receiveRT.Calculate(length)           // Calculate received real time speed
-	tcs.trudp.packets.receiveRT.Calculate(length)     // Calculate total received real time speed
+	tcs.packets.receive++                       // Channel data packets received
+	tcs.total.receive++                         // Total data packets received
+	tcs.packets.receiveLength += uint64(length) // Length of packet
+	tcs.total.receiveLength += uint64(length)   // Total length of packet
+	tcs.packets.receiveRT.Calculate(length)     // Calculate received real time speed
+	tcs.total.receiveRT.Calculate(length)       // Calculate total received real time speed
 }
 
 // ackReceived adds ack packets received to statistic
 func (tcs *channelStat) ackReceived() {
-	tcs.trudp.packets.ack++ // Total ack ackets received
-	tcs.packets.ack++       // Channel ack ackets received
+	tcs.total.ack++   // Total ack ackets received
+	tcs.packets.ack++ // Channel ack ackets received
 }
 
 // dropped adds 'packet received and dropped' to statistic
 func (tcs *channelStat) dropped() {
-	tcs.trudp.packets.dropped++ // Total received and dropped
-	tcs.packets.dropped++       // Channel received and dropped
+	tcs.total.dropped++   // Total received and dropped
+	tcs.packets.dropped++ // Channel received and dropped
+}
+
+// fecSent adds FEC packets send to statistic
+func (tcs *channelStat) fecSent() {
+	tcs.total.fec++   // Total FEC packets send
+	tcs.packets.fec++ // Channel FEC packets send
+}
+
+// recovered adds 'packet recovered by FEC' to statistic
+func (tcs *channelStat) recovered() {
+	tcs.total.recovered++   // Total packets recovered
+	tcs.packets.recovered++ // Channel packets recovered
 }
 
 // send adds data packets send to statistic
 func (tcs *channelStat) send(length int) {
-	tcs.packets.send++                             // Channel packets send
-	tcs.trudp.packets.send++                       // Total packets send
-	tcs.packets.sendLength += uint64(length)       // Length of packet
-	tcs.trudp.packets.sendLength += uint64(length) // Total length of packet
-	tcs.packets.sendRT.Calculate(length)           // Calculate send real time speed
-	tcs.trudp.packets.sendRT.Calculate(length)     // Calculate total send real time speed
+	tcs.packets.send++                       // Channel packets send
+	tcs.total.send++                         // Total packets send
+	tcs.packets.sendLength += uint64(length) // Length of packet
+	tcs.total.sendLength += uint64(length)   // Total length of packet
+	tcs.packets.sendRT.Calculate(length)     // Calculate send real time speed
+	tcs.total.sendRT.Calculate(length)       // Calculate total send real time speed
 }
 
 // repeat adds data packets repeat to statistic
 func (tcs *channelStat) repeat(r bool) {
 	if r {
-		tcs.trudp.packets.repeat++        // Total packets repeat
+		tcs.total.repeat++                // Total packets repeat
 		tcs.packets.repeat++              // Channel packets repeat
 		tcs.packets.repeatRT.Calculate(1) // Calculate repeat speed
 	} else {
@@ -152,27 +166,32 @@ func (tcs *channelStat) statFooter(length int) (str string) {
 				"%3d %-24.*s %8d  %8d %10.3f        -  /       -  %8d  %8d %10.3f %8d %8d(%d%%) %8d(%d%%)      -      -      - ",
 				length, // Number of channels
 				1, "-", // Empty
-				tcs.trudp.packets.send,                               // Total send packet
-				tcs.trudp.packets.sendRT.SpeedPacSec,                 // Total send packet/sec
-				float64(tcs.trudp.packets.sendLength)/(1024*1024),    // Total send in mb
-				tcs.trudp.packets.receive,                            // Total received packet
-				tcs.trudp.packets.receiveRT.SpeedPacSec,              // Total received packet/sec
-				float64(tcs.trudp.packets.receiveLength)/(1024*1024), // Total received in mb
-				tcs.trudp.packets.ack,                                // packets ack received
-				tcs.trudp.packets.repeat,                             // packets repeat
-				repeatP(&tcs.trudp.packets),                          // packets repeat in %
-				tcs.trudp.packets.dropped,                            // packets dropped
-				droppedP(&tcs.packets),                               // packets dropped in %
+				tcs.total.send,                               // Total send packet
+				tcs.total.sendRT.SpeedPacSec,                 // Total send packet/sec
+				float64(tcs.total.sendLength)/(1024*1024),    // Total send in mb
+				tcs.total.receive,                            // Total received packet
+				tcs.total.receiveRT.SpeedPacSec,              // Total received packet/sec
+				float64(tcs.total.receiveLength)/(1024*1024), // Total received in mb
+				tcs.total.ack,                                // packets ack received
+				tcs.total.repeat,                             // packets repeat
+				repeatP(tcs.total),                           // packets repeat in %
+				tcs.total.dropped,                            // packets dropped
+				droppedP(&tcs.packets),                       // packets dropped in %
 			)
 		} else {
 			str += strings.Repeat(" ", 166)
 		}
 
+		var lenReader, lenWrite int
+		for _, w := range tcs.trudp.proc.workers {
+			lenReader += len(w.chanReader)
+			lenWrite += len(w.chanWrite)
+		}
 		str += fmt.Sprintf("%6d %6d %6d/%-6d ",
-			len(tcs.trudp.proc.chanReader), // channel read udp Size
+			lenReader,                      // channel read udp Size
 			len(tcs.trudp.proc.chanWriter), // channel write udp Size
 			len(tcs.trudp.chanEvent),       // events channel size
-			len(tcs.trudp.proc.chanWrite),  // write from user channel size
+			lenWrite,                       // write from user channel size
 		)
 	}
 	str = line + str + fmt.Sprintf("\n"+
@@ -184,6 +203,24 @@ func (tcs *channelStat) statFooter(length int) (str string) {
 	return
 }
 
+// add adds packets statistic p to this packets statistic
+func (ps *packetsStat) add(p *packetsStat) {
+	ps.send += p.send
+	ps.sendLength += p.sendLength
+	ps.ack += p.ack
+	ps.receive += p.receive
+	ps.receiveLength += p.receiveLength
+	ps.dropped += p.dropped
+	ps.repeat += p.repeat
+	ps.fec += p.fec
+	ps.recovered += p.recovered
+	ps.sendRT.SpeedPacSec += p.sendRT.SpeedPacSec
+	ps.receiveRT.SpeedPacSec += p.receiveRT.SpeedPacSec
+	ps.repeatRT.SpeedPacSec += p.repeatRT.SpeedPacSec
+	ps.sendRT.speedMbSec += p.sendRT.speedMbSec
+	ps.receiveRT.speedMbSec += p.receiveRT.speedMbSec
+}
+
 // repeatP Return repeat packets in %
 func repeatP(packets *packetsStat) (retval uint32) {
 	retval = 0
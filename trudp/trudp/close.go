@@ -0,0 +1,149 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This module contain graceful channel close. The Close flushes channel send
+// and write queues, sends FIN packet and destroys channel when FIN_ACK
+// received. The remote host answers FIN_ACK and destroys its channel too.
+// Both hosts send EvClosed event instead of EvDisconnected. The Close does not
+// wait channel destroyed, the CloseWait waits it.
+
+package trudp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+// finResendTime is interval to resend FIN packet while FIN_ACK does not
+// received
+const finResendTime = defaultRTT * 10 * time.Millisecond
+
+// closeData is channel graceful close state
+type closeData struct {
+	started time.Time     // Time when Close called (zero if channel does not closing)
+	finSent time.Time     // Last time FIN packet sent
+	cleanF  bool          // Channel closed by FIN/FIN_ACK exchange
+	remoteF bool          // Channel closed by remote host FIN
+	done    chan struct{} // Closed when channel destroyed
+}
+
+// Close gracefully close trudp channel: flush send queue, notify remote host
+// and destroy channel when remote host answered or when remote host does not
+// answer during channel DisconnectAfter time. It does not wait channel
+// destroyed.
+func (tcd *ChannelData) Close() (err error) {
+	_, err = tcd.closeStart()
+	return
+}
+
+// CloseWait gracefully close trudp channel like Close and wait until channel
+// destroyed.
+func (tcd *ChannelData) CloseWait() (err error) {
+	done, err := tcd.closeStart()
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-tcd.worker.done:
+	}
+	return
+}
+
+// ClosedByRemote return true if channel was closed by remote host Close. It
+// should be used after EvClosed event received (the channel is destroyed and
+// its close state does not changed).
+func (tcd *ChannelData) ClosedByRemote() bool {
+	return tcd.closing.remoteF
+}
+
+// closeStart start channel graceful close and return channel which closed
+// when channel destroyed
+func (tcd *ChannelData) closeStart() (done chan struct{}, err error) {
+	tcd.worker.kernelWait(func() {
+		if tcd.stoppedF {
+			err = errors.New("can't close: the channel " + tcd.key + " already closed")
+			return
+		}
+		if tcd.closing.started.IsZero() {
+			teolog.Log(teolog.DEBUGv, MODULE, "close channel", tcd.key)
+			tcd.closing.started = time.Now()
+			tcd.closing.done = make(chan struct{})
+		}
+		done = tcd.closing.done
+		tcd.closeProcess()
+	})
+	return
+}
+
+// closingF return true if channel Close was called
+func (tcd *ChannelData) closingF() bool {
+	return !tcd.closing.started.IsZero()
+}
+
+// finSentF return true if FIN packet was sent, the channel does not send
+// data packets after it
+func (tcd *ChannelData) finSentF() bool {
+	return !tcd.closing.finSent.IsZero()
+}
+
+// closeProcess send FIN packet when send and write queues are empty and
+// resend it while FIN_ACK does not received. The channel is destroyed if
+// remote host does not answer during disconnect time.
+func (tcd *ChannelData) closeProcess() {
+	if !tcd.closingF() || tcd.stoppedF {
+		return
+	}
+	if time.Since(tcd.closing.started) >= tcd.cfg.DisconnectAfter {
+		tcd.destroy(teolog.DEBUGv, fmt.Sprint("destroy channel ", tcd.key,
+			": closed by user, remote host does not answer FIN"))
+		return
+	}
+	if tcd.sendQueue.q.Len() > 0 || len(tcd.writeQueue) > 0 ||
+		tcd.finSentF() && time.Since(tcd.closing.finSent) < finResendTime {
+		return
+	}
+	tcd.closing.finSent = time.Now()
+	tcd.trudp.packet.newPacket(FIN, 0, tcd.ch, tcd.trudp.Timestamp(),
+		nil).writeTo(tcd)
+}
+
+// closeDone close done channel of Close waiting channel destroyed
+func (tcd *ChannelData) closeDone() {
+	if tcd.closing.done != nil {
+		close(tcd.closing.done)
+	}
+}
+
+// finReceived process FIN packet: send FIN_ACK and destroy channel
+func (pac *packetType) finReceived(tcd *ChannelData) {
+	pac.newPacket(FINAck, pac.ID(), pac.Channel(), pac.Timestamp(),
+		nil).writeTo(tcd)
+	tcd.closing.cleanF, tcd.closing.remoteF = true, true
+	tcd.destroy(teolog.DEBUGv, fmt.Sprint("destroy channel ", tcd.key,
+		": closed by remote host"))
+}
+
+// finAckReceived process FIN_ACK packet: destroy closing channel
+func (pac *packetType) finAckReceived(tcd *ChannelData) {
+	if !tcd.finSentF() {
+		return
+	}
+	tcd.closing.cleanF = true
+	tcd.destroy(teolog.DEBUGv, fmt.Sprint("destroy channel ", tcd.key,
+		": closed by user"))
+}
+
+// finAckTo send FIN_ACK to FIN packet received from channel which does not
+// exists (FIN_ACK to previous FIN lost or channel already destroyed)
+func (pac *packetType) finAckTo(addr net.Addr) {
+	finAck := pac.newPacket(FINAck, pac.ID(), pac.Channel(), pac.Timestamp(),
+		nil)
+	finAck.setCID(pac.CID())
+	pac.trudp.proc.chanWriter <- writerType{finAck, addr}
+}
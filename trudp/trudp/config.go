@@ -0,0 +1,105 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This module contain TR-UDP configuration: timing and queues sizes of trudp
+// connection and its channels.
+
+package trudp
+
+import "time"
+
+// Config is the Init and ConnectChannel option which sets trudp timing and
+// queues sizes. Config used in Init sets default values of all channels, the
+// channel Config overrides it. Zero fields get default values. PingAfter and
+// DefaultRTT less than worker tick (30ms) are set to worker tick.
+type Config struct {
+	PingAfter        time.Duration // Send ping if nothing received during this time (default 1s)
+	DisconnectAfter  time.Duration // Destroy channel if nothing received during this time (default 3s)
+	MaxResendAttempt int           // Destroy channel after this number of one packet resends (default 50)
+	DefaultRTT       time.Duration // Retransmit time added to middle triptime (default 30ms)
+	MaxRTT           time.Duration // Max middle triptime used in retransmit time (default 500ms)
+	QueueSize        int           // Initial send queue size (default DefaultQueueSize)
+	MaxQueueSize     int           // Max send queue size when queue grows (default 2048)
+}
+
+// defaultConfig is the default trudp configuration
+var defaultConfig = Config{
+	PingAfter:        sleepTime,
+	DisconnectAfter:  disconnectTime,
+	MaxResendAttempt: maxResendAttempt,
+	DefaultRTT:       defaultRTT * time.Millisecond,
+	MaxRTT:           maxRTT * time.Millisecond,
+	QueueSize:        DefaultQueueSize,
+	MaxQueueSize:     maxQueueSize,
+}
+
+// merge return config with zero fields set from def config
+func (cfg Config) merge(def Config) Config {
+	if cfg.PingAfter <= 0 {
+		cfg.PingAfter = def.PingAfter
+	}
+	if cfg.PingAfter < workerTick {
+		cfg.PingAfter = workerTick
+	}
+	if cfg.DisconnectAfter <= 0 {
+		cfg.DisconnectAfter = def.DisconnectAfter
+	}
+	if cfg.MaxResendAttempt <= 0 {
+		cfg.MaxResendAttempt = def.MaxResendAttempt
+	}
+	if cfg.DefaultRTT <= 0 {
+		cfg.DefaultRTT = def.DefaultRTT
+	}
+	if cfg.DefaultRTT < workerTick {
+		cfg.DefaultRTT = workerTick
+	}
+	if cfg.MaxRTT <= 0 {
+		cfg.MaxRTT = def.MaxRTT
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = def.QueueSize
+	}
+	if cfg.MaxQueueSize <= 0 {
+		cfg.MaxQueueSize = def.MaxQueueSize
+	}
+	if cfg.MaxQueueSize < cfg.QueueSize {
+		cfg.MaxQueueSize = cfg.QueueSize
+	}
+	return cfg
+}
+
+// maxRTTms return max middle triptime in milliseconds
+func (cfg *Config) maxRTTms() float32 {
+	return float32(cfg.MaxRTT) / float32(time.Millisecond)
+}
+
+// Config return trudp default channels configuration
+func (trudp *TRUDP) Config() Config {
+	return trudp.cfg
+}
+
+// Config return trudp channel configuration
+func (tcd *ChannelData) Config() (cfg Config) {
+	tcd.worker.kernelWait(func() { cfg = tcd.cfg })
+	return
+}
+
+// SetConfig set trudp channel configuration, zero fields get values from
+// trudp default channels configuration
+func (tcd *ChannelData) SetConfig(cfg Config) {
+	tcd.worker.kernelWait(func() { tcd.setConfig(cfg) })
+}
+
+// setConfig set trudp channel configuration, it should be executed in worker
+// which owns this channel
+func (tcd *ChannelData) setConfig(cfg Config) {
+	tcd.cfg = cfg.merge(tcd.trudp.cfg)
+	if tcd.stat.triptimeMiddle == tcd.stat.maxRTT {
+		tcd.stat.triptimeMiddle = tcd.cfg.maxRTTms()
+	}
+	tcd.stat.maxRTT = tcd.cfg.maxRTTms()
+	if cfg.QueueSize > 0 {
+		tcd.maxQueueSize = tcd.cfg.QueueSize
+	}
+}
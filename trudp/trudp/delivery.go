@@ -0,0 +1,128 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This module contain channels messages delivery classes and priorities.
+
+package trudp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kirill-scherba/teonet-go/teokeys/teokeys"
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+// DeliveryClass is the WriteMessage option which sets message delivery class
+type DeliveryClass int
+
+// Messages delivery classes
+const (
+	ReliableOrdered     DeliveryClass = iota // Delivered once and in order (default)
+	ReliableUnordered                        // Delivered once when received, may be out of order
+	UnreliableSequenced                      // May be lost, messages older than delivered are dropped
+	Unreliable                               // May be lost, duplicated or reordered
+)
+
+// Priority is the WriteMessage option which sets message priority: reliable
+// messages with higher priority are sent before messages with lower priority
+// waiting in write queue
+type Priority int
+
+// Messages priorities
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0 // Default priority
+	PriorityHigh   Priority = 1
+)
+
+// sequencedWindow is max distance of stale sequenced message, the message
+// with more distance is delivered (remote host sequence was restarted)
+const sequencedWindow = 4096
+
+// WriteMessage send data to remote host with delivery class and priority. The
+// options may contain DeliveryClass and Priority. The Write is the
+// WriteMessage with ReliableOrdered class and normal priority.
+func (tcd *ChannelData) WriteMessage(data []byte, opts ...interface{}) (n int,
+	err error) {
+	writePac := &writeType{tcd: tcd, data: data, chanAnswer: make(chan bool)}
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case DeliveryClass:
+			writePac.class = o
+		case Priority:
+			writePac.priority = o
+		}
+	}
+	tcd.worker.chanWrite <- writePac
+	if !<-writePac.chanAnswer {
+		err = errors.New("can't write to: the channel " + tcd.key + " already closed")
+		return
+	}
+	n = len(data)
+	return
+}
+
+// packetType return data packet type of delivery class
+func (class DeliveryClass) packetType() int {
+	switch class {
+	case ReliableUnordered:
+		return DATAUnordered
+	case UnreliableSequenced:
+		return DATASequenced
+	case Unreliable:
+		return DATAUnreliable
+	default:
+		return DATA
+	}
+}
+
+// reliable return true if messages of delivery class are saved to send queue
+// and resent until delivered
+func (class DeliveryClass) reliable() bool {
+	return class == ReliableOrdered || class == ReliableUnordered
+}
+
+// isData return true if packet type is one of data packets types
+func isData(packetType int) bool {
+	switch packetType {
+	case DATA, DATAUnordered, DATASequenced, DATAUnreliable:
+		return true
+	}
+	return false
+}
+
+// writeUnreliable send unreliable message to channel (it does not wait in
+// write queue and does not saved to send queue)
+func (proc *process) writeUnreliable(writePac *writeType) {
+	tcd := writePac.tcd
+	id := tcd.incID(&tcd.sequencedID)
+	typ := writePac.class.packetType()
+	proc.trudp.packet.newPacket(typ, id, tcd.ch, proc.trudp.Timestamp(),
+		writePac.data).writeTo(tcd)
+	tcd.fecAdd(typ, id, writePac.data)
+	writePac.chanAnswer <- true
+}
+
+// unreliableReceived process received unreliable data packet: send data to
+// user level or drop stale sequenced packet
+func (pac *packetType) unreliableReceived(tcd *ChannelData) {
+	defer pac.fecReceived(tcd)
+	tcd.stat.received(len(pac.data))
+	if pac.Type() == DATASequenced {
+		id := pac.ID()
+		if d := pac.packetDistance(tcd.expectedSequencedID, id); tcd.sequencedF &&
+			d < 0 && d >= -sequencedWindow {
+			teolog.DebugV(MODULE, teokeys.Color(teokeys.ANSILightBlue,
+				fmt.Sprintf("skip received sequenced packet id: %d, channel: %s, "+
+					"stale", id, tcd.GetKey())))
+			tcd.stat.dropped()
+			return
+		}
+		tcd.sequencedF = true
+		tcd.expectedSequencedID = id
+		tcd.incID(&tcd.expectedSequencedID)
+	}
+	tcd.trudp.sendEvent(tcd, EvGotData, pac.Data())
+}
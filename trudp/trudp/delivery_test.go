@@ -0,0 +1,22 @@
+package trudp
+
+import "testing"
+
+// TestWriteQueuePriority check packets with higher priority placed to write
+// queue before packets with lower priority and packets with the same priority
+// keep order
+func TestWriteQueuePriority(t *testing.T) {
+	proc := &process{}
+	tcd := &ChannelData{}
+	for i, p := range []Priority{PriorityNormal, PriorityLow, PriorityHigh,
+		PriorityNormal, PriorityHigh} {
+		proc.writeToQueue(tcd, &writeType{data: []byte{byte(i)}, priority: p})
+	}
+	want := []byte{2, 4, 0, 3, 1}
+	for i, w := range tcd.writeQueue {
+		if w.data[0] != want[i] {
+			t.Fatalf("wrong write queue order, position %d: got %d, want %d",
+				i, w.data[0], want[i])
+		}
+	}
+}
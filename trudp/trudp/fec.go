@@ -0,0 +1,316 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This module contain channels forward error correction (FEC): the sender
+// adds XOR parity packet to each group of data packets and the receiver
+// recovers one lost packet of group without waiting for resend. Reliable
+// and unreliable data packets have separate ids, so they are grouped
+// separately.
+//
+// FEC packet data:
+//
+//	byte 0      number of data packets in group (group first packet id is
+//	            the FEC packet id), high bit is set for group of unreliable
+//	            packets
+//	bytes 1-2   XOR of group packets data lengths (little endian)
+//	byte 3      XOR of group packets types
+//	bytes 4-    XOR of group packets data (padded with zeros to max length)
+
+package trudp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/kirill-scherba/teonet-go/teokeys/teokeys"
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+const (
+	fecMaxGroup   = 64                   // (number) max data packets in FEC group
+	fecWindow     = 256                  // (number) received packets saved to recover lost packets
+	fecHeaderLen  = 4                    // FEC packet data header length
+	fecUnreliable = 0x80                 // FEC packet group of unreliable packets flag
+	fecMaxData    = 0xFFF - fecHeaderLen // max length of data protected by FEC (payload length is 12 bits)
+	fecCountMask  = fecUnreliable - 1    // FEC packet number of packets mask
+)
+
+// fecData is the channel forward error correction state
+type fecData struct {
+	group int32 // number of data packets in group (0 - FEC disabled, atomic)
+
+	// Sender groups of reliable and unreliable data packets
+	reliable, unreliable fecGroup
+
+	// Receivers of reliable and unreliable data packets (created when first
+	// FEC packet received)
+	rreliable, runreliable fecReceiver
+}
+
+// fecGroup is the sender FEC group
+type fecGroup struct {
+	first  uint32 // first packet id of current group
+	next   uint32 // next packet id expected in current group
+	count  int    // number of packets added to current group
+	length uint16 // XOR of current group packets data lengths
+	types  byte   // XOR of current group packets types
+	parity []byte // XOR of current group packets data
+}
+
+// fecReceiver is the receiver FEC state
+type fecReceiver struct {
+	received []fecReceived     // last received data packets (ring by id)
+	groups   map[uint32][]byte // received FEC packets data by first id
+	last     uint32            // last received packet id
+}
+
+// fecReceived is the received data packet saved to recover lost packets
+type fecReceived struct {
+	id   uint32
+	typ  byte
+	data []byte
+}
+
+// SetFEC enable channel forward error correction: one XOR parity packet is
+// sent after each group of groupSize data packets, so the receiver can
+// recover one lost packet of group without waiting for resend. The
+// redundancy is 1/groupSize. Zero groupSize disables FEC.
+func (tcd *ChannelData) SetFEC(groupSize int) error {
+	if groupSize < 0 || groupSize > fecMaxGroup {
+		return errors.New("wrong FEC group size: " + fmt.Sprint(groupSize))
+	}
+	tcd.worker.kernelWait(func() {
+		tcd.fecFlush()
+		atomic.StoreInt32(&tcd.fec.group, int32(groupSize))
+	})
+	return nil
+}
+
+// FECRecovered return number of lost data packets recovered by FEC
+func (tcd *ChannelData) FECRecovered() (n uint32) {
+	tcd.worker.kernelWait(func() { n = tcd.stat.packets.recovered })
+	return
+}
+
+// fecOverhead return length added to max data length by FEC packet header
+func (tcd *ChannelData) fecOverhead() int {
+	if atomic.LoadInt32(&tcd.fec.group) > 0 {
+		return fecHeaderLen
+	}
+	return 0
+}
+
+// fecAdd add sent data packet to current FEC group and send FEC packet when
+// group is full
+func (tcd *ChannelData) fecAdd(typ int, id uint32, data []byte) {
+	if tcd.fec.group == 0 {
+		return
+	}
+	f := &tcd.fec.reliable
+	if !packetReliable(typ) {
+		f = &tcd.fec.unreliable
+	}
+	if f.count > 0 && id != f.next {
+		tcd.fecFlushGroup(f)
+	}
+	// Too large packet can't be protected: its FEC packet exceeds max payload
+	if len(data) > fecMaxData {
+		return
+	}
+	if f.count == 0 {
+		f.first = id
+		f.parity = f.parity[:0]
+	}
+	f.next = id
+	tcd.incID(&f.next)
+	f.count++
+	f.length ^= uint16(len(data))
+	f.types ^= byte(typ)
+	f.parity = fecXor(f.parity, data)
+	if f.count >= int(tcd.fec.group) {
+		tcd.fecFlushGroup(f)
+	}
+}
+
+// fecFlush send FEC packets of current groups
+func (tcd *ChannelData) fecFlush() {
+	tcd.fecFlushGroup(&tcd.fec.reliable)
+	tcd.fecFlushGroup(&tcd.fec.unreliable)
+}
+
+// fecFlushGroup send FEC packet of group
+func (tcd *ChannelData) fecFlushGroup(f *fecGroup) {
+	if f.count == 0 {
+		return
+	}
+	data := make([]byte, fecHeaderLen+len(f.parity))
+	data[0] = byte(f.count)
+	if f == &tcd.fec.unreliable {
+		data[0] |= fecUnreliable
+	}
+	binary.LittleEndian.PutUint16(data[1:], f.length)
+	data[3] = f.types
+	copy(data[fecHeaderLen:], f.parity)
+	tcd.trudp.packet.newPacket(FEC, f.first, tcd.ch, tcd.trudp.Timestamp(),
+		data).writeTo(tcd)
+	tcd.stat.fecSent()
+	f.count, f.length, f.types = 0, 0, 0
+}
+
+// fecXor xor data to parity and return parity (padded to data length)
+func fecXor(parity, data []byte) []byte {
+	for len(parity) < len(data) {
+		parity = append(parity, 0)
+	}
+	for i, b := range data {
+		parity[i] ^= b
+	}
+	return parity
+}
+
+// fecReset clear FEC sender groups and receivers state
+func (tcd *ChannelData) fecReset() {
+	f := &tcd.fec
+	f.reliable.count, f.reliable.length, f.reliable.types = 0, 0, 0
+	f.unreliable.count, f.unreliable.length, f.unreliable.types = 0, 0, 0
+	f.rreliable, f.runreliable = fecReceiver{}, fecReceiver{}
+}
+
+// packetReliable return true if packet type is reliable data packet type
+func packetReliable(typ int) bool {
+	return typ == DATA || typ == DATAUnordered
+}
+
+// fecReceiver return FEC receiver of data packets with reliable flag
+func (tcd *ChannelData) fecReceiver(reliable bool) *fecReceiver {
+	if reliable {
+		return &tcd.fec.rreliable
+	}
+	return &tcd.fec.runreliable
+}
+
+// fecExpected return next expected packet id of FEC receiver: packets with
+// less id are processed and should not be recovered
+func (tcd *ChannelData) fecExpected(r *fecReceiver) uint32 {
+	if r == &tcd.fec.rreliable {
+		return tcd.expectedID
+	}
+	next := r.last
+	tcd.incID(&next)
+	return next
+}
+
+// fecReceived save received data packet and try recover lost packet of its
+// group
+func (pac *packetType) fecReceived(tcd *ChannelData) {
+	r := tcd.fecReceiver(packetReliable(pac.Type()))
+	if r.received == nil {
+		return
+	}
+	id := pac.ID()
+	r.received[id%fecWindow] = fecReceived{id, byte(pac.Type()),
+		append([]byte(nil), pac.Data()...)}
+	if pac.packetDistance(r.last, id) > 0 {
+		r.last = id
+	}
+	for first, data := range r.groups {
+		if n := uint32(data[0] & fecCountMask); id-first < n {
+			pac.fecRecover(tcd, r, first)
+		}
+	}
+}
+
+// fecReceivedParity save received FEC packet and try recover lost packet of
+// its group
+func (pac *packetType) fecReceivedParity(tcd *ChannelData) {
+	data := pac.Data()
+	if len(data) < fecHeaderLen || data[0]&fecCountMask == 0 ||
+		data[0]&fecCountMask > fecMaxGroup {
+		return
+	}
+	r := tcd.fecReceiver(data[0]&fecUnreliable == 0)
+	if r.received == nil {
+		r.received = make([]fecReceived, fecWindow)
+		r.groups = make(map[uint32][]byte)
+	}
+
+	// Remove old groups
+	expected := tcd.fecExpected(r)
+	for first := range r.groups {
+		if pac.packetDistance(expected, first) < -fecWindow {
+			delete(r.groups, first)
+		}
+	}
+
+	first := pac.ID()
+	if pac.packetDistance(expected, first) < -fecWindow {
+		return
+	}
+	r.groups[first] = append([]byte(nil), data...)
+	pac.fecRecover(tcd, r, first)
+}
+
+// fecRecover recover lost packet of group if only one packet of group lost
+func (pac *packetType) fecRecover(tcd *ChannelData, r *fecReceiver,
+	first uint32) {
+	data := r.groups[first]
+	n := int(data[0] & fecCountMask)
+
+	// Find lost packet
+	lost, numLost := first, 0
+	for i, id := 0, first; i < n; i, id = i+1, id+1 {
+		if id == 0 && first != 0 {
+			id++ // packet ids skip zero when wrapped
+		}
+		if rec := r.received[id%fecWindow]; rec.data == nil || rec.id != id {
+			lost = id
+			numLost++
+		}
+	}
+	switch {
+	case numLost > 1:
+		return
+	case numLost == 0 ||
+		r == &tcd.fec.rreliable && pac.packetDistance(tcd.expectedID, lost) < 0:
+		delete(r.groups, first)
+		return
+	}
+	delete(r.groups, first)
+
+	// Recover lost packet data and type
+	length := binary.LittleEndian.Uint16(data[1:])
+	typ := data[3]
+	parity := append([]byte(nil), data[fecHeaderLen:]...)
+	for i, id := 0, first; i < n; i, id = i+1, id+1 {
+		if id == 0 && first != 0 {
+			id++
+		}
+		if id != lost {
+			rec := r.received[id%fecWindow]
+			length ^= uint16(len(rec.data))
+			typ ^= rec.typ
+			parity = fecXor(parity, rec.data)
+		}
+	}
+	if int(length) > len(parity) || !isData(int(typ)) ||
+		packetReliable(int(typ)) != (r == &tcd.fec.rreliable) {
+		return
+	}
+	teolog.DebugV(MODULE, teokeys.Color(teokeys.ANSIGreen,
+		fmt.Sprintf("recovered packet id: %d, channel: %s", lost, tcd.GetKey())))
+
+	// Process recovered packet as received data packet
+	rec := &packetType{trudp: tcd.trudp,
+		data: make([]byte, HeaderLength+int(length))}
+	copy(rec.data[payloadOffset:], parity[:length])
+	rec.setHeader(int(typ), lost, tcd.ch, int(length), pac.Timestamp())
+	tcd.stat.recovered()
+	if r == &tcd.fec.rreliable {
+		rec.dataReceived(tcd)
+		return
+	}
+	rec.unreliableReceived(tcd)
+}
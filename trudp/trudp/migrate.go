@@ -0,0 +1,240 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This module contain channels connection IDs and address migration. The
+// channel with connection ID keeps working when remote host address changed
+// (NAT rebinding or network changed): the packet with channel connection ID
+// received from new address migrates the channel after the new address
+// answers to PING challenge.
+//
+// The connection ID is sent in clear text, so the challenge answer should
+// contain HMAC of challenge calculated with channel migration key. The host
+// which creates connection ID sends random migration key to remote host in
+// PING packet after channel connected (the key PING is resent until ACK
+// received). Channel without migration key does not migrate.
+
+package trudp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+const (
+	migrateMsg     = "migr\x00"      // migration challenge message prefix
+	migrateKeyMsg  = "mkey\x00"      // migration key message prefix
+	migrateTimeout = 1 * time.Second // challenge and key resent after timeout
+	challengeLen   = 8               // (bytes) random challenge length
+	migrateKeyLen  = 16              // (bytes) migration key length
+	migrateMACLen  = 16              // (bytes) challenge answer HMAC length
+	migrateMsgLen  = len(migrateMsg) + challengeLen
+)
+
+// ConnectionID is the Init option which enables connection IDs in channels
+// created by ConnectChannel. Channels created by remote hosts use connection
+// ID if remote host sent it.
+type ConnectionID bool
+
+// migration is the channel address migration state
+type migration struct {
+	addr      net.Addr  // new address waiting challenge answer
+	challenge []byte    // challenge sent to new address
+	time      time.Time // time when challenge sent
+}
+
+// newCID return new random connection ID
+func newCID() (cid uint64) {
+	b := make([]byte, cidLength)
+	for cid == 0 {
+		rand.Read(b)
+		cid = binary.LittleEndian.Uint64(b)
+	}
+	return
+}
+
+// newMigrateKey return new random migration key
+func newMigrateKey() []byte {
+	key := make([]byte, migrateKeyLen)
+	rand.Read(key)
+	return key
+}
+
+// cidKey return connection ID string used to select channel worker
+func cidKey(cid uint64) string {
+	return "cid:" + strconv.FormatUint(cid, 16)
+}
+
+// channelWorker return worker which owns channel with key or connection ID.
+// Channels with connection ID are sharded by connection ID, so its worker
+// does not changed when channel migrated to new address.
+func (proc *process) channelWorker(key string, cid uint64) *worker {
+	if cid != 0 {
+		return proc.worker(cidKey(cid))
+	}
+	if shard, ok := proc.routes.Load(key); ok {
+		return proc.worker(shard.(string))
+	}
+	return proc.worker(key)
+}
+
+// addRoute save channel with connection ID to worker connection IDs map and
+// route its key to worker
+func (tcd *ChannelData) addRoute() {
+	if tcd.cid == 0 {
+		return
+	}
+	tcd.worker.cids[tcd.cid] = tcd
+	tcd.trudp.proc.routes.Store(tcd.key, cidKey(tcd.cid))
+}
+
+// removeRoute remove channel with connection ID from worker connection IDs
+// map and remove its key route
+func (tcd *ChannelData) removeRoute() {
+	if tcd.cid == 0 {
+		return
+	}
+	if tcd.worker.cids[tcd.cid] == tcd {
+		delete(tcd.worker.cids, tcd.cid)
+	}
+	tcd.trudp.proc.routes.Delete(tcd.key)
+}
+
+// GetCID return channel connection ID or 0 if channel does not use it
+func (tcd *ChannelData) GetCID() uint64 {
+	return tcd.cid
+}
+
+// Overhead return length added to data by TR-UDP packet header, connection
+// ID and FEC packet header
+func (tcd *ChannelData) Overhead() int {
+	if tcd.cid != 0 {
+		return HeaderLength + cidLength + tcd.fecOverhead()
+	}
+	return HeaderLength + tcd.fecOverhead()
+}
+
+// migrate process packet with connection ID received from new address of
+// channel: send challenge to new address and migrate channel when challenge
+// answer received. Return true if packet processed (it should be dropped).
+func (pac *packetType) migrate(addr net.Addr) bool {
+	cid := pac.CID()
+	if cid == 0 {
+		return false
+	}
+	trudp := pac.trudp
+	ch := pac.Channel()
+	key := trudp.makeKey(addr, ch)
+	w := trudp.proc.channelWorker(key, cid)
+	if _, ok := w.tcdmap[key]; ok {
+		return false
+	}
+	tcd, ok := w.cids[cid]
+	if !ok || tcd.ch != ch {
+		return false
+	}
+	if tcd.migrateKey == nil {
+		teolog.Log(teolog.DEBUGv, MODULE, "channel", tcd.key,
+			"got packet from new address", addr, ", migration key unknown")
+		return true
+	}
+	m := &tcd.migration
+	sameAddr := m.addr != nil && m.addr.String() == addr.String()
+	switch {
+	case sameAddr && pac.Type() == ACKPing &&
+		hmac.Equal(pac.Data(), tcd.migrateAnswer(m.challenge)):
+		tcd.migrated(addr, key)
+	case !sameAddr || time.Since(m.time) > migrateTimeout:
+		tcd.migrateChallenge(addr)
+	}
+	return true
+}
+
+// migrateChallenge send PING with random challenge to new address
+func (tcd *ChannelData) migrateChallenge(addr net.Addr) {
+	teolog.Log(teolog.DEBUGv, MODULE, "channel", tcd.key,
+		"got packet from new address", addr, ", send challenge")
+	challenge := make([]byte, migrateMsgLen)
+	copy(challenge, migrateMsg)
+	rand.Read(challenge[len(migrateMsg):])
+	tcd.migration = migration{addr: addr, challenge: challenge, time: time.Now()}
+	pac := tcd.trudp.packet.newPing(tcd.ch, challenge)
+	pac.setCID(tcd.cid)
+	tcd.trudp.proc.chanWriter <- writerType{pac, addr}
+}
+
+// migrateAnswer return challenge answer: challenge message prefix and HMAC
+// of challenge and connection ID calculated with migration key
+func (tcd *ChannelData) migrateAnswer(challenge []byte) []byte {
+	mac := hmac.New(sha256.New, tcd.migrateKey)
+	mac.Write(challenge)
+	binary.Write(mac, binary.LittleEndian, tcd.cid)
+	return append([]byte(migrateMsg), mac.Sum(nil)[:migrateMACLen]...)
+}
+
+// migratePing process migration key or challenge received in PING packet and
+// return ACK_PING data: the migration key is saved if channel does not have
+// key yet, the challenge is answered with HMAC. Other PING data returned
+// unchanged.
+func (tcd *ChannelData) migratePing(data []byte) []byte {
+	switch {
+	case tcd.cid == 0:
+	case len(data) == len(migrateKeyMsg)+migrateKeyLen &&
+		bytes.HasPrefix(data, []byte(migrateKeyMsg)):
+		if tcd.migrateKey == nil {
+			tcd.migrateKey = append([]byte(nil), data[len(migrateKeyMsg):]...)
+		}
+		return data[:len(migrateKeyMsg)]
+	case len(data) == migrateMsgLen && bytes.HasPrefix(data, []byte(migrateMsg)):
+		if tcd.migrateKey != nil {
+			return tcd.migrateAnswer(data)
+		}
+	}
+	return data
+}
+
+// migrateKeyProcess send migration key to remote host until ACK_PING to key
+// received, it called by worker timer
+func (tcd *ChannelData) migrateKeyProcess() {
+	if tcd.cid == 0 || tcd.migrateKey == nil || tcd.migrateKeyF ||
+		!tcd.connected || time.Since(tcd.migrateKeyTime) < migrateTimeout {
+		return
+	}
+	tcd.migrateKeyTime = time.Now()
+	tcd.trudp.packet.newPing(tcd.ch,
+		append([]byte(migrateKeyMsg), tcd.migrateKey...)).writeTo(tcd)
+}
+
+// migrateAck process ACK_PING data: set migration key delivered flag when
+// ACK to migration key received
+func (tcd *ChannelData) migrateAck(data []byte) {
+	if string(data) == migrateKeyMsg {
+		tcd.migrateKeyF = true
+	}
+}
+
+// migrated change channel address and key and send EvMigrated event with
+// previous channel key
+func (tcd *ChannelData) migrated(addr net.Addr, key string) {
+	oldKey := tcd.key
+	tcd.removeRoute()
+	delete(tcd.worker.tcdmap, oldKey)
+	if tcd.counted {
+		tcd.trudp.protect.move(tcd.addr, addr)
+	}
+	tcd.addr, tcd.key = addr, key
+	tcd.worker.tcdmap[key] = tcd
+	tcd.addRoute()
+	tcd.migration = migration{}
+	tcd.pmtuInit()
+	teolog.Log(teolog.CONNECT, MODULE, "channel", oldKey, "migrated to", key)
+	tcd.trudp.sendEvent(tcd, EvMigrated, []byte(oldKey))
+}
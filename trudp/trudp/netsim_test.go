@@ -0,0 +1,709 @@
+package trudp
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/trudp/netsim"
+)
+
+var _ PacketTransport = (*netsim.Conn)(nil)
+
+// netsimInit start trudp connection on virtual network host
+func netsimInit(t *testing.T, n *netsim.Network, host string,
+	opts ...interface{}) (tru *TRUDP) {
+	conn, err := n.Listen(host + ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int
+	tru = Init(&port, append([]interface{}{conn}, opts...)...)
+	go tru.Run()
+	t.Cleanup(tru.Close)
+	return
+}
+
+// netsimConnect connect channel to remote host and wait while first packet
+// delivered and acknowledged. The TR-UDP channel is reset when first packet is
+// netsimRecovered return number of packets recovered by FEC in all trudp
+// channels
+func netsimRecovered(tru *TRUDP) (recovered uint32) {
+	var tcds []*ChannelData
+	for _, w := range tru.proc.workers {
+		w.kernelWait(func() {
+			for _, tcd := range w.tcdmap {
+				tcds = append(tcds, tcd)
+			}
+		})
+	}
+	for _, tcd := range tcds {
+		recovered += tcd.FECRecovered()
+	}
+	return
+}
+
+// lost or duplicated, so tests impair the link after channels connected.
+func netsimConnect(t *testing.T, tru, to *TRUDP, ch int) (tcd *ChannelData) {
+	addr := to.udp.conn.LocalAddr().(*net.UDPAddr)
+	tcd = tru.ConnectChannel(addr.IP.String(), addr.Port, ch)
+	if _, err := tcd.Write([]byte("Start")); err != nil {
+		t.Fatal(err)
+	}
+	after := time.After(5 * time.Second)
+	for received := false; !received || tcd.Stats().SendQueue > 0; {
+		select {
+		case ev := <-to.ChanEvent():
+			if ev.Event == EvGotData && string(ev.Data) == "Start" {
+				received = true
+			}
+		case <-after:
+			t.Fatal("timeout, channel does not connected")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return
+}
+
+// netsimSend send numMessages messages to tcd
+func netsimSend(tcd *ChannelData, from, numMessages int) {
+	for i := from; i < from+numMessages; i++ {
+		if _, err := tcd.Write([]byte("Hello-" + strconv.Itoa(i) + "!")); err != nil {
+			return
+		}
+	}
+}
+
+// netsimReceive wait numMessages messages in order and return last event
+// received before timeout
+func netsimReceive(t *testing.T, tru *TRUDP, from, numMessages int,
+	timeout time.Duration) {
+	idx := from
+	after := time.After(timeout)
+	for idx < from+numMessages {
+		select {
+		case ev := <-tru.ChanEvent():
+			if ev.Event != EvGotData {
+				continue
+			}
+			if data := string(ev.Data); data != "Hello-"+strconv.Itoa(idx)+"!" {
+				t.Fatalf("received wrong packet: %s, expected id: %d", data, idx)
+			}
+			idx++
+		case <-after:
+			t.Fatalf("timeout, received %d messages from %d", idx-from, numMessages)
+		}
+	}
+}
+
+// waitEvent wait selected event and return it
+func waitEvent(t *testing.T, tru *TRUDP, event int,
+	timeout time.Duration) *EventData {
+	after := time.After(timeout)
+	for {
+		select {
+		case ev := <-tru.ChanEvent():
+			if ev.Event == event {
+				return ev
+			}
+		case <-after:
+			t.Fatalf("timeout, event %d does not received", event)
+		}
+	}
+}
+
+// TestNetsim execute TRUDP over virtual network with adverse conditions
+func TestNetsim(t *testing.T) {
+
+	t.Run("in order delivery over bad link", func(t *testing.T) {
+		const numMessages = 2000
+		n := netsim.New(1)
+		tru1 := netsimInit(t, n, "10.0.0.1")
+		tru2 := netsimInit(t, n, "10.0.0.2")
+		tcd := netsimConnect(t, tru1, tru2, 0)
+		n.SetLink(netsim.Link{
+			Latency:   5 * time.Millisecond,
+			Jitter:    5 * time.Millisecond,
+			Loss:      0.05,
+			Reorder:   0.05,
+			Duplicate: 0.05,
+		})
+
+		go netsimSend(tcd, 0, numMessages)
+		netsimReceive(t, tru2, 0, numMessages, 30*time.Second)
+
+		s := n.Stats()
+		if s.Lost == 0 || s.Reordered == 0 || s.Duplicated == 0 {
+			t.Errorf("network does not impair packets: %+v", s)
+		}
+	})
+
+	t.Run("delivery over limited bandwidth", func(t *testing.T) {
+		const numMessages = 500
+		n := netsim.New(2)
+		n.SetLink(netsim.Link{
+			Latency:   2 * time.Millisecond,
+			Bandwidth: 256 * 1024,
+			QueueSize: 8 * 1024,
+		})
+		tru1 := netsimInit(t, n, "10.0.0.1")
+		tru2 := netsimInit(t, n, "10.0.0.2")
+		_, port := tru2.GetAddr()
+
+		go netsimSend(tru1.ConnectChannel("10.0.0.2", port, 0), 0, numMessages)
+		netsimReceive(t, tru2, 0, numMessages, 30*time.Second)
+	})
+
+	t.Run("channels sharded between workers", func(t *testing.T) {
+		const numChannels = 16
+		const numMessages = 200
+		n := netsim.New(4)
+		tru1 := netsimInit(t, n, "10.0.0.1", Workers(4))
+		tru2 := netsimInit(t, n, "10.0.0.2", Workers(4))
+		tcds := make([]*ChannelData, numChannels)
+		for ch := range tcds {
+			tcds[ch] = netsimConnect(t, tru1, tru2, ch)
+		}
+		n.SetLink(netsim.Link{Latency: time.Millisecond, Loss: 0.02})
+
+		for _, tcd := range tcds {
+			go netsimSend(tcd, 0, numMessages)
+		}
+
+		// Messages of each channel received in order
+		next := make(map[int]int)
+		after := time.After(30 * time.Second)
+		for received := 0; received < numChannels*numMessages; {
+			select {
+			case ev := <-tru2.ChanEvent():
+				if ev.Event != EvGotData {
+					continue
+				}
+				ch := ev.Tcd.GetCh()
+				if data := string(ev.Data); data != "Hello-"+strconv.Itoa(next[ch])+"!" {
+					t.Fatalf("channel %d received wrong packet: %s, expected id: %d",
+						ch, data, next[ch])
+				}
+				next[ch]++
+				received++
+			case <-after:
+				t.Fatalf("timeout, received %d messages from %d", received,
+					numChannels*numMessages)
+			}
+		}
+	})
+
+	t.Run("path mtu discovery", func(t *testing.T) {
+		const mtu = 1400
+		n := netsim.New(5)
+		n.SetLink(netsim.Link{Latency: time.Millisecond, MTU: mtu})
+		tru1 := netsimInit(t, n, "10.0.0.1", MTUDiscovery(true))
+		tru2 := netsimInit(t, n, "10.0.0.2", MTUDiscovery(true))
+		_, port := tru2.GetAddr()
+
+		tcd := tru1.ConnectChannel("10.0.0.2", port, 0)
+		go netsimSend(tcd, 0, 1)
+		netsimReceive(t, tru2, 0, 1, 5*time.Second)
+
+		// Path MTU probed with accuracy
+		for start := time.Now(); tcd.MTU() <= mtu-pmtuAccuracy; {
+			if time.Since(start) > 10*time.Second {
+				t.Fatalf("path mtu does not probed: %d, expected: %d", tcd.MTU(), mtu)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if tcd.MTU() > mtu {
+			t.Errorf("wrong path mtu: %d, expected: %d", tcd.MTU(), mtu)
+		}
+		if n.Stats().Oversized == 0 {
+			t.Error("large probes does not dropped")
+		}
+
+		// Packet of path MTU length delivered
+		if _, err := tcd.Write(make([]byte, tcd.MTU()-HeaderLength)); err != nil {
+			t.Fatal(err)
+		}
+		waitEvent(t, tru2, EvGotData, 5*time.Second)
+	})
+
+	t.Run("lost packets recovered by fec", func(t *testing.T) {
+		const numMessages = 1000
+		n := netsim.New(6)
+		n.SetLink(netsim.Link{Latency: 5 * time.Millisecond, Loss: 0.03})
+		tru1 := netsimInit(t, n, "10.0.0.1")
+		tru2 := netsimInit(t, n, "10.0.0.2")
+		_, port := tru2.GetAddr()
+
+		tcd := tru1.ConnectChannel("10.0.0.2", port, 0)
+		if err := tcd.SetFEC(fecMaxGroup + 1); err == nil {
+			t.Error("wrong FEC group size accepted")
+		}
+		if err := tcd.SetFEC(4); err != nil {
+			t.Fatal(err)
+		}
+		go netsimSend(tcd, 0, numMessages)
+		netsimReceive(t, tru2, 0, numMessages, 30*time.Second)
+
+		recovered := netsimRecovered(tru2)
+		if recovered == 0 {
+			t.Error("lost packets does not recovered by FEC")
+		}
+	})
+
+	t.Run("lost unreliable packets recovered by fec", func(t *testing.T) {
+		const numMessages = 1000
+		n := netsim.New(6)
+		tru1 := netsimInit(t, n, "10.0.0.1")
+		tru2 := netsimInit(t, n, "10.0.0.2")
+		tcd := netsimConnect(t, tru1, tru2, 0)
+		if err := tcd.SetFEC(4); err != nil {
+			t.Fatal(err)
+		}
+		if tcd.Overhead() != HeaderLength+fecHeaderLen {
+			t.Errorf("wrong overhead with FEC: %d", tcd.Overhead())
+		}
+		n.SetLink(netsim.Link{Latency: 5 * time.Millisecond, Loss: 0.03})
+		go func() {
+			for i := 0; i < numMessages; i++ {
+				tcd.WriteMessage([]byte{byte(i >> 8), byte(i)}, Unreliable,
+					PriorityNormal)
+				time.Sleep(time.Millisecond)
+			}
+		}()
+
+		// Recovered packets delivered as unreliable messages once, some
+		// messages may be lost when group lost more than one packet
+		received := make(map[int]bool)
+	loop:
+		for len(received) < numMessages {
+			select {
+			case ev := <-tru2.ChanEvent():
+				if ev.Event != EvGotData {
+					continue
+				}
+				i := int(ev.Data[0])<<8 | int(ev.Data[1])
+				if received[i] {
+					t.Fatalf("unreliable message %d received twice", i)
+				}
+				received[i] = true
+			case <-time.After(time.Second):
+				break loop
+			}
+		}
+		recovered := netsimRecovered(tru2)
+		if recovered == 0 {
+			t.Errorf("lost unreliable packets does not recovered by FEC, "+
+				"received: %d", len(received))
+		}
+	})
+
+	t.Run("delivery classes", func(t *testing.T) {
+		const numMessages = 300
+		n := netsim.New(7)
+		tru1 := netsimInit(t, n, "10.0.0.1")
+		tru2 := netsimInit(t, n, "10.0.0.2")
+		tcd := netsimConnect(t, tru1, tru2, 0)
+		n.SetLink(netsim.Link{
+			Latency: 2 * time.Millisecond,
+			Jitter:  2 * time.Millisecond,
+			Loss:    0.05,
+			Reorder: 0.05,
+		})
+		go func() {
+			for i := 0; i < numMessages; i++ {
+				for _, class := range []DeliveryClass{ReliableUnordered,
+					UnreliableSequenced, Unreliable} {
+					tcd.WriteMessage([]byte{byte(class), byte(i >> 8), byte(i)},
+						class, PriorityHigh)
+				}
+			}
+		}()
+
+		// Reliable unordered messages received once, sequenced messages
+		// received in order
+		unordered := make(map[int]bool)
+		lastSequenced, numUnreliable := -1, 0
+		after := time.After(30 * time.Second)
+		for len(unordered) < numMessages {
+			select {
+			case ev := <-tru2.ChanEvent():
+				if ev.Event != EvGotData {
+					continue
+				}
+				class, i := DeliveryClass(ev.Data[0]), int(ev.Data[1])<<8|int(ev.Data[2])
+				switch class {
+				case ReliableUnordered:
+					if unordered[i] {
+						t.Fatalf("unordered message %d received twice", i)
+					}
+					unordered[i] = true
+				case UnreliableSequenced:
+					if i <= lastSequenced {
+						t.Fatalf("stale sequenced message %d received after %d",
+							i, lastSequenced)
+					}
+					lastSequenced = i
+				case Unreliable:
+					numUnreliable++
+				}
+			case <-after:
+				t.Fatalf("timeout, received %d unordered messages from %d",
+					len(unordered), numMessages)
+			}
+		}
+		if lastSequenced < 0 || numUnreliable == 0 {
+			t.Errorf("unreliable messages does not received, sequenced: %d, "+
+				"unreliable: %d", lastSequenced, numUnreliable)
+		}
+	})
+
+	t.Run("address migration", func(t *testing.T) {
+		const numMessages = 100
+		n := netsim.New(8)
+		n.SetLink(netsim.Link{Latency: time.Millisecond, Loss: 0.02})
+		conn, err := n.Listen("10.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var port int
+		tru1 := Init(&port, conn, ConnectionID(true))
+		go tru1.Run()
+		t.Cleanup(tru1.Close)
+		tru2 := netsimInit(t, n, "10.0.0.2")
+		_, port = tru2.GetAddr()
+
+		tcd := tru1.ConnectChannel("10.0.0.2", port, 0)
+		if tcd.GetCID() == 0 {
+			t.Fatal("channel does not use connection ID")
+		}
+		if c := tru1.ConnectChannel("10.0.0.2", port, 0); c != tcd {
+			t.Fatal("connect to existing channel created new channel")
+		}
+		go netsimSend(tcd, 0, numMessages)
+		netsimReceive(t, tru2, 0, numMessages, 10*time.Second)
+
+		// Wait migration key delivered to server
+		for delivered, start := false, time.Now(); !delivered; {
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("migration key does not delivered")
+			}
+			time.Sleep(10 * time.Millisecond)
+			tcd.worker.kernelWait(func() { delivered = tcd.migrateKeyF })
+		}
+
+		// Spoofed packet with connection ID does not migrate channel when
+		// challenge answer does not contain migration key HMAC
+		spoof, err := n.Listen("10.0.0.4:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer spoof.Close()
+		received := make(chan []byte, 8)
+		go func() {
+			for {
+				buf := make([]byte, 2048)
+				l, _, err := spoof.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				received <- buf[:l]
+			}
+		}()
+		spoofSend := func(typ int, data []byte) {
+			pac := tru1.packet.newPacket(typ, 0, 0, tru1.Timestamp(), data)
+			pac.setCID(tcd.GetCID())
+			spoof.WriteTo(pac.data, &net.UDPAddr{IP: net.ParseIP("10.0.0.2"),
+				Port: port})
+		}
+		var challenge []byte
+		for i := 0; challenge == nil; i++ {
+			if i == 10 {
+				t.Fatal("migration challenge does not received")
+			}
+			spoofSend(PING, nil)
+			select {
+			case data := <-received:
+				challenge = (&packetType{data: data}).Data()
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+		if !bytes.HasPrefix(challenge, []byte(migrateMsg)) {
+			t.Fatalf("wrong migration challenge: %v", challenge)
+		}
+		for i := 0; i < 3; i++ {
+			spoofSend(ACKPing, challenge)
+		}
+		for after := time.After(300 * time.Millisecond); challenge != nil; {
+			select {
+			case ev := <-tru2.ChanEvent():
+				if ev.Event == EvMigrated {
+					t.Fatal("channel migrated by spoofed challenge answer")
+				}
+			case <-after:
+				challenge = nil
+			}
+		}
+
+		// Client address changed, the server channel migrated and keeps
+		// messages order
+		if err := conn.Rebind("10.0.0.3:0"); err != nil {
+			t.Fatal(err)
+		}
+		go netsimSend(tcd, numMessages, numMessages)
+		after := time.After(10 * time.Second)
+		migrated := false
+		for idx := numMessages; idx < 2*numMessages; {
+			select {
+			case ev := <-tru2.ChanEvent():
+				switch ev.Event {
+				case EvMigrated:
+					migrated = true
+					if ev.Tcd.GetCID() != tcd.GetCID() ||
+						ev.Tcd.GetAddr().String() != conn.LocalAddr().String() {
+						t.Fatalf("wrong migrated channel: %s", ev.Tcd.GetKey())
+					}
+				case EvGotData:
+					if !migrated {
+						t.Fatal("data received before channel migrated")
+					}
+					if data := string(ev.Data); data != "Hello-"+strconv.Itoa(idx)+"!" {
+						t.Fatalf("received wrong packet: %s, expected id: %d", data, idx)
+					}
+					idx++
+				case EvConnected:
+					t.Fatal("new channel created instead of migration")
+				}
+			case <-after:
+				t.Fatal("timeout, messages does not received after migration")
+			}
+		}
+	})
+
+	t.Run("handshake cookie and channels limits", func(t *testing.T) {
+		const numMessages = 50
+		n := netsim.New(9)
+		n.SetLink(netsim.Link{Latency: time.Millisecond})
+		tru1 := netsimInit(t, n, "10.0.0.1")
+		tru2 := netsimInit(t, n, "10.0.0.2",
+			Protection{Cookie: true, MaxChannelsPerIP: 2})
+		_, port := tru2.GetAddr()
+
+		// Spoofed data packets does not create channels
+		spoof, err := n.Listen("10.0.0.9:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		answers := make(chan []byte, 16)
+		go func() {
+			for {
+				buf := make([]byte, 2048)
+				l, _, err := spoof.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				answers <- buf[:l]
+			}
+		}()
+		pac := tru1.packet.newData(firstPacketID, 0, []byte("spoof"))
+		for i := 0; i < 10; i++ {
+			spoof.WriteTo(pac.data, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: port})
+		}
+		pac.release()
+
+		// Short packets does not answered, answer to padded packet is not
+		// longer than the packet
+		select {
+		case data := <-answers:
+			t.Fatalf("short packet answered with %d bytes", len(data))
+		case <-time.After(100 * time.Millisecond):
+		}
+		pac = tru1.packet.newData(firstPacketID, 0, make([]byte, cookieLength))
+		spoof.WriteTo(pac.data, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: port})
+		select {
+		case data := <-answers:
+			if len(data) > len(pac.data) {
+				t.Errorf("cookie answer amplified: %d bytes to %d bytes packet",
+					len(data), len(pac.data))
+			}
+		case <-time.After(time.Second):
+			t.Error("padded packet does not answered")
+		}
+		pac.release()
+
+		// Channels created after handshake, the channel over limit rejected
+		for ch := 0; ch < 3; ch++ {
+			go netsimSend(tru1.ConnectChannel("10.0.0.2", port, ch), 0, numMessages)
+		}
+		received := make(map[int]int)
+		after := time.After(5 * time.Second)
+		for len(received) < 2 || received[0]+received[1]+received[2] < 2*numMessages {
+			select {
+			case ev := <-tru2.ChanEvent():
+				if ev.Event == EvGotData {
+					received[ev.Tcd.GetCh()]++
+				}
+			case <-after:
+				t.Fatalf("timeout, received: %v", received)
+			}
+		}
+		var channels int
+		for _, w := range tru2.proc.workers {
+			w.kernelWait(func() { channels += len(w.tcdmap) })
+		}
+		if len(received) != 2 || channels != 2 {
+			t.Errorf("wrong channels number: %d, received: %v", channels, received)
+		}
+		if tru2.Rejected() == 0 {
+			t.Error("rejected attempts does not counted")
+		}
+	})
+
+	t.Run("graceful close", func(t *testing.T) {
+		const numMessages = 200
+		n := netsim.New(10)
+		n.SetLink(netsim.Link{Latency: 5 * time.Millisecond, Loss: 0.1})
+		tru1 := netsimInit(t, n, "10.0.0.1")
+		tru2 := netsimInit(t, n, "10.0.0.2")
+		_, port := tru2.GetAddr()
+
+		// Close flushes send queue and both hosts got closed event before
+		// disconnect time
+		tcd := tru1.ConnectChannel("10.0.0.2", port, 0)
+		netsimSend(tcd, 0, numMessages)
+		start := time.Now()
+		if err := tcd.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tcd.Write([]byte("after close")); err == nil {
+			t.Error("write to closed channel does not return error")
+		}
+		netsimReceive(t, tru2, 0, numMessages, time.Second)
+		if ev := waitEvent(t, tru2, EvClosed, time.Second); !ev.Tcd.ClosedByRemote() {
+			t.Error("remote close does not detected")
+		}
+		if ev := waitEvent(t, tru1, EvClosed, time.Second); ev.Tcd.ClosedByRemote() {
+			t.Error("local close detected as remote")
+		}
+		if since := time.Since(start); since >= disconnectTime {
+			t.Errorf("channel closed by timeout: %v", since)
+		}
+		if err := tcd.Close(); err == nil {
+			t.Error("repeated close does not return error")
+		}
+
+		// CloseWait returns when channel destroyed
+		tcd = tru1.ConnectChannel("10.0.0.2", port, 1)
+		netsimSend(tcd, 0, numMessages)
+		if err := tcd.CloseWait(); err != nil {
+			t.Fatal(err)
+		}
+		if err := tcd.Close(); err == nil {
+			t.Error("channel does not destroyed after CloseWait")
+		}
+	})
+
+	t.Run("statistic snapshots", func(t *testing.T) {
+		const numMessages = 100
+		n := netsim.New(11)
+		n.SetLink(netsim.Link{Latency: time.Millisecond})
+		tru1 := netsimInit(t, n, "10.0.0.1")
+		tru2 := netsimInit(t, n, "10.0.0.2")
+		_, port := tru2.GetAddr()
+
+		chanStats := make(chan *Stats, 1)
+		tru1.SetStatsCallback(50*time.Millisecond, func(s *Stats) {
+			select {
+			case chanStats <- s:
+			default:
+			}
+		})
+		tcd := tru1.ConnectChannel("10.0.0.2", port, 0)
+		netsimSend(tcd, 0, numMessages)
+		netsimReceive(t, tru2, 0, numMessages, 5*time.Second)
+
+		if s := tcd.Stats(); s.Key != tcd.GetKey() || s.Send != numMessages {
+			t.Errorf("wrong channel statistic: %+v", s)
+		}
+		s := tru2.Stats()
+		if len(s.Channels) != 1 || s.Receive != numMessages ||
+			s.Channels[0].ReceiveBytes != s.ReceiveBytes {
+			t.Errorf("wrong statistic: %+v", s)
+		}
+		select {
+		case s := <-chanStats:
+			if len(s.Channels) != 1 {
+				t.Errorf("wrong callback statistic: %+v", s)
+			}
+		case <-time.After(time.Second):
+			t.Error("statistic callback does not called")
+		}
+		tru1.SetStatsCallback(0, nil)
+	})
+
+	t.Run("channel configuration", func(t *testing.T) {
+		const numMessages = 50
+		n := netsim.New(12)
+		n.SetLink(netsim.Link{Latency: time.Millisecond})
+		cfg := Config{PingAfter: 50 * time.Millisecond,
+			DisconnectAfter: 200 * time.Millisecond}
+		tru1 := netsimInit(t, n, "10.0.0.1", cfg)
+		tru2 := netsimInit(t, n, "10.0.0.2", cfg)
+		_, port := tru2.GetAddr()
+
+		// Channel config overrides trudp config, zero fields got from trudp
+		// config
+		tcd := tru1.ConnectChannel("10.0.0.2", port, 0, Config{QueueSize: 8})
+		if c := tcd.Config(); c.QueueSize != 8 ||
+			c.DisconnectAfter != cfg.DisconnectAfter ||
+			c.MaxResendAttempt != maxResendAttempt {
+			t.Errorf("wrong channel config: %+v", c)
+		}
+
+		// Timing less than worker tick set to worker tick
+		c := Config{DefaultRTT: time.Millisecond, PingAfter: time.Millisecond}
+		if c = c.merge(cfg); c.DefaultRTT != workerTick ||
+			c.PingAfter != workerTick {
+			t.Errorf("wrong timing config: %+v", c)
+		}
+		go netsimSend(tcd, 0, numMessages)
+		netsimReceive(t, tru2, 0, numMessages, 5*time.Second)
+
+		// Channels disconnected after configured disconnect time
+		n.Partition("10.0.0.1", "10.0.0.2")
+		start := time.Now()
+		waitEvent(t, tru1, EvDisconnected, time.Second)
+		waitEvent(t, tru2, EvDisconnected, time.Second)
+		if since := time.Since(start); since >= disconnectTime/2 {
+			t.Errorf("channels disconnected after: %v", since)
+		}
+	})
+
+	t.Run("reconnect after partition", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("skipping in short mode")
+		}
+		const numMessages = 100
+		n := netsim.New(3)
+		n.SetLink(netsim.Link{Latency: time.Millisecond})
+		tru1 := netsimInit(t, n, "10.0.0.1")
+		tru2 := netsimInit(t, n, "10.0.0.2")
+		_, port := tru2.GetAddr()
+
+		tcd := tru1.ConnectChannel("10.0.0.2", port, 0)
+		go netsimSend(tcd, 0, numMessages)
+		netsimReceive(t, tru2, 0, numMessages, 10*time.Second)
+
+		// Channels disconnected when network partitioned
+		n.Partition("10.0.0.1", "10.0.0.2")
+		waitEvent(t, tru1, EvDisconnected, 2*disconnectTime)
+		waitEvent(t, tru2, EvDisconnected, 2*disconnectTime)
+		n.HealAll()
+
+		// New channel created to the same address
+		tcd = tru1.ConnectChannel("10.0.0.2", port, 0)
+		go netsimSend(tcd, 0, numMessages)
+		netsimReceive(t, tru2, 0, numMessages, 10*time.Second)
+	})
+}
@@ -1,154 +1,237 @@
 package trudp
 
-// #include <stdlib.h>
-// #include "packet.h"
-import "C"
 import (
-	"unsafe"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/kirill-scherba/teonet-go/teolog/teolog"
 )
 
-// \TODO rename to trudpPacket
+// TR-UDP packet header (all multibyte fields are little endian):
+//
+//	byte 0      checksum: sum of header bytes 1..11
+//	byte 1      protocol version (low 4 bits) and message type (high 4 bits)
+//	bytes 2-3   channel number (low 4 bits) and payload length (high 12 bits)
+//	bytes 4-7   packet id
+//	bytes 8-11  timestamp: sending time in microseconds
+//
+// Packets of channels with connection ID have protocol version 3 and the
+// 8 bytes connection ID after payload, the checksum includes it.
+const (
+	HeaderLength       = 12           // TR-UDP packet header length
+	protocolVersion    = 2            // TR-UDP protocol version
+	protocolVersionCID = 3            // TR-UDP protocol version of packets with connection ID
+	cidLength          = 8            // Connection ID length
+	maxChannel         = 1<<4 - 1     // Max channel number
+	payloadOffset      = HeaderLength // Payload offset in packet
+)
+
+// packetPool is the pool of packets with buffers used to send data
+var packetPool = sync.Pool{New: func() interface{} {
+	return &packetType{data: make([]byte, 0, maxBufferSize), pooled: true}
+}}
+
+// packetType is the TR-UDP packet.
+//
+// Packets created to send (newData, newAck, newPing ...) are got from
+// packets pool and encoded once. Each holder of created packet owns one
+// packet reference: the creator owns first reference, writeTo passes it to
+// udp writer or to send queue (the writer gets additional reference for data
+// packets). The holder calls release when it does not need the packet any
+// more, and the packet returns to pool when last reference released. Packet
+// data can't be used after release. Received packets are not pooled.
 type packetType struct {
 	trudp      *TRUDP
 	data       []byte
-	sendQueueF bool // true - save to send queue (Data packet); false - don't save to send queue (Service packet)
-	destoryF   bool // true - created in C and need to destroy; false - not need to destroy
-}
-
-// goBytesUnsafe makes a Go byte slice from a C array (without copying the
-// original data)
-func goBytesUnsafe(data unsafe.Pointer, length C.size_t) []byte {
-	return (*[1 << 28]byte)(data)[:length:length]
+	sendQueueF bool  // true - save to send queue (Reliable data packet); false - don't save to send queue (Service or unreliable packet)
+	pooled     bool  // true - packet got from packets pool
+	refs       int32 // number of packet references (atomic)
 }
 
 // Timestamp return current 32 bit timestamp in thousands of milliseconds
 func (trudp *TRUDP) Timestamp() uint32 {
-	return uint32(C.trudpGetTimestamp())
+	return uint32(time.Now().UnixNano() / int64(time.Microsecond))
+}
+
+// newPacket get packet from pool and encode packet header and payload
+func (pac *packetType) newPacket(typ int, id uint32, channel int,
+	timestamp uint32, data []byte) (p *packetType) {
+	length := HeaderLength + len(data)
+	p = packetPool.Get().(*packetType)
+	if cap(p.data) < length+cidLength {
+		p.data = make([]byte, 0, length+cidLength)
+	}
+	p.data = p.data[:length]
+	p.trudp = pac.trudp
+	p.sendQueueF = typ == DATA || typ == DATAUnordered
+	p.refs = 1
+	copy(p.data[payloadOffset:], data)
+	p.setHeader(typ, id, channel, len(data), timestamp)
+	return
+}
+
+// setHeader encode packet header
+func (pac *packetType) setHeader(typ int, id uint32, channel,
+	payloadLength int, timestamp uint32) {
+	b := pac.data
+	b[1] = byte(protocolVersion | typ<<4)
+	binary.LittleEndian.PutUint16(b[2:], uint16(channel&maxChannel|payloadLength<<4))
+	binary.LittleEndian.PutUint32(b[4:], id)
+	binary.LittleEndian.PutUint32(b[8:], timestamp)
+	b[0] = checksum(b)
+}
+
+// checksum calculate packet header and connection ID checksum
+func checksum(packet []byte) (chk byte) {
+	for _, b := range packet[1:HeaderLength] {
+		chk += b
+	}
+	if packet[1]&0x0F == protocolVersionCID {
+		for _, b := range packet[len(packet)-cidLength:] {
+			chk += b
+		}
+	}
+	return
+}
+
+// setCID add connection ID to packet
+func (pac *packetType) setCID(cid uint64) {
+	if cid == 0 || pac.CID() != 0 {
+		return
+	}
+	pac.data = pac.data[:len(pac.data)+cidLength]
+	binary.LittleEndian.PutUint64(pac.data[len(pac.data)-cidLength:], cid)
+	pac.data[1] = pac.data[1]&0xF0 | protocolVersionCID
+	pac.data[0] = checksum(pac.data)
 }
 
 // updateTimestamp update packets timestamp and return the same pointer to
 // packetType
 func (pac *packetType) updateTimestamp() *packetType {
-	packetPtr := unsafe.Pointer(&pac.data[0])
-	C.trudpPacketUpdateTimestamp(packetPtr)
+	binary.LittleEndian.PutUint32(pac.data[8:], pac.trudp.Timestamp())
+	pac.data[0] = checksum(pac.data)
 	return pac
 }
 
-// newData creates DATA package, it should be free with freeCreated
+// newData creates DATA package, it should be released with release
 func (pac *packetType) newData(id uint32, channel int, data []byte) *packetType {
-	var dataLen, length C.size_t
-	dataPtr := C.NULL
-	if data != nil {
-		dataPtr = unsafe.Pointer(&data[0])
-		dataLen = C.size_t(len(data))
-	}
-	packet := C.trudpPacketDATAcreateNew(C.uint32_t(id), C.uint(channel),
-		dataPtr, dataLen, &length)
-	return &packetType{trudp: pac.trudp, data: goBytesUnsafe(packet, length),
-		sendQueueF: true, destoryF: true}
+	return pac.newPacket(DATA, id, channel, pac.trudp.Timestamp(), data)
 }
 
-// newAck Create ACK to data package, it should be free with freeCreated
+// newAck Create ACK to data package, it should be released with release
 func (pac *packetType) newAck() *packetType {
-	packetPtr := unsafe.Pointer(&pac.data[0])
-	packet := C.trudpPacketACKcreateNew(packetPtr)
-	length := C.trudpPacketGetHeaderLength(packetPtr)
-	return &packetType{trudp: pac.trudp, data: goBytesUnsafe(packet, length),
-		destoryF: true}
+	return pac.newPacket(ACK, pac.ID(), pac.Channel(), pac.Timestamp(), nil)
 }
 
-// newPing Create PING package, it should be free with freeCreated
+// newPing Create PING package, it should be released with release
 func (pac *packetType) newPing(channel int, data []byte) *packetType {
-	var length C.size_t
-	packet := C.trudpPacketPINGcreateNew(0, C.uint(channel),
-		unsafe.Pointer(&data[0]), C.size_t(len(data)), &length)
-	return &packetType{trudp: pac.trudp, data: goBytesUnsafe(packet, length),
-		destoryF: true}
+	return pac.newPacket(PING, 0, channel, pac.trudp.Timestamp(), data)
 }
 
-// newAckToPing Create ACK to ping package, it should be free with
-// freeCreated
-func (pac *packetType) newAckToPing() *packetType {
-	packetPtr := unsafe.Pointer(&pac.data[0])
-	headerLength := C.trudpPacketGetHeaderLength(packetPtr)
-	packet := C.trudpPacketACKtoPINGcreateNew(packetPtr)
-	length := C.size_t(int(headerLength) + len(pac.Data()))
-	return &packetType{trudp: pac.trudp, data: goBytesUnsafe(packet, length),
-		destoryF: true}
+// newAckToPing Create ACK to ping package with data, it should be released
+// with release
+func (pac *packetType) newAckToPing(data []byte) *packetType {
+	return pac.newPacket(ACKPing, pac.ID(), pac.Channel(), pac.Timestamp(),
+		data)
 }
 
-// newReset Create RSET package, it should be free with freeCreated
+// newReset Create RSET package, it should be released with release
 func (pac *packetType) newReset() *packetType {
-	packet := C.trudpPacketRESETcreateNew(0, C.uint(pac.Channel()))
-	length := C.trudpPacketGetHeaderLength(nil)
-	return &packetType{trudp: pac.trudp, data: goBytesUnsafe(packet, length),
-		destoryF: true}
+	return pac.newPacket(RESET, 0, pac.Channel(), pac.trudp.Timestamp(), nil)
 }
 
-// newAckToReset Create ACK to reset package, it should be free with
-// freeCreated
+// newAckToReset Create ACK to reset package, it should be released with
+// release
 func (pac *packetType) newAckToReset() *packetType {
-	packetPtr := unsafe.Pointer(&pac.data[0])
-	packet := C.trudpPacketACKtoRESETcreateNew(packetPtr)
-	length := C.trudpPacketGetHeaderLength(packetPtr)
-	return &packetType{trudp: pac.trudp, data: goBytesUnsafe(packet, length),
-		destoryF: true}
+	return pac.newPacket(ACKReset, pac.ID(), pac.Channel(), pac.Timestamp(), nil)
 }
 
-// freeCreated frees packet created with functions dataCreateNew, pingCreateNew
-// ackCreateNew or resetCreateNew
-func (pac *packetType) freeCreated(packet []byte) {
-	C.trudpPacketCreatedFree(unsafe.Pointer(&packet[0]))
+// retain adds packet reference
+func (pac *packetType) retain() *packetType {
+	if pac.pooled {
+		atomic.AddInt32(&pac.refs, 1)
+	}
+	return pac
 }
 
-// destroy packet
-func (pac *packetType) destroy() {
-	if pac.destoryF {
-		pac.freeCreated(pac.data)
+// release releases packet reference and returns packet to pool when last
+// reference released
+func (pac *packetType) release() {
+	if !pac.pooled || atomic.AddInt32(&pac.refs, -1) > 0 {
+		return
 	}
+	pac.trudp = nil
+	pac.data = pac.data[:0]
+	packetPool.Put(pac)
+}
+
+// inFlight return true if packet waits in udp writer channel
+func (pac *packetType) inFlight() bool {
+	return pac.pooled && atomic.LoadInt32(&pac.refs) > 1
 }
 
 // writeTo send packetData to trudp channel. Depend on type of created packet:
 // Data or Service. Send Data packet to trudp channel and save it to sendQueue
 // or Send Service packet to trudp channel and destroy it
 func (pac *packetType) writeTo(tcd *ChannelData) {
-	pac.trudp.proc.chanWriter <- &writerType{pac, tcd.addr}
 	teolog.DebugVf(MODULE, "send %s packet id: %d, to channel: %s\n",
 		pac.TypeString(), pac.ID(), tcd.GetKey())
-	if pac.sendQueueF {
-		tcd.sendQueue.Add(pac, tcd.sendQueueRttTime())
-		tcd.stat.send(len(pac.data))
-		//tcd.trudp.sendEvent(tcd, SEND_DATA, pac.getData())
+	pac.setCID(tcd.cid)
+	if !pac.sendQueueF {
+		pac.trudp.proc.chanWriter <- writerType{pac, tcd.addr}
+		return
 	}
+	pac.trudp.proc.chanWriter <- writerType{pac.retain(), tcd.addr}
+	tcd.sendQueue.Add(pac, tcd.sendQueueRttTime())
+	tcd.stat.send(len(pac.data))
+	//tcd.trudp.sendEvent(tcd, SEND_DATA, pac.getData())
 }
 
 // Check TR-UDP packet and return true if packet valid
 func (pac *packetType) check(packet []byte) bool {
-	return int(C.trudpPacketCheck(unsafe.Pointer(&packet[0]),
-		C.size_t(len(packet)))) != 0
+	if len(packet) < HeaderLength {
+		return false
+	}
+	length := len(packet) - HeaderLength
+	if packet[1]&0x0F == protocolVersionCID {
+		length -= cidLength
+	}
+	return length >= 0 &&
+		length == int(binary.LittleEndian.Uint16(packet[2:])>>4) &&
+		packet[0] == checksum(packet)
+}
+
+// CID return packet connection ID or 0 if packet has not connection ID
+func (pac *packetType) CID() uint64 {
+	if pac.data[1]&0x0F != protocolVersionCID {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(pac.data[len(pac.data)-cidLength:])
 }
 
 // Channel return trudp packet channel number
 func (pac *packetType) Channel() int {
-	return int(C._trudpPacketGetChannel(unsafe.Pointer(&pac.data[0])))
+	return int(binary.LittleEndian.Uint16(pac.data[2:]) & maxChannel)
 }
 
 // ID reurn packet id
 func (pac *packetType) ID() uint32 {
-	return uint32(C.trudpPacketGetId(unsafe.Pointer(&pac.data[0])))
+	return binary.LittleEndian.Uint32(pac.data[4:])
 }
 
 // Type return packet type
 func (pac *packetType) Type() int {
-	return int(C.trudpPacketGetType(unsafe.Pointer(&pac.data[0])))
+	return int(pac.data[1] >> 4)
 }
 
 // TypeString return packet type in string format
-// DATA(0x0), ACK(0x1), RESET(0x2), ACK_RESET(0x3), PING(0x4), ACK_PING(0x5)
+// DATA(0x0), ACK(0x1), RESET(0x2), ACK_RESET(0x3), PING(0x4), ACK_PING(0x5),
+// FEC(0x6), DATA_UNORDERED(0x7), DATA_SEQUENCED(0x8), DATA_UNRELIABLE(0x9),
+// COOKIE(0xA), COOKIE_ECHO(0xB)
 func (pac *packetType) TypeString() string {
-	switch int(C.trudpPacketGetType(unsafe.Pointer(&pac.data[0]))) {
+	switch pac.Type() {
 	case 0:
 		return "DATA"
 	case 1:
@@ -161,6 +244,22 @@ func (pac *packetType) TypeString() string {
 		return "PING"
 	case 5:
 		return "ACK_PING"
+	case 6:
+		return "FEC"
+	case 7:
+		return "DATA_UNORDERED"
+	case 8:
+		return "DATA_SEQUENCED"
+	case 9:
+		return "DATA_UNRELIABLE"
+	case 10:
+		return "COOKIE"
+	case 11:
+		return "COOKIE_ECHO"
+	case FIN:
+		return "FIN"
+	case FINAck:
+		return "FIN_ACK"
 	default:
 		return "UNKNOWN"
 	}
@@ -168,13 +267,14 @@ func (pac *packetType) TypeString() string {
 
 // data return trudp packet data
 func (pac *packetType) Data() []byte {
-	return pac.data[int(C.trudpPacketGetHeaderLength(unsafe.Pointer(&pac.data[0]))):]
+	return pac.data[payloadOffset : payloadOffset+
+		int(binary.LittleEndian.Uint16(pac.data[2:])>>4)]
 }
 
 // Timestamp return Timestamp (32 byte) contains sending time of DATA and
 // RESET messages
 func (pac *packetType) Timestamp() uint32 {
-	return uint32(C.trudpPacketGetTimestamp(unsafe.Pointer(&pac.data[0])))
+	return binary.LittleEndian.Uint32(pac.data[8:])
 }
 
 // Triptime return packets triptime
@@ -10,21 +10,51 @@ import (
 
 // Packet type
 const (
-	DATA     = iota //(0x0)
-	ACK             //(0x1)
-	RESET           //(0x2)
-	ACKReset        //(0x3)
-	PING            //(0x4)
-	ACKPing         //(0x5)
+	DATA           = iota //(0x0)
+	ACK                   //(0x1)
+	RESET                 //(0x2)
+	ACKReset              //(0x3)
+	PING                  //(0x4)
+	ACKPing               //(0x5)
+	FEC                   //(0x6)
+	DATAUnordered         //(0x7)
+	DATASequenced         //(0x8)
+	DATAUnreliable        //(0x9)
+	COOKIE                //(0xA)
+	COOKIEEcho            //(0xB)
+	FIN                   //(0xC)
+	FINAck                //(0xD)
 )
 
 // process received packet
-func (pac *packetType) process(addr *net.UDPAddr) (processed bool) {
+func (pac *packetType) process(addr net.Addr) (processed bool) {
 	processed = false
 
+	// Process packet received from new address of channel with connection ID
+	if pac.migrate(addr) {
+		return
+	}
+
+	// Check channel can be created (server protection)
+	admitted, counted := pac.admit(addr)
+	if !admitted {
+		return
+	}
+
 	ch := pac.Channel()
-	tcd, key, ok := pac.trudp.newChannelData(addr, ch, pac.Type() == DATA, true)
+	tcd, key, ok := pac.trudp.newChannelData(addr, ch, pac.CID(),
+		isData(pac.Type()) || pac.Type() == COOKIEEcho, true)
+	if counted {
+		if !ok {
+			pac.trudp.protect.remove(addr)
+			return
+		}
+		tcd.counted = true
+	}
 	if !ok {
+		if pac.Type() == FIN {
+			pac.finAckTo(addr)
+		}
 		return
 	}
 
@@ -34,7 +64,7 @@ func (pac *packetType) process(addr *net.UDPAddr) (processed bool) {
 	switch packetType {
 
 	// DATA packet received
-	case DATA:
+	case DATA, DATAUnordered:
 
 		// \TODO: drop this packet if EQ len >= MaxValue
 		// if len(pac.trudp.chanEvent) > 16 {
@@ -47,12 +77,8 @@ func (pac *packetType) process(addr *net.UDPAddr) (processed bool) {
 			pac.ID(), key, tcd.expectedID, len(pac.data),
 		)
 
-		// Create ACK packet and send it back to sender
-		pac.newAck().writeTo(tcd)
-		tcd.stat.received(len(pac.data))
-
-		// Process received queue
-		pac.packetDataProcess(tcd)
+		// Send ACK and process received data packet
+		pac.dataReceived(tcd)
 
 	// ACK-to-data packet received
 	case ACK:
@@ -68,6 +94,7 @@ func (pac *packetType) process(addr *net.UDPAddr) (processed bool) {
 		// Set trip time to ChannelData
 		tcd.stat.setTriptime(pac.Triptime())
 		tcd.stat.ackReceived()
+		tcd.handshakeF = false
 
 		// Remove packet from send queue
 		tcd.sendQueue.Remove(id)
@@ -93,8 +120,15 @@ func (pac *packetType) process(addr *net.UDPAddr) (processed bool) {
 		teolog.DebugVf(MODULE, "got PING packet id: %d, channel: %s, data: %s\n",
 			pac.ID(), key, string(pac.Data()),
 		)
-		// Create ACK to ping packet and send it back to sender
-		pac.newAckToPing().writeTo(tcd)
+		// Create ACK to ping packet and send it back to sender (answer to path
+		// MTU probe without padding)
+		data := pac.Data()
+		if pmtuProbeSize(data) > 0 {
+			data = data[:pmtuProbeHeader]
+		}
+		// Save migration key or answer to migration challenge
+		data = tcd.migratePing(data)
+		pac.newAckToPing(data).writeTo(tcd)
 
 	// ACK-to-PING packet received
 	case ACKPing:
@@ -109,11 +143,64 @@ func (pac *packetType) process(addr *net.UDPAddr) (processed bool) {
 		triptime := pac.Triptime()
 		tcd.stat.setTriptime(triptime)
 
+		// Path MTU probe confirmed
+		if size := pmtuProbeSize(pac.Data()); size > 0 {
+			tcd.pmtuAck(size)
+		}
+
+		// Migration key delivered
+		tcd.migrateAck(pac.Data())
+
 		// Send event to user level
 		if tcd.trudp.allowEvents > 0 { // \TODO use GOT_ACK_PING to check allow this event
 			tcd.trudp.sendEvent(tcd, EvGotAckPing, nil) // []byte(fmt.Sprintf("%.3f", triptime)))
 		}
 
+	// Unreliable DATA packet received
+	case DATASequenced, DATAUnreliable:
+
+		// Show Log
+		teolog.DebugVf(MODULE, "got %s packet id: %d, channel: %s, "+
+			"data_len: %d", pac.TypeString(), pac.ID(), key, len(pac.data),
+		)
+
+		// Send data to user level
+		pac.unreliableReceived(tcd)
+
+	// COOKIE packet received (server requires handshake cookie)
+	case COOKIE:
+
+		teolog.DebugV(MODULE, "got COOKIE packet, channel:", key)
+		pac.cookieReceived(tcd)
+
+	// COOKIE_ECHO packet received (channel created when cookie valid)
+	case COOKIEEcho:
+
+		teolog.DebugV(MODULE, "got COOKIE_ECHO packet, channel:", key)
+
+	// FIN packet received (remote host closes channel)
+	case FIN:
+
+		teolog.DebugV(MODULE, "got FIN packet, channel:", key)
+		pac.finReceived(tcd)
+
+	// ACK-to-FIN packet received
+	case FINAck:
+
+		teolog.DebugV(MODULE, "got FIN_ACK packet, channel:", key)
+		pac.finAckReceived(tcd)
+
+	// FEC packet received
+	case FEC:
+
+		// Show Log
+		teolog.DebugVf(MODULE, "got FEC packet id: %d, channel: %s, "+
+			"data_len: %d\n", pac.ID(), key, len(pac.data),
+		)
+
+		// Save FEC packet and recover lost packet
+		pac.fecReceivedParity(tcd)
+
 	// UNKNOWN packet received
 	default:
 		teolog.DebugV(MODULE, "UNKNOWN packet received, channel:", key,
@@ -143,6 +230,15 @@ func (pac *packetType) packetDistance(expectedID uint32, id uint32) int {
 	return int(diff - packetIDlimit)
 }
 
+// dataReceived create ACK packet and send it back to sender, process
+// received data packet and save it to recover lost packets by FEC
+func (pac *packetType) dataReceived(tcd *ChannelData) {
+	pac.newAck().writeTo(tcd)
+	tcd.stat.received(len(pac.data))
+	pac.packetDataProcess(tcd)
+	pac.fecReceived(tcd)
+}
+
 // packetDataProcess process received data packet, check receivedQueue and
 // send received data and events to user level
 func (pac *packetType) packetDataProcess(tcd *ChannelData) {
@@ -197,6 +293,11 @@ func (pac *packetType) packetDataProcess(tcd *ChannelData) {
 				fmt.Sprintf("put packet id: %d, channel: %s to received queue, "+
 					"wait previouse packets", id, tcd.GetKey())))
 			tcd.receiveQueue.Add(pac)
+			// Send unordered packet data to user level when received, it
+			// skipped when processed in receive queue
+			if pac.Type() == DATAUnordered {
+				tcd.trudp.sendEvent(tcd, EvGotData, pac.Data())
+			}
 			// <<<< Added to fix overload receve queueu
 			tcd.receiveQueueProcess(func(data []byte) {
 				tcd.trudp.sendEvent(tcd, EvGotData, data)
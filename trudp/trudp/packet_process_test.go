@@ -71,7 +71,7 @@ func TestPacketType_PacketDistance(t *testing.T) {
 		trudp      *TRUDP
 		data       []byte
 		sendQueueF bool
-		destoryF   bool
+		pooled     bool
 	}
 	type args struct {
 		expectedID uint32
@@ -100,7 +100,7 @@ func TestPacketType_PacketDistance(t *testing.T) {
 				trudp:      tt.fields.trudp,
 				data:       tt.fields.data,
 				sendQueueF: tt.fields.sendQueueF,
-				destoryF:   tt.fields.destoryF,
+				pooled:     tt.fields.pooled,
 			}
 			if got := pac.packetDistance(tt.args.expectedID, tt.args.id); got != tt.want {
 				t.Errorf("packetType.packetDistance() = %v, want %v", got, tt.want)
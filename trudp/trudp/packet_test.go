@@ -0,0 +1,204 @@
+package trudp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// unhex decodes hex string with spaces
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestPacketHeader check packets are wire compatible with packets created by
+// previous C implementation
+func TestPacketHeader(t *testing.T) {
+	pac := &packetType{}
+	data := pac.newPacket(DATA, 0x01020304, 5, 0x8ee6e89f, []byte("hello"))
+	ping := pac.newPacket(PING, 0, 7, 0x8ee6e909, []byte(echoMsg))
+	reset := pac.newPacket(RESET, 0, 5, 0x8ee6e92f, nil)
+	big := pac.newPacket(DATA, 0xfffffffe, 15, 0x8ee6e977, make([]byte, 4000))
+
+	tests := []struct {
+		name   string
+		packet *packetType
+		want   string
+	}{
+		{"data", data, "5c 02 55 00 04 03 02 01 9f e8 e6 8e 68 65 6c 6c 6f"},
+		{"ack", data.newAck(), "1c 12 05 00 04 03 02 01 9f e8 e6 8e"},
+		{"ping", ping, "ff 42 57 00 00 00 00 00 09 e9 e6 8e 70 69 6e 67 00"},
+		{"ack to ping", ping.newAckToPing(ping.Data()), "0f 52 57 00 00 00 00 00 09 e9 e6 8e 70 69 6e 67 00"},
+		{"reset", reset, "b3 22 05 00 00 00 00 00 2f e9 e6 8e"},
+		{"ack to reset", reset.newAckToReset(), "c3 32 05 00 00 00 00 00 2f e9 e6 8e"},
+		{"big data header", &packetType{data: big.data[:HeaderLength]}, "da 02 0f fa fe ff ff ff 77 e9 e6 8e"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if want := unhex(t, tt.want); !bytes.Equal(tt.packet.data, want) {
+				t.Errorf("wrong packet:\n got % x\nwant % x", tt.packet.data, want)
+			}
+		})
+	}
+
+	t.Run("parse and check", func(t *testing.T) {
+		if !pac.check(data.data) || !pac.check(big.data) {
+			t.Error("valid packet does not pass check")
+		}
+		if data.Type() != DATA || data.ID() != 0x01020304 || data.Channel() != 5 ||
+			data.Timestamp() != 0x8ee6e89f || string(data.Data()) != "hello" {
+			t.Errorf("wrong packet fields: %s %d %d %x %q", data.TypeString(),
+				data.ID(), data.Channel(), data.Timestamp(), data.Data())
+		}
+		wrong := append([]byte(nil), data.data...)
+		wrong[5]++
+		if pac.check(wrong) || pac.check(data.data[:HeaderLength-1]) ||
+			pac.check(data.data[:len(data.data)-1]) {
+			t.Error("wrong packet pass check")
+		}
+	})
+
+	t.Run("connection id", func(t *testing.T) {
+		p := pac.newPacket(DATA, 0x01020304, 5, 0x8ee6e89f, []byte("hello"))
+		defer p.release()
+		p.setCID(0x1122334455667788)
+		want := "c1 03 55 00 04 03 02 01 9f e8 e6 8e 68 65 6c 6c 6f 88 77 66 55 44 33 22 11"
+		if !bytes.Equal(p.data, unhex(t, want)) {
+			t.Errorf("wrong packet:\n got % x\nwant %s", p.data, want)
+		}
+		if !pac.check(p.data) || p.CID() != 0x1122334455667788 ||
+			string(p.Data()) != "hello" {
+			t.Errorf("wrong packet with connection id: %x %q", p.CID(), p.Data())
+		}
+		wrong := append([]byte(nil), p.data...)
+		wrong[len(wrong)-1]++
+		if pac.check(wrong) || data.CID() != 0 {
+			t.Error("wrong connection id")
+		}
+	})
+
+	t.Run("update timestamp", func(t *testing.T) {
+		p := pac.newData(1, 0, []byte("hello"))
+		defer p.release()
+		p.updateTimestamp()
+		if !pac.check(p.data) {
+			t.Error("packet with updated timestamp does not pass check")
+		}
+	})
+}
+
+// TestPacketAllocs guards packets creating, sending and resending from
+// memory allocations
+func TestPacketAllocs(t *testing.T) {
+	pac := &packetType{}
+	data := make([]byte, 256)
+	if n := testing.AllocsPerRun(100, func() {
+		pac.newData(1, 0, data).release()
+	}); n != 0 {
+		t.Errorf("create and release data packet allocates: %v", n)
+	}
+
+	p := pac.newData(1, 0, data)
+	defer p.release()
+	if n := testing.AllocsPerRun(100, func() {
+		// Resend: writer gets packet reference and releases it after write
+		p.updateTimestamp().retain()
+		p.release()
+	}); n != 0 {
+		t.Errorf("resend data packet allocates: %v", n)
+	}
+}
+
+// TestPacketRefs check packet returns to pool when last reference released
+func TestPacketRefs(t *testing.T) {
+	pac := &packetType{}
+	p := pac.newData(1, 0, []byte("hello"))
+	p.retain()
+	if !p.inFlight() {
+		t.Error("retained packet is not in flight")
+	}
+	p.release()
+	if p.inFlight() || len(p.data) == 0 {
+		t.Error("packet released before last reference released")
+	}
+	p.release()
+	if len(p.data) != 0 {
+		t.Error("packet does not released after last reference released")
+	}
+}
+
+func BenchmarkPacketNewData(b *testing.B) {
+	pac := &packetType{}
+	data := make([]byte, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pac.newData(uint32(i), 0, data).release()
+	}
+}
+
+func BenchmarkPacketResend(b *testing.B) {
+	pac := &packetType{}
+	p := pac.newData(1, 0, make([]byte, 256))
+	defer p.release()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.updateTimestamp().retain()
+		p.release()
+	}
+}
+
+func BenchmarkPacketAckProcess(b *testing.B) {
+	pac := &packetType{}
+	p := pac.newData(1, 0, make([]byte, 256))
+	defer p.release()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !pac.check(p.data) {
+			b.Fatal("wrong packet")
+		}
+		p.newAck().release()
+	}
+}
+
+// FuzzPacketCheck check received packets header check and parsing does not
+// panic. The seed corpus contains packets created by previous C
+// implementation.
+func FuzzPacketCheck(f *testing.F) {
+	for _, s := range []string{
+		"5c 02 55 00 04 03 02 01 9f e8 e6 8e 68 65 6c 6c 6f",
+		"1c 12 05 00 04 03 02 01 9f e8 e6 8e",
+		"ff 42 57 00 00 00 00 00 09 e9 e6 8e 70 69 6e 67 00",
+		"0f 52 57 00 00 00 00 00 09 e9 e6 8e 70 69 6e 67 00",
+		"b3 22 05 00 00 00 00 00 2f e9 e6 8e",
+		"c3 32 05 00 00 00 00 00 2f e9 e6 8e",
+		"da 02 0f fa fe ff ff ff 77 e9 e6 8e",
+	} {
+		b, _ := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+		f.Add(b)
+	}
+	pac := &packetType{}
+	cid := pac.newPacket(DATA, 1, 2, 3, []byte("cid"))
+	cid.setCID(0x1122334455667788)
+	f.Add(cid.data)
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if !pac.check(b) {
+			return
+		}
+		p := &packetType{data: b}
+		data := p.Data()
+		if len(data) > len(b)-HeaderLength {
+			t.Fatalf("wrong data length %d of packet length %d", len(data), len(b))
+		}
+		if p.CID() != 0 && len(b) < HeaderLength+cidLength {
+			t.Fatalf("connection ID in short packet")
+		}
+		_, _, _, _ = p.Channel(), p.ID(), p.TypeString(), p.Timestamp()
+		pmtuProbeSize(data)
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This module contain channels path MTU discovery (DPLPMTUD style: the PING
+// packets padded to probed size are sent to channel and the probed size is
+// confirmed when ACK to this PING received).
+
+package trudp
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+const (
+	baseMTU              = 512                            // (bytes) MTU used before path MTU probed
+	maxMTU               = HeaderLength + 0xFFF           // (bytes) max packet length
+	pmtuAccuracy         = 16                             // (bytes) search done when probe range less than
+	pmtuMaxProbes        = 3                              // (number) max probes of one size
+	pmtuProbeTimeout     = 500 * time.Millisecond         // probe lost if ACK does not received during timeout
+	pmtuRaiseTimeout     = 10 * time.Minute               // start new search after timeout
+	pmtuBlackHoleAttempt = 5                              // (number) resend attempts of large packet to detect black hole
+	pmtuProbeMsg         = "pmtu\x00"                     // probe message prefix
+	pmtuProbeHeader      = len(pmtuProbeMsg) + 2          // probe message prefix and probed size
+	pmtuMinProbe         = HeaderLength + pmtuProbeHeader // min probe packet length
+)
+
+// MTUDiscovery is the Init option which enables channels path MTU discovery.
+// Packets sent from UDP connection have Don't Fragment flag when it enabled
+// (on Linux).
+type MTUDiscovery bool
+
+// pmtuDiscovery is the channel path MTU discovery state
+type pmtuDiscovery struct {
+	mtu        int32     // confirmed path MTU (atomic)
+	low, high  int       // search range: confirmed and max probed size
+	probe      int       // probed size or 0 if probe is not sent
+	probeCount int       // number of probes with probed size
+	probeTime  time.Time // time when last probe sent
+	doneTime   time.Time // time when search done
+}
+
+// pmtuInit initialize channel path MTU discovery
+func (tcd *ChannelData) pmtuInit() {
+	tcd.pmtu = pmtuDiscovery{mtu: baseMTU, low: baseMTU, high: maxMTU}
+}
+
+// MTU return channel path MTU: max length of TR-UDP packet (header and data)
+// which may be sent to this channel without fragmentation
+func (tcd *ChannelData) MTU() int {
+	return int(atomic.LoadInt32(&tcd.pmtu.mtu))
+}
+
+// pmtuProcess send next probe or check lost probe, it called by worker timer
+func (tcd *ChannelData) pmtuProcess() {
+	p := &tcd.pmtu
+	if !tcd.trudp.mtuDiscoveryF || !tcd.connected {
+		return
+	}
+
+	// Check probe timeout and resend probe or set new search range
+	if p.probe > 0 {
+		if time.Since(p.probeTime) < pmtuProbeTimeout {
+			return
+		}
+		if p.probeCount < pmtuMaxProbes {
+			tcd.pmtuSendProbe()
+			return
+		}
+		p.high = p.probe - 1
+		p.probe = 0
+	}
+
+	// Search done, start new search after raise timeout
+	if p.high-p.low < pmtuAccuracy {
+		if p.doneTime.IsZero() {
+			p.doneTime = time.Now()
+			teolog.Log(teolog.DEBUGv, MODULE, "channel", tcd.key, "path mtu:",
+				p.low)
+			return
+		}
+		if time.Since(p.doneTime) < pmtuRaiseTimeout {
+			return
+		}
+		p.high = maxMTU
+		p.doneTime = time.Time{}
+	}
+
+	// Send first probe of new size
+	p.probe = (p.low + p.high + 1) / 2
+	p.probeCount = 0
+	tcd.pmtuSendProbe()
+}
+
+// pmtuSendProbe send PING padded to probed size
+func (tcd *ChannelData) pmtuSendProbe() {
+	p := &tcd.pmtu
+	data := make([]byte, p.probe-tcd.Overhead())
+	copy(data, pmtuProbeMsg)
+	binary.LittleEndian.PutUint16(data[len(pmtuProbeMsg):], uint16(p.probe))
+	tcd.trudp.packet.newPing(tcd.ch, data).writeTo(tcd)
+	p.probeTime = time.Now()
+	p.probeCount++
+}
+
+// pmtuProbeSize return probed size if data is probe message or 0
+func pmtuProbeSize(data []byte) int {
+	if len(data) < pmtuProbeHeader || string(data[:len(pmtuProbeMsg)]) != pmtuProbeMsg {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint16(data[len(pmtuProbeMsg):]))
+}
+
+// pmtuAck process ACK to probe: the probed size is confirmed
+func (tcd *ChannelData) pmtuAck(size int) {
+	p := &tcd.pmtu
+	if size != p.probe {
+		return
+	}
+	if size > p.low {
+		p.low = size
+		atomic.StoreInt32(&p.mtu, int32(size))
+	}
+	p.probe = 0
+}
+
+// pmtuBlackHole reset path MTU when large packet does not delivered after
+// resends (path MTU decreased)
+func (tcd *ChannelData) pmtuBlackHole(length int) {
+	p := &tcd.pmtu
+	if length <= baseMTU || length > tcd.MTU() {
+		return
+	}
+	teolog.Log(teolog.DEBUGv, MODULE, "channel", tcd.key,
+		"black hole detected, packet length:", length)
+	p.low = baseMTU
+	p.high = length - 1
+	p.probe = 0
+	p.doneTime = time.Time{}
+	atomic.StoreInt32(&p.mtu, baseMTU)
+}
@@ -4,14 +4,16 @@ import (
 	"fmt"
 	"net"
 	"sort"
-	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kirill-scherba/teonet-go/teolog/teolog"
 )
 
-// This module process all trudp internal events:
+// This module process all trudp internal events (channels are sharded between
+// workers by channel key, each worker process events of its channels):
 // - read (received from udp),
 // - write (received from user level, need write to udp)
 // - keep alive timer
@@ -20,22 +22,22 @@ import (
 
 // process data structure
 type process struct {
-	trudp       *TRUDP           // link to trudp
-	chanReader  chan *readerType // channel to read (used to process packets received from udp)
-	chanWrite   chan *writeType  // channel to write (used to send data from user level)
-	chanWriter  chan *writerType // channel to write (used to write data to udp)
-	chanKernel  chan func()      // channel to execute function on kernel level
-	chanKernelF bool             // channels closed flag
-	timerResend <-chan time.Time // resend packet from send queue timer
+	trudp      *TRUDP          // link to trudp
+	workers    []*worker       // channels workers
+	chanWriter chan writerType // channel to write (used to write data to udp)
+	routes     sync.Map        // channels with connection ID keys routes to workers
 
 	stopRunningF bool           // Stop running flag
+	showStatF    int32          // Show statistic is running flag (atomic)
+	statsCB      statsCallback  // Periodic statistic callback
 	once         sync.Once      // Once to sync trudp event channel stop
 	wg           sync.WaitGroup // Wait group
+	wgWorkers    sync.WaitGroup // Workers wait group
 }
 
 // read channel data structure
 type readerType struct {
-	addr   *net.UDPAddr
+	addr   net.Addr
 	packet *packetType
 }
 
@@ -44,133 +46,77 @@ type writeType struct {
 	tcd        *ChannelData
 	data       []byte
 	chanAnswer chan bool
+	class      DeliveryClass // message delivery class
+	priority   Priority      // message priority in write queue
 }
 
 type writerType struct {
 	packet *packetType
-	addr   *net.UDPAddr
+	addr   net.Addr
 }
 
 const disconnectTime = disconnectAfter * time.Millisecond
 const sleepTime = pingAfter * time.Millisecond
 
-// init
-func (proc *process) init(trudp *TRUDP) *process {
+// init create and start numWorkers channels workers and udp writer
+func (proc *process) init(trudp *TRUDP, numWorkers int) *process {
 
 	proc.trudp = trudp
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
 
-	// Set time variables
-	resendTime := defaultRTT * time.Millisecond
-
-	// Init channels and timers
-	proc.chanKernel = make(chan func())                   // run in kernel channel
-	proc.chanReader = make(chan *readerType, chRWUdpSize) // read from udp channel
-	proc.chanWriter = make(chan *writerType, chRWUdpSize) // write to udp channel
-	proc.chanWrite = make(chan *writeType, chWriteSize)   // write from user level
-	//
-	proc.timerResend = time.After(resendTime)
+	// Init channels
+	proc.chanWriter = make(chan writerType, chRWUdpSize) // write to udp channel
 
-	var ebzdik1 = 0
+	// Channels workers
+	proc.wg.Add(1)
+	proc.wgWorkers.Add(numWorkers)
+	proc.workers = make([]*worker, numWorkers)
+	for i := range proc.workers {
+		proc.workers[i] = new(worker).init(proc, i)
+	}
 
-	// Module worker
+	// Do it when all workers stopped
 	go func() {
+		proc.wgWorkers.Wait()
+		close(proc.chanWriter)
 
-		teolog.Log(teolog.CONNECT, MODULE, "process worker started")
-		proc.wg.Add(1)
-
-		// Do it on return
-		defer func() {
-			close(proc.chanWriter)
-			teolog.Log(teolog.CONNECT, MODULE, "process worker stopped")
-
-			// Close trudp channels, send DESTROY event and close event channel
-			trudp.closeChannels()
-			trudp.sendEvent(nil, EvDestroy, []byte(trudp.udp.localAddr()))
-			close(trudp.chanEvent)
-			proc.chanKernelF = true
-			close(proc.chanKernel)
-
-			proc.wg.Done()
-		}()
-
-		chanWriteClosedF := false
-
-		for i := 0; ; {
-			select {
-
-			// Process read packet (received from udp)
-			case readPac, ok := <-proc.chanReader:
-				if !ok {
-					if !chanWriteClosedF {
-						chanWriteClosedF = true
-						close(trudp.proc.chanWrite)
-					}
-					break
-				}
-				// Process packets if chanEvent is available receive it to avoid deadlock
-				// \TODO: May be drop only data packets but process asks and packets
-				// which we wait to free receive queue
-				if trudp.sendEventAvailable() {
-					readPac.packet.process(readPac.addr)
-					ebzdik1 = 0
-				} else {
-					teolog.Error(MODULE, "ebzdik-1 chanEvent len: "+
-						strconv.Itoa(len(trudp.chanEvent))+" <===- ", ebzdik1)
-					ebzdik1++
-				}
-
-			// Process write packet (received from user level, need write to udp)
-			case writePac, ok := <-proc.chanWrite:
-				if !ok {
-					return
-				}
-				proc.writeTo(writePac)
-
-			case f, ok := <-proc.chanKernel:
-				if !ok {
-					return
-				}
-				f()
+		// Send DESTROY event and close event channel
+		trudp.sendEvent(nil, EvDestroy, []byte(trudp.udp.localAddr()))
+		close(trudp.chanEvent)
 
-			// Process send queue (resend packets from send queue), check Keep
-			// alive and show statistic (check after 30 ms)
-			case <-proc.timerResend:
-				// Loop trudp channels map and check Resend send queue and/or
-				// send keep alive signal (ping)
-				for _, tcd := range proc.trudp.tcdmap {
-					// Resend
-					tcd.sendQueueResendProcess()
-					// Keep alive (every 33*30ms = 990ms)
-					if i%33 == 0 {
-						tcd.keepAlive()
-					}
-					// Calculate sendQueue size (every 3*30ms = 90ms)
-					if i%3 == 0 {
-						tcd.sendQueueCalculateLength()
-					}
-				}
-				// Show statistic window (every 3*30ms = 90ms)
-				if i%3 == 0 {
-					proc.showStatistic()
-				}
-				proc.timerResend = time.After(resendTime) // Set new timer value
-				i++
-			}
-		}
+		proc.wg.Done()
 	}()
 
 	// Write worker
+	proc.wg.Add(1)
 	go func() {
-		proc.wg.Add(1)
 		teolog.Log(teolog.CONNECT, MODULE, "writer worker started")
 		defer func() {
 			teolog.Log(teolog.CONNECT, MODULE, "writer worker stopped")
 			proc.wg.Done()
 		}()
+		ws := make([]writerType, 0, batchSize)
 		for w := range proc.chanWriter {
-			proc.trudp.udp.writeTo(w.packet.data, w.addr)
-			if !w.packet.sendQueueF {
-				w.packet.destroy()
+			// Get packets waiting in writer channel and write them by batch
+			ws = append(ws[:0], w)
+		batch:
+			for len(ws) < batchSize {
+				select {
+				case w, ok := <-proc.chanWriter:
+					if !ok {
+						break batch
+					}
+					ws = append(ws, w)
+				default:
+					break batch
+				}
+			}
+			proc.trudp.udp.writeBatch(ws)
+			for i, w := range ws {
+				w.packet.release()
+				ws[i] = writerType{}
 			}
 		}
 	}()
@@ -178,12 +124,42 @@ func (proc *process) init(trudp *TRUDP) *process {
 	return proc
 }
 
-// writeTo write packet to trudp channel or write packet to write queue
+// worker return channels worker which owns channel with key
+func (proc *process) worker(key string) *worker {
+	if len(proc.workers) == 1 {
+		return proc.workers[0]
+	}
+	// FNV-1a hash of key
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return proc.workers[h%uint32(len(proc.workers))]
+}
+
+// stop stops channels workers
+func (proc *process) stop() {
+	for _, w := range proc.workers {
+		close(w.chanReader)
+	}
+}
+
+// writeTo write packet to trudp channel or write packet to write queue.
+// Unreliable packets are written to trudp channel without queuing, reliable
+// packets are written directly if write queue does not contain packets with
+// the same or higher priority.
 func (proc *process) writeTo(writePac *writeType) {
 	tcd := writePac.tcd
-	if len(tcd.writeQueue) == 0 && tcd.canWrite() {
+	switch {
+	case tcd.stoppedF || tcd.closingF():
+		writePac.chanAnswer <- false
+	case !writePac.class.reliable():
+		proc.writeUnreliable(writePac)
+	case (len(tcd.writeQueue) == 0 ||
+		tcd.writeQueue[0].priority < writePac.priority) && tcd.canWrite():
 		proc.writeToDirect(writePac)
-	} else {
+	default:
 		proc.writeToQueue(tcd, writePac)
 	}
 }
@@ -191,13 +167,24 @@ func (proc *process) writeTo(writePac *writeType) {
 // writeToDirect write packet to trudp channel and send true to Answer channel
 func (proc *process) writeToDirect(writePac *writeType) {
 	tcd := writePac.tcd
-	proc.trudp.packet.newData(tcd.ID(), tcd.ch, writePac.data).writeTo(tcd)
+	id := tcd.ID()
+	typ := writePac.class.packetType()
+	proc.trudp.packet.newPacket(typ, id, tcd.ch, proc.trudp.Timestamp(),
+		writePac.data).writeTo(tcd)
+	tcd.fecAdd(typ, id, writePac.data)
 	writePac.chanAnswer <- true
 }
 
-// writeToQueue add write packet to write queue
+// writeToQueue add write packet to write queue after packets with the same
+// or higher priority
 func (proc *process) writeToQueue(tcd *ChannelData, writePac *writeType) {
-	tcd.writeQueue = append(tcd.writeQueue, writePac)
+	i := len(tcd.writeQueue)
+	for i > 0 && tcd.writeQueue[i-1].priority < writePac.priority {
+		i--
+	}
+	tcd.writeQueue = append(tcd.writeQueue, nil)
+	copy(tcd.writeQueue[i+1:], tcd.writeQueue[i:])
+	tcd.writeQueue[i] = writePac
 }
 
 // writeFromQueue get packet from writeQueue and send it to trudp channel
@@ -226,34 +213,49 @@ func (proc *process) writeQueueReset(tcd *ChannelData) {
 
 func (proc *process) showStatistic() {
 	trudp := proc.trudp
-	if !trudp.showStatF {
+	if !trudp.showStatF || !atomic.CompareAndSwapInt32(&proc.showStatF, 0, 1) {
 		return
 	}
-	idx := 0
-	t := time.Now()
-	var str string
-
-	// Read trudp channels map keys to slice and sort it
-	keys := make([]string, len(trudp.tcdmap))
-	for key := range trudp.tcdmap {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
+	go func() {
+		defer atomic.StoreInt32(&proc.showStatF, 0)
+		t := time.Now()
+
+		// Read trudp channels keys and packets statistic from all workers
+		var keys []string
+		var total packetsStat
+		for _, w := range proc.workers {
+			w.kernelWait(func() {
+				for key := range w.tcdmap {
+					keys = append(keys, key)
+				}
+				total.add(&w.packets)
+			})
+		}
+		sort.Strings(keys)
 
-	// Get trudp channels statistic string by sorted keys
-	for _, key := range keys {
-		tcd, ok := trudp.tcdmap[key]
-		if ok {
-			str += tcd.stat.statBody(tcd, idx, 0)
-			idx++
+		// Get trudp channels statistic strings by sorted keys in channels
+		// workers
+		index := make(map[string]int, len(keys))
+		for idx, key := range keys {
+			index[key] = idx
+		}
+		body := make([]string, len(keys))
+		for _, w := range proc.workers {
+			w.kernelWait(func() {
+				for key, tcd := range w.tcdmap {
+					if idx, ok := index[key]; ok {
+						body[idx] = tcd.stat.statBody(tcd, idx, 0)
+					}
+				}
+			})
 		}
-	}
 
-	// Get fotter and print statistic string
-	tcs := &channelStat{trudp: trudp} // Empty Methods holder
-	str = tcs.statHeader(time.Since(trudp.startTime), time.Since(t)) + str +
-		tcs.statFooter(idx)
-	fmt.Print(str)
+		// Get fotter and print statistic string
+		tcs := &channelStat{trudp: trudp, total: &total} // Empty Methods holder
+		str := tcs.statHeader(time.Since(trudp.startTime), time.Since(t)) +
+			strings.Join(body, "") + tcs.statFooter(len(keys))
+		fmt.Print(str)
+	}()
 }
 
 // destroy
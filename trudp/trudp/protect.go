@@ -0,0 +1,251 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This module contain server protection from spoofed channels creation:
+// stateless handshake cookie and limits of channels number.
+//
+// When handshake cookie is required the server does not create channel when
+// DATA packet received from unknown channel. It answers with COOKIE packet
+// which contains cookie calculated from remote address, channel number and
+// time. The client answers with COOKIE_ECHO packet which contains the same
+// cookie, and the server creates channel when the cookie is valid. The
+// client DATA packets are resent to created channel from send queue.
+//
+// The COOKIE packet is sent only to packets which are not shorter than the
+// COOKIE packet, so the server can't be used to amplify spoofed traffic. The
+// client DATA packet may be shorter, so the client channel sends PING cookie
+// request padded to COOKIE packet length until first ACK received.
+//
+// Cookie (COOKIE and COOKIE_ECHO packets data):
+//
+//	bytes 0-3   cookie creation time in seconds (little endian)
+//	bytes 4-11  HMAC-SHA256 of time, remote address and channel number
+
+package trudp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+const (
+	cookieLength   = 12 // (bytes) cookie length
+	cookieMACLen   = 8  // (bytes) cookie HMAC length
+	cookieLifetime = 10 // (seconds) cookie valid during lifetime
+
+	cookieRequestMsg     = "cook\x00"             // cookie request message prefix
+	cookieRequestTimeout = 250 * time.Millisecond // cookie request resent after timeout
+)
+
+// Protection is the Init option which enables server protection from spoofed
+// channels creation
+type Protection struct {
+	Cookie           bool // Create channels after handshake cookie checked
+	MaxChannels      int  // Max number of channels (0 - unlimited)
+	MaxChannelsPerIP int  // Max number of channels from one IP (0 - unlimited)
+}
+
+// protection is the server protection state
+type protection struct {
+	Protection
+	secret   []byte         // cookie HMAC secret
+	channels int32          // number of channels (atomic)
+	mx       sync.Mutex     // ips mutex
+	ips      map[string]int // number of channels by IP
+	rejected uint64         // rejected channels creation attempts (atomic)
+}
+
+// init initialize server protection
+func (p *protection) init(opt Protection) {
+	p.Protection = opt
+	p.secret = make([]byte, sha256.Size)
+	rand.Read(p.secret)
+	p.ips = make(map[string]int)
+}
+
+// Rejected return number of rejected channels creation attempts
+func (trudp *TRUDP) Rejected() uint64 {
+	return atomic.LoadUint64(&trudp.protect.rejected)
+}
+
+// reject add rejected channel creation attempt to statistic
+func (p *protection) reject(addr net.Addr, reason string) {
+	atomic.AddUint64(&p.rejected, 1)
+	teolog.DebugV(MODULE, "reject channel from", addr, ":", reason)
+}
+
+// addrIP return IP string of address
+func addrIP(addr net.Addr) string {
+	if a, ok := addr.(*net.UDPAddr); ok {
+		return a.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// add count created channel, it return false if channels limits exceeded
+func (p *protection) add(addr net.Addr) bool {
+	if p.MaxChannels > 0 &&
+		atomic.AddInt32(&p.channels, 1) > int32(p.MaxChannels) {
+		atomic.AddInt32(&p.channels, -1)
+		return false
+	}
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	ip := addrIP(addr)
+	if p.MaxChannelsPerIP > 0 && p.ips[ip] >= p.MaxChannelsPerIP {
+		if p.MaxChannels > 0 {
+			atomic.AddInt32(&p.channels, -1)
+		}
+		return false
+	}
+	p.ips[ip]++
+	return true
+}
+
+// remove count destroyed channel
+func (p *protection) remove(addr net.Addr) {
+	if p.MaxChannels > 0 {
+		atomic.AddInt32(&p.channels, -1)
+	}
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	ip := addrIP(addr)
+	if p.ips[ip]--; p.ips[ip] <= 0 {
+		delete(p.ips, ip)
+	}
+}
+
+// enabled return true if server protection enabled
+func (p *protection) enabled() bool {
+	return p.Cookie || p.MaxChannels > 0 || p.MaxChannelsPerIP > 0
+}
+
+// cookie calculate cookie for remote address and channel at time ts
+func (p *protection) cookie(addr net.Addr, ch int, ts uint32) []byte {
+	c := make([]byte, cookieLength)
+	binary.LittleEndian.PutUint32(c, ts)
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(c[:4])
+	mac.Write([]byte(addr.String()))
+	mac.Write([]byte{byte(ch)})
+	copy(c[4:], mac.Sum(nil)[:cookieMACLen])
+	return c
+}
+
+// checkCookie return true if cookie is valid for remote address and channel
+func (p *protection) checkCookie(addr net.Addr, ch int, c []byte) bool {
+	if len(c) != cookieLength {
+		return false
+	}
+	ts := binary.LittleEndian.Uint32(c)
+	now := uint32(time.Now().Unix())
+	if ts > now || now-ts > cookieLifetime {
+		return false
+	}
+	return hmac.Equal(c, p.cookie(addr, ch, ts))
+}
+
+// move count channel migrated to new address (the limits are not checked)
+func (p *protection) move(addr, newaddr net.Addr) {
+	p.remove(addr)
+	if p.MaxChannels > 0 {
+		atomic.AddInt32(&p.channels, 1)
+	}
+	p.mx.Lock()
+	p.ips[addrIP(newaddr)]++
+	p.mx.Unlock()
+}
+
+// admit check received packet from channel which does not exists yet and
+// return true if channel can be created, the counted is true if channel
+// counted in channels limits. When handshake cookie required the COOKIE
+// packet is sent to data packets and channel is created when valid
+// COOKIE_ECHO packet received.
+func (pac *packetType) admit(addr net.Addr) (ok, counted bool) {
+	trudp := pac.trudp
+	p := &trudp.protect
+	typ := pac.Type()
+	request := typ == PING && pac.cookieRequest()
+	if !p.enabled() || !isData(typ) && typ != COOKIEEcho && !request {
+		return true, false
+	}
+	ch := pac.Channel()
+	key := trudp.makeKey(addr, ch)
+	if _, ok := trudp.proc.channelWorker(key, pac.CID()).tcdmap[key]; ok {
+		return true, false
+	}
+
+	switch {
+	case p.Cookie && typ != COOKIEEcho && len(pac.data) < pac.cookieLen():
+		p.reject(addr, "short packet")
+		return
+	case p.Cookie && typ != COOKIEEcho:
+		cookie := pac.newPacket(COOKIE, 0, ch, trudp.Timestamp(),
+			p.cookie(addr, ch, uint32(time.Now().Unix())))
+		cookie.setCID(pac.CID())
+		trudp.proc.chanWriter <- writerType{cookie, addr}
+		p.reject(addr, "cookie sent")
+		return
+	case request:
+		return
+	case typ == COOKIEEcho && !p.checkCookie(addr, ch, pac.Data()):
+		p.reject(addr, "wrong cookie")
+		return
+	case !p.add(addr):
+		p.reject(addr, "channels limit exceeded")
+		return
+	}
+	return true, true
+}
+
+// cookieLen return length of COOKIE packet sent in answer to packet
+func (pac *packetType) cookieLen() int {
+	if pac.CID() != 0 {
+		return HeaderLength + cookieLength + cidLength
+	}
+	return HeaderLength + cookieLength
+}
+
+// cookieRequest return true if packet data is cookie request
+func (pac *packetType) cookieRequest() bool {
+	return bytes.HasPrefix(pac.Data(), []byte(cookieRequestMsg))
+}
+
+// cookieRequestProcess send cookie request PING padded to COOKIE packet
+// length while channel created by ConnectChannel has packets in send queue
+// and does not receive ACK, it called by worker timer
+func (tcd *ChannelData) cookieRequestProcess() {
+	if !tcd.handshakeF || tcd.sendQueue.q.Len() == 0 ||
+		time.Since(tcd.cookieTime) < cookieRequestTimeout {
+		return
+	}
+	tcd.cookieTime = time.Now()
+	data := make([]byte, cookieLength)
+	copy(data, cookieRequestMsg)
+	tcd.trudp.packet.newPing(tcd.ch, data).writeTo(tcd)
+}
+
+// cookieReceived process COOKIE packet received by client: send COOKIE_ECHO
+// packet and resend packets from send queue
+func (pac *packetType) cookieReceived(tcd *ChannelData) {
+	pac.newPacket(COOKIEEcho, 0, tcd.ch, tcd.trudp.Timestamp(),
+		pac.Data()).writeTo(tcd)
+	now := time.Now()
+	for e := tcd.sendQueue.q.Front(); e != nil; e = e.Next() {
+		e.Value.(*sendQueueData).arrivalTime = now
+	}
+}
@@ -43,7 +43,9 @@ func (tcd *ChannelData) receiveQueueProcess(sendEvent func(data []byte)) (err er
 		}
 		tcd.incID(&tcd.expectedID)
 		teolog.Log(teolog.DEBUGvv, MODULE, "find packet in receivedQueue, id:", id)
-		sendEvent(rqd.packet.Data())
+		if rqd.packet.Type() != DATAUnordered {
+			sendEvent(rqd.packet.Data())
+		}
 		tcd.receiveQueue.Remove(id)
 	}
 	return
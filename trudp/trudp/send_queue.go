@@ -36,7 +36,7 @@ func sendQueueIdxInit() sendQueueIdx {
 // sendQueueReset resets (clear) send queue
 func (tcd *ChannelData) sendQueueReset() {
 	for e := tcd.sendQueue.q.Front(); e != nil; e = e.Next() {
-		e.Value.(*sendQueueData).packet.destroy()
+		e.Value.(*sendQueueData).packet.release()
 	}
 	tcd.sendQueue.q.Init()
 	tcd.sendQueue.idx = sendQueueIdxInit()
@@ -44,12 +44,11 @@ func (tcd *ChannelData) sendQueueReset() {
 
 // sendQueueRttTime return send queue rtt time
 func (tcd *ChannelData) sendQueueRttTime() (triptimeMiddle time.Duration) {
-	if tcd.stat.triptimeMiddle > maxRTT {
-		triptimeMiddle = maxRTT
-	} else {
-		triptimeMiddle = time.Duration(tcd.stat.triptimeMiddle)
+	triptimeMiddle = time.Duration(tcd.stat.triptimeMiddle * float32(time.Millisecond))
+	if triptimeMiddle > tcd.cfg.MaxRTT {
+		triptimeMiddle = tcd.cfg.MaxRTT
 	}
-	triptimeMiddle = (triptimeMiddle + defaultRTT) * time.Millisecond
+	triptimeMiddle += tcd.cfg.DefaultRTT
 	return
 }
 
@@ -58,7 +57,7 @@ func (tcd *ChannelData) sendQueueCalculateLength() {
 	// Calculate new send queue length if send packets speed more than 30 pac/sec
 	if tcd.stat.packets.sendRT.SpeedPacSec > 30 {
 		//currentLen := tcd.sendQueue.Len()
-		lessMaxSize := tcd.maxQueueSize < 2048 //1024
+		lessMaxSize := tcd.maxQueueSize < tcd.cfg.MaxQueueSize //1024
 		queueIsFull := tcd.sendQueue.q.Len() >= tcd.maxQueueSize
 		largerDefaultSize := tcd.maxQueueSize > 4 //tcd.trudp.defaultQueueSize
 		//  if queue capacity less max capacity size
@@ -84,7 +83,7 @@ func (tcd *ChannelData) sendQueueCalculateLength() {
 
 // sendQueueResendProcess resend packet from send queue if it does not got
 // ACK during selected time. Destroy channel if too much resends happens =
-// maxResendAttempt constant
+// MaxResendAttempt of channel configuration
 // \TODO check this resend and calculate new resend time algorithm
 func (tcd *ChannelData) sendQueueResendProcess() (rtt time.Duration) {
 	now := time.Now()
@@ -96,19 +95,24 @@ func (tcd *ChannelData) sendQueueResendProcess() (rtt time.Duration) {
 			break
 		}
 		// Destroy this trudp channel if resendAttemp more than maxResendAttemp
-		if sqd.resendAttempt >= maxResendAttempt {
+		if sqd.resendAttempt >= tcd.cfg.MaxResendAttempt {
 			tcd.destroy(teolog.DEBUGv, fmt.Sprint("destroy channel ",
 				tcd.GetKey(), ": too much resends happens: ",
 				sqd.resendAttempt))
 			break
 		}
-		// Resend packet, save resend to statistic and show message
-		// sqd.packet.updateTimestamp().writeTo(tcd)
-		p := sqd.packet
-		p.destoryF = false
-		p.data = append([]byte(nil), sqd.packet.data...)
-		p.updateTimestamp().writeTo(tcd)
-		//
+		// Check path MTU decreased
+		if sqd.resendAttempt == pmtuBlackHoleAttempt {
+			tcd.pmtuBlackHole(len(sqd.packet.data))
+		}
+		// Wait while previous sending of this packet is in udp writer channel
+		if sqd.packet.inFlight() {
+			sqd.arrivalTime = now.Add(tcd.sendQueueRttTime())
+			continue
+		}
+		// Resend packet (the packet buffer is reused without copy), save
+		// resend to statistic and show message
+		sqd.packet.updateTimestamp().writeTo(tcd)
 		tcd.stat.repeat(true)
 		teolog.Log(teolog.DEBUGvv, MODULE, "resend sendQueue packet ",
 			"id:", sqd.packet.ID(),
@@ -160,7 +164,7 @@ func (s *sendQueue) Find(id uint32) (e *list.Element,
 func (s *sendQueue) Remove(id uint32) {
 	e, sqd, ok := s.Find(id)
 	if ok {
-		sqd.packet.destroy()
+		sqd.packet.release()
 		s.q.Remove(e)
 		delete(s.idx, id)
 		teolog.Log(teolog.DEBUGvv, MODULE, "remove from send queue, id:", id)
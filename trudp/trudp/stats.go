@@ -0,0 +1,166 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This module contain structured statistic API: TRUDP and ChannelData
+// statistic snapshots and periodic statistic callback.
+
+package trudp
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PacketsStats is packets statistic snapshot
+type PacketsStats struct {
+	Send          uint32  `json:"send"`            // Data packets send
+	SendBytes     uint64  `json:"send_bytes"`      // Data send in bytes
+	SendRate      int     `json:"send_rate"`       // Send speed in packets/sec
+	SendMbRate    float32 `json:"send_mb_rate"`    // Send speed in mb/sec
+	Receive       uint32  `json:"receive"`         // Data packets received
+	ReceiveBytes  uint64  `json:"receive_bytes"`   // Data received in bytes
+	ReceiveRate   int     `json:"receive_rate"`    // Receive speed in packets/sec
+	ReceiveMbRate float32 `json:"receive_mb_rate"` // Receive speed in mb/sec
+	Ack           uint32  `json:"ack"`             // ACK packets received
+	Repeat        uint32  `json:"repeat"`          // Data packets repeated
+	RepeatRate    int     `json:"repeat_rate"`     // Repeat speed in packets/sec
+	Dropped       uint32  `json:"dropped"`         // Received data packets dropped
+	FEC           uint32  `json:"fec"`             // FEC packets send
+	Recovered     uint32  `json:"recovered"`       // Data packets recovered by FEC
+}
+
+// ChannelStats is trudp channel statistic snapshot
+type ChannelStats struct {
+	Key            string    `json:"key"`             // Channel key
+	Started        time.Time `json:"started"`         // Time when channel created
+	LastReceived   time.Time `json:"last_received"`   // Time when last packet received
+	Triptime       float32   `json:"triptime"`        // Triptime in ms
+	TriptimeMiddle float32   `json:"triptime_middle"` // Middle triptime in ms
+	SendQueue      int       `json:"send_queue"`      // Send queue length
+	SendQueueMax   int       `json:"send_queue_max"`  // Send queue max length
+	WriteQueue     int       `json:"write_queue"`     // Write queue length
+	ReceiveQueue   int       `json:"receive_queue"`   // Receive queue length
+	PacketsStats
+}
+
+// Stats is trudp connection statistic snapshot
+type Stats struct {
+	Running      time.Duration  `json:"running"`      // Running time
+	Channels     []ChannelStats `json:"channels"`     // Channels statistic sorted by key
+	ReadQueue    int            `json:"read_queue"`   // Read from udp channels length
+	WriterQueue  int            `json:"writer_queue"` // Write to udp channel length
+	EventQueue   int            `json:"event_queue"`  // Events channel length
+	WriteQueue   int            `json:"write_queue"`  // Write from user level channels length
+	Rejected     uint64         `json:"rejected"`     // Rejected channel creation attempts
+	PacketsStats                // Total packets statistic
+}
+
+// statsCallback is periodic statistic callback
+type statsCallback struct {
+	sync.Mutex
+	interval time.Duration // Callback interval
+	f        func(*Stats)  // Callback function
+	last     time.Time     // Last callback time
+	runningF int32         // Callback is running flag (atomic)
+}
+
+// stats return packets statistic snapshot
+func (ps *packetsStat) stats() PacketsStats {
+	return PacketsStats{
+		Send:          ps.send,
+		SendBytes:     ps.sendLength,
+		SendRate:      ps.sendRT.SpeedPacSec,
+		SendMbRate:    ps.sendRT.speedMbSec,
+		Receive:       ps.receive,
+		ReceiveBytes:  ps.receiveLength,
+		ReceiveRate:   ps.receiveRT.SpeedPacSec,
+		ReceiveMbRate: ps.receiveRT.speedMbSec,
+		Ack:           ps.ack,
+		Repeat:        ps.repeat,
+		RepeatRate:    ps.repeatRT.SpeedPacSec,
+		Dropped:       ps.dropped,
+		FEC:           ps.fec,
+		Recovered:     ps.recovered,
+	}
+}
+
+// stats return channel statistic snapshot, it should be executed in worker
+// which owns this channel
+func (tcd *ChannelData) stats() ChannelStats {
+	return ChannelStats{
+		Key:            tcd.key,
+		Started:        tcd.stat.timeStarted,
+		LastReceived:   tcd.stat.lastTimeReceived,
+		Triptime:       tcd.stat.triptime,
+		TriptimeMiddle: tcd.stat.triptimeMiddle,
+		SendQueue:      tcd.sendQueue.q.Len(),
+		SendQueueMax:   tcd.maxQueueSize,
+		WriteQueue:     len(tcd.writeQueue),
+		ReceiveQueue:   len(tcd.receiveQueue),
+		PacketsStats:   tcd.stat.packets.stats(),
+	}
+}
+
+// Stats return trudp channel statistic snapshot
+func (tcd *ChannelData) Stats() (s ChannelStats) {
+	tcd.worker.kernelWait(func() { s = tcd.stats() })
+	return
+}
+
+// Stats return trudp connection statistic snapshot: total packets statistic,
+// channels statistic and queues sizes
+func (trudp *TRUDP) Stats() (s *Stats) {
+	proc := trudp.proc
+	s = &Stats{
+		Running:     time.Since(trudp.startTime),
+		WriterQueue: len(proc.chanWriter),
+		EventQueue:  len(trudp.chanEvent),
+		Rejected:    trudp.Rejected(),
+	}
+	var total packetsStat
+	for _, w := range proc.workers {
+		w.kernelWait(func() {
+			for _, tcd := range w.tcdmap {
+				s.Channels = append(s.Channels, tcd.stats())
+			}
+			total.add(&w.packets)
+		})
+		s.ReadQueue += len(w.chanReader)
+		s.WriteQueue += len(w.chanWrite)
+	}
+	sort.Slice(s.Channels, func(i, j int) bool {
+		return s.Channels[i].Key < s.Channels[j].Key
+	})
+	s.PacketsStats = total.stats()
+	return
+}
+
+// SetStatsCallback set function called with trudp statistic snapshot every
+// interval, the nil function removes statistic callback
+func (trudp *TRUDP) SetStatsCallback(interval time.Duration, f func(*Stats)) {
+	cb := &trudp.proc.statsCB
+	cb.Lock()
+	defer cb.Unlock()
+	cb.interval, cb.f, cb.last = interval, f, time.Now()
+}
+
+// statsCallback execute statistic callback if its interval expired
+func (proc *process) statsCallback() {
+	cb := &proc.statsCB
+	cb.Lock()
+	f := cb.f
+	if f == nil || time.Since(cb.last) < cb.interval ||
+		!atomic.CompareAndSwapInt32(&cb.runningF, 0, 1) {
+		cb.Unlock()
+		return
+	}
+	cb.last = time.Now()
+	cb.Unlock()
+	go func() {
+		defer atomic.StoreInt32(&cb.runningF, 0)
+		f(proc.trudp.Stats())
+	}()
+}
@@ -0,0 +1,29 @@
+// Copyright 2019 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This module contain packet transport interface used by TRUDP to read and
+// write packets
+
+package trudp
+
+import "net"
+
+// PacketTransport is the packet oriented transport TRUDP works over. The UDP
+// connection created by Init is used by default. Any other transport (in
+// memory network, unix datagram socket or user provided conn) may be set in
+// the Init options. The *net.UDPConn and *net.UnixConn implements this
+// interface.
+type PacketTransport interface {
+	ReadFrom(b []byte) (n int, addr net.Addr, err error)
+	WriteTo(b []byte, addr net.Addr) (n int, err error)
+	LocalAddr() net.Addr
+	Close() error
+}
+
+// AddrResolver may be implemented by PacketTransport to resolve remote host
+// address used in Connect and ConnectChannel functions. The UDP address
+// resolver is used if transport does not implement this interface.
+type AddrResolver interface {
+	ResolveAddr(network, address string) (net.Addr, error)
+}
@@ -0,0 +1,64 @@
+package trudp
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestTransport execute TRUDP over unix datagram socket transport
+func TestTransport(t *testing.T) {
+
+	const numMessages = 1000
+
+	dir := t.TempDir()
+	listen := func(name string) *net.UnixConn {
+		addr := &net.UnixAddr{Name: filepath.Join(dir, name), Net: "unixgram"}
+		conn, err := net.ListenUnixgram("unixgram", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	var port1, port2 int
+	tru1 := Init(&port1, listen("tru1.sock"))
+	tru2 := Init(&port2, listen("tru2.sock"))
+	go tru1.Run()
+	go tru2.Run()
+	defer tru1.Close()
+	defer tru2.Close()
+
+	if tru1.Transport().LocalAddr().Network() != "unixgram" {
+		t.Fatalf("wrong transport network: %s",
+			tru1.Transport().LocalAddr().Network())
+	}
+
+	// Send messages from tru1 to tru2
+	go func() {
+		tcd := tru1.ConnectChannelAddr(tru2.Transport().LocalAddr(), 0)
+		for i := 0; i < numMessages; i++ {
+			tcd.Write([]byte("Hello-" + strconv.Itoa(i) + "!"))
+		}
+	}()
+
+	// Receive messages in tru2
+	idx := 0
+	timeout := time.After(10 * time.Second)
+	for idx < numMessages {
+		select {
+		case ev := <-tru2.ChanEvent():
+			if ev.Event != EvGotData {
+				continue
+			}
+			if data := string(ev.Data); data != "Hello-"+strconv.Itoa(idx)+"!" {
+				t.Fatalf("received wrong packet: %s, expected id: %d", data, idx)
+			}
+			idx++
+		case <-timeout:
+			t.Fatalf("timeout, received %d messages from %d", idx, numMessages)
+		}
+	}
+}
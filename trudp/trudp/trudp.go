@@ -8,6 +8,7 @@ package trudp
 
 import (
 	"net"
+	"runtime"
 	"strconv"
 	"time"
 
@@ -23,7 +24,7 @@ var MODULE = teokeys.Color(teokeys.ANSICyan, "(trudp)")
 
 const (
 	maxResendAttempt = 50               // (number) max number of resend packet from sendQueue
-	maxBufferSize    = 2048             // (bytes) send buffer size in bytes
+	maxBufferSize    = 4120             // (bytes) send and receive buffer size in bytes (more than max packet length)
 	pingAfter        = 1000             // (ms) send ping afret in ms
 	disconnectAfter  = 3000             // (ms) disconnect afret in ms
 	defaultRTT       = 30               // (ms) default retransmit time in ms
@@ -35,7 +36,8 @@ const (
 	chEventSize      = 2048 + maxRQueue // Size or read channel used to send messages to user level
 
 	// DefaultQueueSize is size of send and receive queue
-	DefaultQueueSize = 256 // 96
+	DefaultQueueSize = 256  // 96
+	maxQueueSize     = 2048 // Max size of send queue when it grows
 
 	helloMsg      = "hello"
 	echoMsg       = "ping\x00"
@@ -53,25 +55,28 @@ type TRUDP struct {
 	udp *udp
 
 	// Control maps, channels and function holder
-	tcdmap      map[string]*ChannelData // channel data map
-	chanEvent   chan *EventData         // User level event channel
-	allowEvents uint32                  // allow send events \TODO: use flags
-	packet      *packetType             // packet functions holder
-	ticker      *time.Ticker            // timer ticler
-	proc        *process                // process container
+	chanEvent   chan *EventData // User level event channel
+	allowEvents uint32          // allow send events \TODO: use flags
+	packet      *packetType     // packet functions holder
+	ticker      *time.Ticker    // timer ticler
+	proc        *process        // process container
 
 	// Logger configuration
 	logLevel int  // trudp log level
 	logLogF  bool // show time in trudp log
 
 	// Statistic
-	startTime time.Time   // TRUDP start running time
-	packets   packetsStat // TRUDP packets statistic
+	startTime time.Time // TRUDP start running time
 
-	defaultQueueSize int // Default queues size
+	cfg Config // Default channels configuration
 
 	// Control Flags
-	showStatF bool // Show statistic
+	showStatF     bool // Show statistic
+	mtuDiscoveryF bool // Channels path MTU discovery enabled
+	connectionIDF bool // Connection IDs in created channels enabled
+
+	// Server protection
+	protect protection
 }
 
 // trudpStat structure contain trudp statistic variables
@@ -83,6 +88,8 @@ type packetsStat struct {
 	receiveLength uint64        // Total reseived in bytes
 	dropped       uint32        // Total packet droped
 	repeat        uint32        // Total packet repeated
+	fec           uint32        // Total FEC packets send
+	recovered     uint32        // Total packets recovered by FEC
 	sendRT        RealTimeSpeed // Send real time speed
 	receiveRT     RealTimeSpeed // Receive real time speed
 	repeatRT      RealTimeSpeed // Repiat real time speed
@@ -208,28 +215,78 @@ const (
 	//SEND_DATA
 
 	EvResetLocal
+
+	/**
+	 * TR-UDP channel migrated to new address
+	 * @param data Previous channel key
+	 */
+	EvMigrated
+
+	/**
+	 * TR-UDP channel closed by FIN/FIN_ACK exchange (Close called at this or
+	 * remote host)
+	 * @param data Channel key
+	 */
+	EvClosed
 )
 
-// Init start trudp connection
-func Init(port *int) (trudp *TRUDP) {
+// Workers is the Init option which sets number of channels workers. Channels
+// are sharded between workers by channel key. Number of CPU is used by
+// default.
+type Workers int
+
+// Init start trudp connection. The options may contain PacketTransport to
+// use it instead of default UDP connection, Workers to set number of
+// channels workers, MTUDiscovery to enable channels path MTU discovery,
+// ConnectionID to enable connection IDs in created channels, Protection
+// to enable server protection from spoofed channels creation and Config to
+// set channels timing and queues sizes.
+func Init(port *int, opts ...interface{}) (trudp *TRUDP) {
 
 	trudp = &TRUDP{
-		udp:              &udp{},
-		packet:           &packetType{},
-		startTime:        time.Now(),
-		tcdmap:           make(map[string]*ChannelData),
-		chanEvent:        make(chan *EventData, chEventSize),
-		defaultQueueSize: DefaultQueueSize,
+		udp:       &udp{},
+		packet:    &packetType{},
+		startTime: time.Now(),
+		chanEvent: make(chan *EventData, chEventSize),
+		cfg:       defaultConfig,
 	}
 	trudp.packet.trudp = trudp
 
-	// Connect to UDP and start UDP workers
-	trudp.udp.listen(port)
-	trudp.proc = new(process).init(trudp)
+	// Connect to UDP or set user transport and start UDP workers
+	var transport PacketTransport
+	numWorkers := runtime.NumCPU()
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case PacketTransport:
+			transport = o
+		case Config:
+			trudp.cfg = o.merge(defaultConfig)
+		case Workers:
+			numWorkers = int(o)
+		case MTUDiscovery:
+			trudp.mtuDiscoveryF = bool(o)
+		case ConnectionID:
+			trudp.connectionIDF = bool(o)
+		case Protection:
+			trudp.protect.init(o)
+		}
+	}
+	if transport != nil {
+		trudp.udp.setTransport(transport, port)
+	} else {
+		trudp.udp.listen(port)
+	}
+	trudp.udp.initBatch(USEBATCH)
+	if trudp.mtuDiscoveryF {
+		trudp.udp.setDontFragment()
+	}
+	trudp.proc = new(process).init(trudp, numWorkers)
 
 	localAddr := trudp.udp.localAddr()
 	teolog.Log(teolog.CONNECT, MODULE, "start listenning at", localAddr)
-	go trudp.sendEvent(nil, EvInitialize, []byte(localAddr))
+	// The event channel is empty here, so the event is sent without
+	// goroutine and always before the channel closed by Close
+	trudp.sendEvent(nil, EvInitialize, []byte(localAddr))
 
 	return
 }
@@ -275,69 +332,74 @@ func (trudp *TRUDP) AllowEvents(events uint32) {
 
 // Run waits some data received from UDP port and procces it
 func (trudp *TRUDP) Run() {
+	process := trudp.processReceived
 	for {
-		buffer := make([]byte, maxBufferSize)
-
-		nRead, addr, err := trudp.udp.readFrom(buffer)
-		if err != nil {
+		if err := trudp.udp.readBatch(process); err != nil {
 			teolog.Log(teolog.CONNECT, MODULE, "stop listenning at", trudp.udp.localAddr())
-			close(trudp.proc.chanReader)
+			trudp.proc.stop()
 			trudp.proc.destroy()
 			trudp.proc.wg.Wait()
 			teolog.Log(teolog.CONNECT, MODULE, "stopped")
 			break
 		}
+	}
+}
 
-		switch {
-		// Empty packet
-		case nRead == 0:
-			teolog.DebugV(MODULE, "empty paket received from:", addr)
-
-		// Check trudp packet
-		case trudp.packet.check(buffer[:nRead]):
-			packet := &packetType{trudp: trudp, data: buffer[:nRead]}
-			trudp.proc.chanReader <- &readerType{addr, packet}
-
-		// Process connect message
-		// (this is non-trudp test command, it may be deprecated)
-		case nRead == len(helloMsg) &&
-			string(buffer[:len(helloMsg)]) == helloMsg:
-			teolog.Log(teolog.DEBUG, MODULE, "got", nRead,
-				"bytes 'connect' message from:", addr, "data: ", buffer[:nRead],
-				string(buffer[:nRead]))
-
-		// Process echo message Ping (send to Pong)
-		// (this is non-trudp test command, it may be deprecated)
-		case nRead > len(echoMsg) && string(buffer[:len(echoMsg)]) == echoMsg:
-			teolog.Log(teolog.DEBUG, MODULE, "got", nRead,
-				"byte 'ping' command from:", addr, buffer[:nRead])
-			trudp.udp.writeTo(append([]byte(echoAnswerMsg),
-				buffer[len(echoMsg):nRead]...), addr)
-
-		// Process echo answer message Pong (answer to Ping)
-		// (this is non-trudp test command, it may be deprecated)
-		case nRead > len(echoAnswerMsg) &&
-			string(buffer[:len(echoAnswerMsg)]) == echoAnswerMsg:
-			var ts time.Time
-			ts.UnmarshalBinary(buffer[len(echoAnswerMsg):nRead])
-			teolog.Log(teolog.DEBUG, MODULE, "got", nRead,
-				"byte 'pong' command from:", addr, "trip time:",
-				time.Since(ts), buffer[:nRead])
-
-		// Not trudp packet received (it may be teonet not-trudp commands)
-		default:
-			teolog.DebugVf(MODULE,
-				"got (---==Not TRUDP==---) %d bytes, from: %s\n", nRead, addr)
-			// Process teonet notTrudp messages if trudp channel exists, or
-			// ignore this message if channel does not exsists.
-			go trudp.kernel(func() {
-				tcd, _, ok := trudp.newChannelData(addr, 0, false, false)
-				if !ok {
-					return
-				}
-				tcd.trudp.sendEvent(tcd, EvGotDataNotrudp, buffer[:nRead])
-			})
-		}
+// processReceived process packet received from UDP. The buffer is reused by
+// UDP reader so it copied when packet is sent to other goroutines.
+func (trudp *TRUDP) processReceived(buffer []byte, addr net.Addr) {
+	nRead := len(buffer)
+	switch {
+	// Empty packet
+	case nRead == 0:
+		teolog.DebugV(MODULE, "empty paket received from:", addr)
+
+	// Check trudp packet
+	case trudp.packet.check(buffer):
+		packet := &packetType{trudp: trudp, data: append([]byte(nil), buffer...)}
+		key := trudp.makeKey(addr, packet.Channel())
+		trudp.proc.channelWorker(key, packet.CID()).chanReader <- &readerType{addr, packet}
+
+	// Process connect message
+	// (this is non-trudp test command, it may be deprecated)
+	case nRead == len(helloMsg) &&
+		string(buffer[:len(helloMsg)]) == helloMsg:
+		teolog.Log(teolog.DEBUG, MODULE, "got", nRead,
+			"bytes 'connect' message from:", addr, "data: ", buffer,
+			string(buffer))
+
+	// Process echo message Ping (send to Pong)
+	// (this is non-trudp test command, it may be deprecated)
+	case nRead > len(echoMsg) && string(buffer[:len(echoMsg)]) == echoMsg:
+		teolog.Log(teolog.DEBUG, MODULE, "got", nRead,
+			"byte 'ping' command from:", addr, buffer)
+		trudp.udp.writeTo(append([]byte(echoAnswerMsg),
+			buffer[len(echoMsg):]...), addr)
+
+	// Process echo answer message Pong (answer to Ping)
+	// (this is non-trudp test command, it may be deprecated)
+	case nRead > len(echoAnswerMsg) &&
+		string(buffer[:len(echoAnswerMsg)]) == echoAnswerMsg:
+		var ts time.Time
+		ts.UnmarshalBinary(buffer[len(echoAnswerMsg):])
+		teolog.Log(teolog.DEBUG, MODULE, "got", nRead,
+			"byte 'pong' command from:", addr, "trip time:",
+			time.Since(ts), buffer)
+
+	// Not trudp packet received (it may be teonet not-trudp commands)
+	default:
+		teolog.DebugVf(MODULE,
+			"got (---==Not TRUDP==---) %d bytes, from: %s\n", nRead, addr)
+		// Process teonet notTrudp messages if trudp channel exists, or
+		// ignore this message if channel does not exsists.
+		data := append([]byte(nil), buffer...)
+		go trudp.proc.channelWorker(trudp.makeKey(addr, 0), 0).kernel(func() {
+			tcd, _, ok := trudp.newChannelData(addr, 0, 0, false, false)
+			if !ok {
+				return
+			}
+			tcd.trudp.sendEvent(tcd, EvGotDataNotrudp, data)
+		})
 	}
 }
 
@@ -346,13 +408,6 @@ func (trudp *TRUDP) Running() bool {
 	return !trudp.proc.stopRunningF
 }
 
-// closeChannels Close all trudp channels
-func (trudp *TRUDP) closeChannels() {
-	for key, tcd := range trudp.tcdmap {
-		tcd.destroy(teolog.CONNECT, "close "+key)
-	}
-}
-
 // Close closes trudp connection and channelRead
 func (trudp *TRUDP) Close() {
 	if trudp.udp.conn != nil {
@@ -360,12 +415,9 @@ func (trudp *TRUDP) Close() {
 	}
 }
 
-// kernel run function in trudp kernel (main process)
-func (trudp *TRUDP) kernel(f func()) {
-	// \TODO may be use 'if trudp.Running()' here
-	if !trudp.proc.chanKernelF {
-		trudp.proc.chanKernel <- f
-	}
+// Transport return packet transport used by this trudp connection
+func (trudp *TRUDP) Transport() PacketTransport {
+	return trudp.udp.conn
 }
 
 // ChanEvent return channel to read trudp events
@@ -394,12 +446,20 @@ func (trudp *TRUDP) ShowStatistic() bool {
 
 // SetDefaultQueueSize set maximum send and receive queues size
 func (trudp *TRUDP) SetDefaultQueueSize(defaultQueueSize int) {
-	trudp.defaultQueueSize = defaultQueueSize
+	trudp.cfg.QueueSize = defaultQueueSize
+	trudp.cfg = trudp.cfg.merge(defaultConfig)
 }
 
-// GetAddr return IP and Port of local address
+// GetAddr return IP and Port of local address. The ip contains transport
+// local address string and port is 0 if transport is not UDP.
 func (trudp *TRUDP) GetAddr() (ip string, port int) {
-	ip = string(trudp.udp.conn.LocalAddr().(*net.UDPAddr).IP)
-	port = trudp.udp.conn.LocalAddr().(*net.UDPAddr).Port
+	addr := trudp.udp.conn.LocalAddr()
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		ip = addr.String()
+		return
+	}
+	ip = string(udpAddr.IP)
+	port = udpAddr.Port
 	return
 }
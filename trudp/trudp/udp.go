@@ -18,19 +18,35 @@ import (
 const USESYSCALL = false
 
 type udp struct {
-	conn *net.UDPConn // Listner UDP address
+	conn PacketTransport // Listner UDP connection or user defined transport
 
 	fd   int                   // Listen UDP syscall socket
 	addr syscall.SockaddrInet4 // Listen UDP syscall port
+
+	rbuf  []byte     // Receive buffer
+	batch *batchConn // Batch reader and writer (nil if batch is not used)
 }
 
-// resolveAddr returns an address of UDP end point
-func (udp *udp) resolveAddr(network, address string) (*net.UDPAddr, error) {
+// resolveAddr returns an address of UDP end point or an address resolved by
+// transport if it implements AddrResolver interface
+func (udp *udp) resolveAddr(network, address string) (net.Addr, error) {
+	if r, ok := udp.conn.(AddrResolver); ok {
+		return r.ResolveAddr(network, address)
+	}
 	return net.ResolveUDPAddr(network, address)
 }
 
+// setTransport sets user defined packet transport and sets port from its local
+// address if it is UDP address
+func (udp *udp) setTransport(transport PacketTransport, port *int) {
+	udp.conn = transport
+	if a, ok := transport.LocalAddr().(*net.UDPAddr); ok {
+		*port = a.Port
+	}
+}
+
 // listen Connect to UDP with selected port (the port incremented if busy)
-func (udp *udp) listen(port *int) *net.UDPConn {
+func (udp *udp) listen(port *int) PacketTransport {
 
 	// Combine service from host name and port
 	service := hostName + ":" + strconv.Itoa(*port)
@@ -38,7 +54,7 @@ func (udp *udp) listen(port *int) *net.UDPConn {
 	// Resolve the UDP address so that we can make use of ListenUDP
 	// with an actual IP and port instead of a name (in case a
 	// hostname is specified).
-	udpAddr, err := udp.resolveAddr(network, service)
+	udpAddr, err := net.ResolveUDPAddr(network, service)
 	if err != nil {
 		panic(err)
 	}
@@ -47,6 +63,7 @@ func (udp *udp) listen(port *int) *net.UDPConn {
 	fn := func() {
 		udp.conn, err = net.ListenUDP(network, udpAddr)
 		if err != nil {
+			udp.conn = nil
 			*port++
 			fmt.Println("the", *port-1, "is busy, try next port:", *port)
 			udp.conn = udp.listen(port)
@@ -78,7 +95,7 @@ func (udp *udp) listen(port *int) *net.UDPConn {
 
 	// If input faunction paameter port was 0 than get it from connection for
 	// future use
-	if *port == 0 {
+	if *port == 0 && udp.conn != nil {
 		*port = udp.conn.LocalAddr().(*net.UDPAddr).Port
 	}
 
@@ -100,23 +117,29 @@ func (udp *udp) localAddr() string {
 	return str + ":" + strconv.Itoa(udp.addr.Port)
 }
 
-// readFrom acts like ReadFrom but returns a UDPAddr.
-func (udp *udp) readFrom(b []byte) (int, *net.UDPAddr, error) {
-	if udp.conn != nil {
-		return udp.conn.ReadFromUDP(b)
+// readFrom read packet from transport, returns number of bytes read and
+// remote host address.
+func (udp *udp) readFrom(b []byte) (int, net.Addr, error) {
+	switch conn := udp.conn.(type) {
+	case nil:
+	case *net.UDPConn:
+		return conn.ReadFromUDP(b)
+	default:
+		return conn.ReadFrom(b)
 	}
 	n, addr, err := syscall.Recvfrom(udp.fd, b, 0)
 	a := addr.(*syscall.SockaddrInet4)
 	return n, &net.UDPAddr{IP: a.Addr[:], Port: a.Port}, err
 }
 
-// WriteToUDP acts like WriteTo but takes a UDPAddr.
-func (udp *udp) writeTo(b []byte, addr *net.UDPAddr) (int, error) {
+// writeTo write packet to transport.
+func (udp *udp) writeTo(b []byte, addr net.Addr) (int, error) {
 	if udp.conn != nil {
-		return udp.conn.WriteToUDP(b, addr)
+		return udp.conn.WriteTo(b, addr)
 	}
-	a := &syscall.SockaddrInet4{Port: addr.Port}
-	copy(a.Addr[:], addr.IP)
+	udpAddr := addr.(*net.UDPAddr)
+	a := &syscall.SockaddrInet4{Port: udpAddr.Port}
+	copy(a.Addr[:], udpAddr.IP)
 	err := syscall.Sendto(udp.fd, b, 0, a)
 	return len(b), err
 }
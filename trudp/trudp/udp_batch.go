@@ -0,0 +1,119 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This module contain functions and structures to read and write batches of
+// UDP packets with one system call (recvmmsg and sendmmsg on Linux)
+
+package trudp
+
+import (
+	"net"
+	"runtime"
+
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// USEBATCH flag enables batched reads and writes of UDP packets. The batch
+// system calls are used on Linux only, so it enabled on Linux by default.
+const USEBATCH = runtime.GOOS == "linux"
+
+// batchSize is max number of packets read or written by one system call
+const batchSize = 64
+
+// batchReadWriter is the UDP connection which reads and writes batches of
+// packets (ipv4.PacketConn or ipv6.PacketConn)
+type batchReadWriter interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// batchConn is the UDP connection batch reader and writer. The messages and
+// receive buffers are allocated once and reused by each batch.
+type batchConn struct {
+	conn batchReadWriter // Batch reader and writer
+	rms  []ipv4.Message  // Read messages with receive buffers
+	wms  []ipv4.Message  // Write messages
+}
+
+// newBatchConn create batch reader and writer of UDP connection
+func newBatchConn(conn *net.UDPConn) (b *batchConn) {
+	b = &batchConn{
+		rms: make([]ipv4.Message, batchSize),
+		wms: make([]ipv4.Message, batchSize),
+	}
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() != nil {
+		b.conn = ipv4.NewPacketConn(conn)
+	} else {
+		b.conn = ipv6.NewPacketConn(conn)
+	}
+	for i := range b.rms {
+		b.rms[i].Buffers = [][]byte{make([]byte, maxBufferSize)}
+		b.wms[i].Buffers = make([][]byte, 1)
+	}
+	return
+}
+
+// initBatch create receive buffer and batch reader and writer if batch
+// enabled and transport is UDP connection
+func (udp *udp) initBatch(enable bool) {
+	udp.batch = nil
+	udp.rbuf = make([]byte, maxBufferSize)
+	if conn, ok := udp.conn.(*net.UDPConn); ok && enable {
+		udp.batch = newBatchConn(conn)
+	}
+}
+
+// readBatch read one or more packets from transport and call fn for each
+// received packet. The packet buffer is reused and valid during fn call only.
+func (udp *udp) readBatch(fn func(b []byte, addr net.Addr)) error {
+	if udp.batch == nil {
+		n, addr, err := udp.readFrom(udp.rbuf)
+		if err != nil {
+			return err
+		}
+		fn(udp.rbuf[:n], addr)
+		return nil
+	}
+	ms := udp.batch.rms
+	n, err := udp.batch.conn.ReadBatch(ms, 0)
+	if err != nil {
+		return err
+	}
+	for i := range ms[:n] {
+		fn(ms[i].Buffers[0][:ms[i].N], ms[i].Addr)
+	}
+	return nil
+}
+
+// writeBatch write packets to transport. All packets are written with one
+// system call if batch enabled.
+func (udp *udp) writeBatch(ws []writerType) {
+	if udp.batch == nil {
+		for _, w := range ws {
+			udp.writeTo(w.packet.data, w.addr)
+		}
+		return
+	}
+	ms := udp.batch.wms[:len(ws)]
+	for i, w := range ws {
+		ms[i].Buffers[0] = w.packet.data
+		ms[i].Addr = w.addr
+	}
+	for m := ms; len(m) > 0; {
+		n, err := udp.batch.conn.WriteBatch(m, 0)
+		if err != nil {
+			// Skip packet which can't be sent, it will be resent from send
+			// queue if it is data packet
+			teolog.DebugVf(MODULE, "write batch to %s error: %s\n", m[0].Addr, err)
+			n = 1
+		}
+		m = m[n:]
+	}
+	for i := range ms {
+		ms[i].Buffers[0] = nil
+		ms[i].Addr = nil
+	}
+}
@@ -0,0 +1,92 @@
+package trudp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// benchUDP create listening udp with batch enabled or disabled
+func benchUDP(b *testing.B, batch bool) *udp {
+	conn, err := net.ListenUDP(network, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	u := &udp{conn: conn}
+	u.initBatch(batch)
+	b.Cleanup(func() { conn.Close() })
+	return u
+}
+
+// benchWriters create batch of data packets sent to addr
+func benchWriters(addr net.Addr) (ws []writerType) {
+	pac := &packetType{}
+	for i := 0; i < batchSize; i++ {
+		ws = append(ws, writerType{
+			pac.newData(uint32(i), 0, make([]byte, 256)).copy(), addr})
+	}
+	return
+}
+
+// reportPPS report packets per second metric
+func reportPPS(b *testing.B, start time.Time, packets int) {
+	b.ReportMetric(float64(packets)/time.Since(start).Seconds(), "pkt/s")
+}
+
+// BenchmarkUDPWrite compare sending packets one by one and by batch. Each
+// iteration sends batchSize packets.
+func BenchmarkUDPWrite(b *testing.B) {
+	for _, bench := range []struct {
+		name  string
+		batch bool
+	}{{"single", false}, {"batch", true}} {
+		b.Run(bench.name, func(b *testing.B) {
+			src, dst := benchUDP(b, bench.batch), benchUDP(b, false)
+			ws := benchWriters(dst.conn.LocalAddr())
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				src.writeBatch(ws)
+			}
+			reportPPS(b, start, b.N*len(ws))
+		})
+	}
+}
+
+// BenchmarkUDPRead compare receiving packets one by one and by batch. Each
+// iteration reads one packet while other goroutine sends packets by batch.
+func BenchmarkUDPRead(b *testing.B) {
+	for _, bench := range []struct {
+		name  string
+		batch bool
+	}{{"single", false}, {"batch", true}} {
+		b.Run(bench.name, func(b *testing.B) {
+			src, dst := benchUDP(b, true), benchUDP(b, bench.batch)
+			ws := benchWriters(dst.conn.LocalAddr())
+			stop := make(chan struct{})
+			defer close(stop)
+			go func() {
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						src.writeBatch(ws)
+					}
+				}
+			}()
+			var n int
+			fn := func(buf []byte, addr net.Addr) { n++ }
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			for n < b.N {
+				if err := dst.readBatch(fn); err != nil {
+					b.Fatal(err)
+				}
+			}
+			reportPPS(b, start, n)
+		})
+	}
+}
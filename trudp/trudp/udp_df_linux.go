@@ -0,0 +1,43 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package trudp
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+// setDontFragment set Don't Fragment flag to packets sent from UDP connection
+// (IP_PMTUDISC_PROBE: packets are not fragmented and kernel path MTU is
+// ignored) to make path MTU probes possible
+func (udp *udp) setDontFragment() {
+	conn, ok := udp.conn.(*net.UDPConn)
+	if !ok {
+		return
+	}
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return
+	}
+	// The IPv4 or IPv6 option is set depend on socket family (both are set
+	// for dual stack socket)
+	rc.Control(func(fd uintptr) {
+		err4 := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP,
+			syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+		err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6,
+			syscall.IPV6_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+		if err4 == nil {
+			err = nil
+		}
+	})
+	if err != nil {
+		teolog.Log(teolog.DEBUGv, MODULE, "can't set don't fragment flag:", err)
+	}
+}
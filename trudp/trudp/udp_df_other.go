@@ -0,0 +1,12 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package trudp
+
+// setDontFragment does nothing on this platform: packets are sent with system
+// default Don't Fragment flag
+func (udp *udp) setDontFragment() {}
@@ -56,7 +56,7 @@ func BenchmarkSyscallUDP() { //t *testing.B) {
 		if err := syscall.Sendto(fd, packet.data, flags, addr); err != nil {
 			panic(err)
 		}
-		pac.freeCreated(packet.data)
+		packet.release()
 	}
 	res := time.Since(t)
 
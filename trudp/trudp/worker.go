@@ -0,0 +1,181 @@
+// Copyright 2019 teonet-go authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This module contain channels worker. Each worker owns part of trudp
+// channels and process its received packets, writes and timers in one
+// goroutine.
+
+package trudp
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/kirill-scherba/teonet-go/teolog/teolog"
+)
+
+// worker data structure
+type worker struct {
+	proc        *process                // link to process
+	idx         int                     // worker index
+	tcdmap      map[string]*ChannelData // channels owned by this worker
+	cids        map[uint64]*ChannelData // channels with connection ID owned by this worker
+	chanReader  chan *readerType        // channel to read (used to process packets received from udp)
+	chanWrite   chan *writeType         // channel to write (used to send data from user level)
+	chanKernel  chan func()             // channel to execute function on worker level
+	timerResend <-chan time.Time        // resend packet from send queue timer
+	done        chan struct{}           // worker stopped signal
+	packets     packetsStat             // worker channels packets statistic
+}
+
+// workerTick is the worker timer period: channels send queues, pings and
+// disconnects are checked once per tick, so it is the floor of Config
+// DefaultRTT and PingAfter values
+const workerTick = defaultRTT * time.Millisecond
+
+// init create and start channels worker
+func (w *worker) init(proc *process, idx int) *worker {
+
+	w.proc = proc
+	w.idx = idx
+	trudp := proc.trudp
+
+	// Set time variables
+	resendTime := workerTick
+
+	// Init channels and timers
+	w.tcdmap = make(map[string]*ChannelData)
+	w.cids = make(map[uint64]*ChannelData)
+	w.chanKernel = make(chan func())                   // run in kernel channel
+	w.chanReader = make(chan *readerType, chRWUdpSize) // read from udp channel
+	w.chanWrite = make(chan *writeType, chWriteSize)   // write from user level
+	w.done = make(chan struct{})
+	//
+	w.timerResend = time.After(resendTime)
+
+	var ebzdik1 = 0
+
+	go func() {
+
+		teolog.Log(teolog.CONNECT, MODULE, "process worker", idx, "started")
+
+		// Do it on return
+		defer func() {
+			// Close worker trudp channels
+			w.closeChannels()
+			close(w.done)
+			teolog.Log(teolog.CONNECT, MODULE, "process worker", idx, "stopped")
+			proc.wgWorkers.Done()
+		}()
+
+		chanWriteClosedF := false
+
+		for i := 0; ; {
+			select {
+
+			// Process read packet (received from udp)
+			case readPac, ok := <-w.chanReader:
+				if !ok {
+					if !chanWriteClosedF {
+						chanWriteClosedF = true
+						close(w.chanWrite)
+					}
+					break
+				}
+				// Process packets if chanEvent is available receive it to avoid deadlock
+				// \TODO: May be drop only data packets but process asks and packets
+				// which we wait to free receive queue
+				if trudp.sendEventAvailable() {
+					readPac.packet.process(readPac.addr)
+					ebzdik1 = 0
+				} else {
+					teolog.Error(MODULE, "ebzdik-1 chanEvent len: "+
+						strconv.Itoa(len(trudp.chanEvent))+" <===- ", ebzdik1)
+					ebzdik1++
+				}
+
+			// Process write packet (received from user level, need write to udp)
+			case writePac, ok := <-w.chanWrite:
+				if !ok {
+					return
+				}
+				proc.writeTo(writePac)
+
+			case f := <-w.chanKernel:
+				f()
+
+			// Process send queue (resend packets from send queue), check Keep
+			// alive and show statistic (check after 30 ms)
+			case <-w.timerResend:
+				// Loop trudp channels map and check Resend send queue and/or
+				// send keep alive signal (ping)
+				for _, tcd := range w.tcdmap {
+					// Resend
+					tcd.sendQueueResendProcess()
+					// Path MTU discovery
+					tcd.pmtuProcess()
+					// Send FEC packet of not full group
+					tcd.fecFlush()
+					// Send FIN packet of closing channel
+					tcd.closeProcess()
+					// Send migration key
+					tcd.migrateKeyProcess()
+					// Send cookie request
+					tcd.cookieRequestProcess()
+					// Keep alive
+					tcd.keepAlive()
+					// Send test message (every 33*30ms = 990ms)
+					if i%33 == 0 {
+						tcd.sendTestMsg()
+					}
+					// Calculate sendQueue size (every 3*30ms = 90ms)
+					if i%3 == 0 {
+						tcd.sendQueueCalculateLength()
+					}
+				}
+				// Show statistic window (every 3*30ms = 90ms)
+				if i%3 == 0 && idx == 0 {
+					proc.showStatistic()
+				}
+				// Execute statistic callback
+				if idx == 0 {
+					proc.statsCallback()
+				}
+				w.timerResend = time.After(resendTime) // Set new timer value
+				i++
+			}
+		}
+	}()
+
+	return w
+}
+
+// kernel run function in worker goroutine. The function is not executed if
+// worker stopped.
+func (w *worker) kernel(f func()) {
+	select {
+	case w.chanKernel <- f:
+	case <-w.done:
+	}
+}
+
+// kernelWait run function in worker goroutine and wait it done
+func (w *worker) kernelWait(f func()) {
+	done := make(chan bool, 1)
+	go w.kernel(func() {
+		f()
+		done <- true
+	})
+	select {
+	case <-done:
+	case <-w.done:
+	}
+}
+
+// closeChannels Close worker trudp channels
+func (w *worker) closeChannels() {
+	for key, tcd := range w.tcdmap {
+		tcd.destroy(teolog.CONNECT, "close "+key)
+	}
+}